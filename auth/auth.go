@@ -19,7 +19,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -38,7 +37,6 @@ import (
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
 	"github.com/googleapis/gax-go/v2"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/oauth"
 	authenticationv1 "k8s.io/api/authentication/v1"
@@ -69,34 +67,14 @@ type credentialsFile struct {
 }
 
 // TokenSource returns the correct oauth2.TokenSource depending on the auth
-// configuration of the MountConfig.
+// configuration of the MountConfig, using the first of the built-in
+// Providers that applies.
 func (c *Client) TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error) {
-	allowSecretRef, err := vars.AllowNodepublishSeretRef.GetBooleanValue()
+	p, err := SelectProvider(c.Providers(), cfg)
 	if err != nil {
-		klog.ErrorS(err, "failed to get ALLOW_NODE_PUBLISH_SECRET flag")
-		klog.Fatal("failed to get ALLOW_NODE_PUBLISH_SECRET flag")
-	}
-	if cfg.AuthNodePublishSecret && allowSecretRef {
-		creds, err := google.CredentialsFromJSON(ctx, cfg.AuthKubeSecret, cloudScope)
-		if err != nil {
-			return nil, fmt.Errorf("unable to generate credentials from key.json: %w", err)
-		}
-		return creds.TokenSource, nil
-	}
-
-	if cfg.AuthProviderADC {
-		return google.DefaultTokenSource(ctx, cloudScope)
-	}
-
-	if cfg.AuthPodADC {
-		token, err := c.Token(ctx, cfg)
-		if err != nil {
-			return nil, fmt.Errorf("unable to obtain workload identity auth: %v", err)
-		}
-		return oauth2.StaticTokenSource(token), nil
+		return nil, err
 	}
-
-	return nil, errors.New("mount configuration has no auth method configured")
+	return p.TokenSource(ctx, cfg)
 }
 
 // Token fetches a workload identity auth token for the pod for the MountConfig.
@@ -351,3 +329,12 @@ func tradeIDBindToken(ctx context.Context, client *http.Client, k8sToken, audien
 	}
 	return idBindToken, nil
 }
+
+// PodMetadata returns the metadata of the pod.
+func (c *Client) PodMetadata(ctx context.Context, namespace, name string) (*v1.ObjectMeta, error) {
+	pod, err := c.KubeClient.CoreV1().Pods(namespace).Get(ctx, name, v1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch pod: %w", err)
+	}
+	return &pod.ObjectMeta, nil
+}
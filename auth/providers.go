@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"k8s.io/klog/v2"
+)
+
+// CredentialProvider obtains the credentials authenticating the Secret
+// Manager calls of a mount.
+type CredentialProvider interface {
+	// Name identifies the provider in logs.
+	Name() string
+	// Applies reports whether the provider handles the auth configuration of
+	// cfg.
+	Applies(cfg *config.MountConfig) bool
+	// TokenSource returns the token source for the mount.
+	TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error)
+}
+
+// Providers returns the built-in credential providers in order of precedence:
+// a node publish secret, the provider's Application Default Credentials, then
+// the pod's workload identity.
+func (c *Client) Providers() []CredentialProvider {
+	return []CredentialProvider{
+		nodePublishSecretProvider{},
+		providerADCProvider{},
+		podWorkloadIdentityProvider{client: c},
+	}
+}
+
+// SelectProvider returns the first of providers that applies to cfg.
+func SelectProvider(providers []CredentialProvider, cfg *config.MountConfig) (CredentialProvider, error) {
+	for _, p := range providers {
+		if p.Applies(cfg) {
+			return p, nil
+		}
+	}
+	return nil, errors.New("mount configuration has no auth method configured")
+}
+
+// nodePublishSecretProvider uses the Google credentials of the K8s Secret
+// passed on the NodePublish call.
+type nodePublishSecretProvider struct{}
+
+func (nodePublishSecretProvider) Name() string { return "node-publish-secret" }
+
+func (nodePublishSecretProvider) Applies(cfg *config.MountConfig) bool {
+	allowSecretRef, err := vars.AllowNodepublishSeretRef.GetBooleanValue()
+	if err != nil {
+		klog.ErrorS(err, "failed to get ALLOW_NODE_PUBLISH_SECRET flag")
+		klog.Fatal("failed to get ALLOW_NODE_PUBLISH_SECRET flag")
+	}
+	return cfg.AuthNodePublishSecret && allowSecretRef
+}
+
+func (nodePublishSecretProvider) TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error) {
+	creds, err := google.CredentialsFromJSON(ctx, cfg.AuthKubeSecret, cloudScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate credentials from key.json: %w", err)
+	}
+	return creds.TokenSource, nil
+}
+
+// providerADCProvider uses the Application Default Credentials of the
+// provider DaemonSet.
+type providerADCProvider struct{}
+
+func (providerADCProvider) Name() string { return "provider-adc" }
+
+func (providerADCProvider) Applies(cfg *config.MountConfig) bool { return cfg.AuthProviderADC }
+
+func (providerADCProvider) TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error) {
+	return google.DefaultTokenSource(ctx, cloudScope)
+}
+
+// podWorkloadIdentityProvider trades the pod's K8s service account token for
+// a Google token through workload identity.
+type podWorkloadIdentityProvider struct {
+	client *Client
+}
+
+func (podWorkloadIdentityProvider) Name() string { return "pod-workload-identity" }
+
+func (podWorkloadIdentityProvider) Applies(cfg *config.MountConfig) bool { return cfg.AuthPodADC }
+
+func (p podWorkloadIdentityProvider) TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error) {
+	token, err := p.client.Token(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain workload identity auth: %v", err)
+	}
+	return oauth2.StaticTokenSource(token), nil
+}
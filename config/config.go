@@ -17,16 +17,29 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
 	"gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
-	"encoding/base64"
 )
 
 const (
@@ -35,6 +48,15 @@ const (
 	attributePodUID               = "csi.storage.k8s.io/pod.uid"
 	attributeServiceAccountName   = "csi.storage.k8s.io/serviceAccount.name"
 	attributeServiceAccountTokens = "csi.storage.k8s.io/serviceAccount.tokens" //#nosec G101 -- This is a false positive. Token value is not being revealed. This is just the key name.
+	attributeStripBOM             = "stripBOM"
+	attributeLabels               = "labels"
+	attributeCombineIntoJSON      = "combineIntoJSON"
+	attributeSELinuxContext       = "seLinuxContext"
+	attributeRequireFresh         = "requireFresh"
+	attributeEmitTLSPair          = "emitTLSPair"
+	attributeEmitManifest         = "emitManifest"
+	attributeGateAnnotation       = "gateAnnotation"
+	attributeEmitEnvFile          = "emitEnvFile"
 )
 
 // Secret holds the parameters of the SecretProviderClass CRD. Links the GCP
@@ -50,12 +72,196 @@ type Secret struct {
 	// Path is the relative path where the contents of the secret are written.
 	Path string `json:"path" yaml:"path"`
 
+	// FileNameFrom derives the file name of a secret without FileName or
+	// Path, either from its secret id with "secretId" or from the value of
+	// one of its labels with "label:<key>".
+	FileNameFrom string `json:"fileNameFrom,omitempty" yaml:"fileNameFrom,omitempty"`
+
+	// SubPath is an optional directory, relative to the mount, that the file
+	// is written under. It lets containers sharing a mount each read from
+	// their own directory.
+	SubPath string `json:"subPath,omitempty" yaml:"subPath,omitempty"`
+
 	// Mode is the optional file mode for the file containing the secret. Must be
 	// an octal value between 0000 and 0777 or a decimal value between 0 and 511
 	Mode *int32 `json:"mode,omitempty" yaml:"mode,omitempty"`
 
+	// ModeString is the file mode as an octal string, e.g. "0400". It may be
+	// combined with Mode only when both are the same mode.
+	ModeString string `json:"modeString,omitempty" yaml:"modeString,omitempty"`
+
 	// Encoding specifies the encoding of the secret value. Currently supports "base64"
 	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+
+	// EncodeOnWrite encodes the files of the secret before they are written,
+	// the opposite of Encoding. Currently supports "base64".
+	EncodeOnWrite string `json:"encodeOnWrite,omitempty" yaml:"encodeOnWrite,omitempty"`
+
+	// StripBOM removes a leading UTF-8 or UTF-16 byte order mark from the
+	// secret payload before it is written. It is not applied to secrets with
+	// an Encoding since their decoded payload is binary.
+	StripBOM bool `json:"stripBOM,omitempty" yaml:"stripBOM,omitempty"`
+
+	// SourceCharset is the IANA name of the charset the payload is stored
+	// in, e.g. "ISO-8859-1". The payload is transcoded to UTF-8 before it is
+	// written.
+	SourceCharset string `json:"sourceCharset,omitempty" yaml:"sourceCharset,omitempty"`
+
+	// TrimSpace removes leading and trailing whitespace, including spaces,
+	// tabs and newlines, from text secrets. Secrets with an Encoding and
+	// payloads that are not valid UTF-8 are left unchanged.
+	TrimSpace bool `json:"trimSpace,omitempty" yaml:"trimSpace,omitempty"`
+
+	// CacheTTLSeconds overrides the provider wide cache TTL for the secret.
+	// Zero or a negative value disables caching for the secret.
+	CacheTTLSeconds *int64 `json:"cacheTTLSeconds,omitempty" yaml:"cacheTTLSeconds,omitempty"`
+
+	// Optional skips the secret instead of failing the mount when it cannot
+	// be fetched. No file is written for a skipped secret.
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty"`
+
+	// Placeholder is written instead of the secret while the pod lacks the
+	// MountConfig.GateAnnotation. The secret is skipped when empty.
+	Placeholder string `json:"placeholder,omitempty" yaml:"placeholder,omitempty"`
+
+	// ResolveAttempts resolves a version alias, such as latest, to its version
+	// number in a separate call before the payload is accessed, with this
+	// many attempts. Aliases are resolved by the access call itself when 0.
+	ResolveAttempts int `json:"resolveAttempts,omitempty" yaml:"resolveAttempts,omitempty"`
+
+	// PayloadAttempts overrides the attempts of the retry policy for
+	// accessing the payload, 1 disables retries. The retry policy of the
+	// location applies when 0.
+	PayloadAttempts int `json:"payloadAttempts,omitempty" yaml:"payloadAttempts,omitempty"`
+
+	// JSONKey is the key of the secret in the MountConfig.CombineIntoJSON
+	// file. The secret is not written to a file of its own.
+	JSONKey string `json:"jsonKey,omitempty" yaml:"jsonKey,omitempty"`
+
+	// EnvKey is the variable name of the secret in the MountConfig.EmitEnvFile
+	// file. The secret is not written to a file of its own.
+	EnvKey string `json:"envKey,omitempty" yaml:"envKey,omitempty"`
+
+	// FallbackProjects are tried in order, with the same secret id and
+	// version, when the secret is NotFound or Unavailable in its own project.
+	FallbackProjects []string `json:"fallbackProjects,omitempty" yaml:"fallbackProjects,omitempty"`
+
+	// ReplicaLocations are tried in order, with the same project, secret id
+	// and version, when a regional secret is NotFound or Unavailable in its
+	// own location.
+	ReplicaLocations []string `json:"replicaLocations,omitempty" yaml:"replicaLocations,omitempty"`
+
+	// NoCache always fetches the secret from Secret Manager and never stores
+	// it in the provider cache, even when caching is enabled.
+	NoCache bool `json:"noCache,omitempty" yaml:"noCache,omitempty"`
+
+	// Metadata writes a "<path>.metadata.json" file next to the secret with
+	// the accessed version name and its etag.
+	Metadata bool `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Provenance writes a "<path>.provenance.json" file next to the secret
+	// with the create time of the version and the labels and replication of
+	// the secret. It never contains the payload.
+	Provenance bool `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+
+	// ReplicationFile writes a "<path>.replication.json" file next to the
+	// secret describing where the secret is replicated.
+	ReplicationFile bool `json:"replicationFile,omitempty" yaml:"replicationFile,omitempty"`
+
+	// Transform converts the payload before it is written, e.g. "pem-to-jwk".
+	Transform string `json:"transform,omitempty" yaml:"transform,omitempty"`
+
+	// TransformPassword unlocks an encrypted payload for Transform, e.g. a
+	// "pkcs12-extract" bundle. Prefer TransformPasswordSecret for passwords
+	// that are sensitive.
+	TransformPassword string `json:"transformPassword,omitempty" yaml:"transformPassword,omitempty"`
+
+	// TransformPasswordSecret is a secret version, in the same format as
+	// ResourceName, holding the password for Transform. It takes precedence
+	// over TransformPassword.
+	TransformPasswordSecret string `json:"transformPasswordSecret,omitempty" yaml:"transformPasswordSecret,omitempty"`
+
+	// FingerprintFormat formats the output of the "cert-fingerprint-sha256"
+	// transform: "colon-upper" (the default, as printed by openssl),
+	// "colon-lower", "upper" or "lower".
+	FingerprintFormat string `json:"fingerprintFormat,omitempty" yaml:"fingerprintFormat,omitempty"`
+
+	// ValidateRegex is matched against the final payload, after decoding and
+	// extraction, and fails the mount when it does not match. Payloads that
+	// are not valid UTF-8 always fail validation.
+	ValidateRegex string `json:"validateRegex,omitempty" yaml:"validateRegex,omitempty"`
+
+	// RequireKMSKey is a Cloud KMS key, in the format
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*, that every replica of
+	// the secret version must be encrypted with. The mount fails otherwise.
+	RequireKMSKey string `json:"requireKMSKey,omitempty" yaml:"requireKMSKey,omitempty"`
+
+	// ExtractEnvKeys treats the secret payload as a dotenv file and replaces
+	// it with only the listed keys, written as KEY=VALUE entries.
+	ExtractEnvKeys []string `json:"extractEnvKeys,omitempty" yaml:"extractEnvKeys,omitempty"`
+
+	// ExtractEnvOptionalKeys lists keys of ExtractEnvKeys that are skipped
+	// when missing instead of failing the mount.
+	ExtractEnvOptionalKeys []string `json:"extractEnvOptionalKeys,omitempty" yaml:"extractEnvOptionalKeys,omitempty"`
+
+	// ExtractEnvSeparator separates the extracted entries. Defaults to a
+	// newline.
+	ExtractEnvSeparator string `json:"extractEnvSeparator,omitempty" yaml:"extractEnvSeparator,omitempty"`
+
+	// ExtractEnvKeyCase optionally converts the extracted key names to
+	// "upper" or "lower" case.
+	ExtractEnvKeyCase string `json:"extractEnvKeyCase,omitempty" yaml:"extractEnvKeyCase,omitempty"`
+
+	// SplitDelimiter splits the payload on the delimiter into numbered
+	// files, e.g. "certs.0", "certs.1". A payload without the delimiter is
+	// written to the ".0" file.
+	SplitDelimiter string `json:"splitDelimiter,omitempty" yaml:"splitDelimiter,omitempty"`
+
+	// SplitSkipEmpty drops empty segments of SplitDelimiter, such as the one
+	// after a trailing delimiter, instead of writing empty files. The files
+	// are numbered without gaps.
+	SplitSkipEmpty bool `json:"splitSkipEmpty,omitempty" yaml:"splitSkipEmpty,omitempty"`
+
+	// TrailingSeparator ends every segment with its separator, the last one
+	// included, for consumers concatenating them: each SplitDelimiter file
+	// ends with the delimiter and each ExtractEnvKeys entry with
+	// ExtractEnvSeparator.
+	TrailingSeparator bool `json:"trailingSeparator,omitempty" yaml:"trailingSeparator,omitempty"`
+
+	// NormalizeJSON parses the payload as JSON, failing the mount when it is
+	// invalid, and writes it in a canonical compact form with sorted keys.
+	NormalizeJSON bool `json:"normalizeJSON,omitempty" yaml:"normalizeJSON,omitempty"`
+	// PrettyJSON indents the output of NormalizeJSON instead of compacting
+	// it.
+	PrettyJSON bool `json:"prettyJSON,omitempty" yaml:"prettyJSON,omitempty"`
+
+	// ImpersonateServiceAccount is the email of a service account the
+	// credentials of the mount impersonate to access this secret, e.g. for
+	// secrets of a project the mount identity can not read directly.
+	ImpersonateServiceAccount string `json:"impersonateServiceAccount,omitempty" yaml:"impersonateServiceAccount,omitempty"`
+
+	// PreviousVersions also writes up to this many enabled versions created
+	// before the accessed one, newest first, to <path>.previous.1 and so on.
+	// They are written without any processing and are not part of the
+	// rotation comparison.
+	PreviousVersions int `json:"previousVersions,omitempty" yaml:"previousVersions,omitempty"`
+
+	// PreviousVersionsCreatedAfter only considers versions created after
+	// this RFC 3339 time for PreviousVersions.
+	PreviousVersionsCreatedAfter string `json:"previousVersionsCreatedAfter,omitempty" yaml:"previousVersionsCreatedAfter,omitempty"`
+
+	// DependsOn lists the file names or paths of secrets of the mount whose
+	// files must precede the files of this secret in the mount response.
+	DependsOn []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+
+	// AdditionalPaths are written with the same contents as the secret file,
+	// e.g. for a tooling readable copy. They are relative to the mount and
+	// not affected by SubPath.
+	AdditionalPaths []string `json:"additionalPaths,omitempty" yaml:"additionalPaths,omitempty"`
+
+	// MinVersion fails the mount when the accessed version number is below
+	// it, e.g. when latest is served by a replica that lags behind a rollout.
+	MinVersion int `json:"minVersion,omitempty" yaml:"minVersion,omitempty"`
 }
 
 // PodInfo includes details about the pod that is receiving the mount event.
@@ -65,6 +271,12 @@ type PodInfo struct {
 	UID                  types.UID
 	ServiceAccount       string
 	ServiceAccountTokens string
+	// Annotations of the pod, only looked up when the mount has a
+	// GateAnnotation.
+	Annotations map[string]string
+	// Terminating is set when the pod is being deleted. It is only looked up
+	// when the provider skips terminating pods.
+	Terminating bool
 }
 
 // MountConfig holds the parsed information from a mount event.
@@ -88,6 +300,46 @@ type MountConfig struct {
 	// Google credential (parseable by google.CredentialsFromJSON).
 	AuthNodePublishSecret bool
 	AuthKubeSecret        []byte
+	// StripBOM is the mount wide default for Secret.StripBOM.
+	StripBOM bool
+	// CombineIntoJSON is the path of a JSON object file holding every secret
+	// with a JSONKey, instead of writing those secrets to their own file.
+	CombineIntoJSON string
+	// EmitEnvFile is the path of a dotenv file with a KEY=VALUE line for
+	// every secret with an EnvKey, instead of writing those secrets to their
+	// own file. Binary payloads, which are not valid UTF-8, are base64
+	// encoded like in CombineIntoJSON.
+	EmitEnvFile string
+	// EmitTLSPair writes the secrets it binds as the tls.crt and tls.key
+	// files of a Kubernetes TLS secret, instead of writing those secrets to
+	// their own file.
+	EmitTLSPair *TLSPair
+	// EmitManifest is the path of a JSON manifest listing the path, secret
+	// version and SHA256 checksum of every file of the mount, never their
+	// contents. It is signed when the provider has a manifest signing key.
+	EmitManifest string
+	// GateAnnotation, "key" or "key=value", holds back the secrets of the
+	// mount until the pod carries the annotation, e.g. for staged rollouts.
+	// Until then each secret is replaced by its Placeholder or skipped.
+	GateAnnotation string
+	// RequireFresh fetches every secret from Secret Manager, never serving
+	// it from the provider cache, so a failed fetch fails the mount. The
+	// fresh payloads still refresh the cache.
+	RequireFresh bool
+	// SELinuxContext is the SELinux context, e.g.
+	// "system_u:object_r:container_file_t:s0", applied to the mount so the
+	// secret files written to it inherit the context.
+	SELinuxContext string
+	// Labels tag the metrics and logs of the mount, e.g. with the owning
+	// team for cost attribution.
+	Labels map[string]string
+}
+
+// TLSPair binds the secrets holding a certificate chain and its private key,
+// both PEM encoded, by their ResourceName.
+type TLSPair struct {
+	Cert string `json:"cert" yaml:"cert"`
+	Key  string `json:"key" yaml:"key"`
 }
 
 // MountParams hold unparsed arguments from the CSI Driver from the mount event.
@@ -98,12 +350,42 @@ type MountParams struct {
 	Permissions os.FileMode
 }
 
-// PathString returns either the FileName or Path parameter of the Secret.
+// PathString returns either the FileName or Path parameter of the Secret,
+// prefixed with SubPath when set.
 func (s *Secret) PathString() string {
+	p := s.FileName
 	if s.Path != "" {
-		return s.Path
+		p = s.Path
+	}
+	if s.SubPath != "" {
+		return path.Join(s.SubPath, p)
+	}
+	return p
+}
+
+// Identity describes the credentials used for the mount for auditing. It
+// returns the auth mode and, where it is known without any remote calls, the
+// principal. No secret material is included.
+func (c *MountConfig) Identity() (mode, principal string) {
+	switch {
+	case c.AuthNodePublishSecret:
+		var key struct {
+			ClientEmail string `json:"client_email"`
+		}
+		// The principal is best effort, the key itself is validated when the
+		// token source is built.
+		_ = json.Unmarshal(c.AuthKubeSecret, &key)
+		return "nodePublishSecretRef", key.ClientEmail
+	case c.AuthProviderADC:
+		return "provider-adc", ""
+	case c.AuthPodADC:
+		if c.PodInfo == nil {
+			return "pod-adc", ""
+		}
+		return "pod-adc", fmt.Sprintf("%s/%s", c.PodInfo.Namespace, c.PodInfo.ServiceAccount)
+	default:
+		return "none", ""
 	}
-	return s.FileName
 }
 
 // DecodeContent decodes the secret content based on the specified encoding
@@ -112,16 +394,260 @@ func (s *Secret) DecodeContent(content []byte) ([]byte, error) {
 		return content, nil
 	}
 
-	switch s.Encoding {
-	case "base64":
+	decode, ok := decoders[s.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding type: %s", s.Encoding)
+	}
+	return decode(content)
+}
+
+// EncodeContent encodes the content of a file of the secret based on
+// EncodeOnWrite.
+func (s *Secret) EncodeContent(content []byte) ([]byte, error) {
+	if s.EncodeOnWrite == "" {
+		return content, nil
+	}
+	encode, ok := encoders[s.EncodeOnWrite]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encodeOnWrite type: %s", s.EncodeOnWrite)
+	}
+	return encode(content), nil
+}
+
+// TranscodeContent converts the content from the SourceCharset of the secret
+// to UTF-8.
+func (s *Secret) TranscodeContent(content []byte) ([]byte, error) {
+	if s.SourceCharset == "" {
+		return content, nil
+	}
+	enc, err := charset(s.SourceCharset)
+	if err != nil {
+		return nil, err
+	}
+	out, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcode %s content: %v", s.SourceCharset, err)
+	}
+	// Decoders replace invalid byte sequences instead of failing.
+	if bytes.ContainsRune(out, utf8.RuneError) {
+		return nil, fmt.Errorf("failed to transcode %s content: invalid byte sequence", s.SourceCharset)
+	}
+	return out, nil
+}
+
+// charset returns the encoding registered under the IANA name.
+func charset(name string) (encoding.Encoding, error) {
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported charset: %s", name)
+	}
+	return enc, nil
+}
+
+// envKeyRegexp matches the variable names accepted for Secret.EnvKey.
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// decoders maps the values of Secret.Encoding to their implementation.
+var decoders = map[string]func(content []byte) ([]byte, error){
+	"base64": func(content []byte) ([]byte, error) {
 		decoded, err := base64.StdEncoding.DecodeString(string(content))
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode base64 content: %v", err)
 		}
 		return decoded, nil
-	default:
-		return nil, fmt.Errorf("unsupported encoding type: %s", s.Encoding)
+	},
+}
+
+// encoders maps the values of Secret.EncodeOnWrite to their implementation.
+var encoders = map[string]func(content []byte) []byte{
+	"base64": func(content []byte) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(content))
+	},
+}
+
+// Encodings returns the sorted names of the supported secret encodings.
+func Encodings() []string {
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SecretOptions returns the sorted keys accepted by entries of the "secrets"
+// parameter.
+func SecretOptions() []string {
+	t := reflect.TypeOf(Secret{})
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseSecrets parses the YAML list of secrets from the "secrets" parameter of
+// a SecretProviderClass. The whole parameter, or individual entries of the
+// list, may be an "@<file>" reference to a YAML list of secrets in the
+// directory set by the SECRET_LIST_DIR environment variable.
+func ParseSecrets(in []byte) ([]*Secret, error) {
+	out := make([]*Secret, 0)
+	if ref, ok := strings.CutPrefix(strings.TrimSpace(string(in)), "@"); ok {
+		list, err := loadSecretList(ref)
+		if err != nil {
+			return nil, err
+		}
+		out = list
+	} else {
+		var entries []yaml.Node
+		if err := yaml.Unmarshal(in, &entries); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal secrets attribute: %v", err)
+		}
+		for _, entry := range entries {
+			if ref, ok := strings.CutPrefix(entry.Value, "@"); ok && entry.Kind == yaml.ScalarNode {
+				list, err := loadSecretList(ref)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, list...)
+				continue
+			}
+			s := &Secret{}
+			if err := entry.Decode(s); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal secrets attribute: %v", err)
+			}
+			out = append(out, s)
+		}
+	}
+	for _, s := range out {
+		if s.ResolveAttempts < 0 || s.PayloadAttempts < 0 {
+			return nil, fmt.Errorf("invalid attempts for secret %s: resolveAttempts and payloadAttempts must not be negative", s.ResourceName)
+		}
+		if s.EncodeOnWrite != "" {
+			if _, ok := encoders[s.EncodeOnWrite]; !ok {
+				return nil, fmt.Errorf("unsupported encodeOnWrite for secret %s: %s", s.ResourceName, s.EncodeOnWrite)
+			}
+			if s.Encoding != "" || s.JSONKey != "" {
+				return nil, fmt.Errorf("secret %s can not combine encodeOnWrite with encoding or jsonKey", s.ResourceName)
+			}
+		}
+		if len(s.AdditionalPaths) > 0 && (s.SplitDelimiter != "" || s.JSONKey != "") {
+			return nil, fmt.Errorf("secret %s can not combine additionalPaths with splitDelimiter or jsonKey", s.ResourceName)
+		}
+		switch s.ExtractEnvKeyCase {
+		case "", "upper", "lower":
+		default:
+			return nil, fmt.Errorf("unsupported extractEnvKeyCase for secret %s: %s", s.ResourceName, s.ExtractEnvKeyCase)
+		}
+		if s.PrettyJSON && !s.NormalizeJSON {
+			return nil, fmt.Errorf("secret %s can not set prettyJSON without normalizeJSON", s.ResourceName)
+		}
+		if s.ImpersonateServiceAccount != "" && !strings.Contains(s.ImpersonateServiceAccount, "@") {
+			return nil, fmt.Errorf("invalid impersonateServiceAccount for secret %s: %q is not a service account email", s.ResourceName, s.ImpersonateServiceAccount)
+		}
+		if s.PreviousVersions < 0 {
+			return nil, fmt.Errorf("invalid previousVersions for secret %s: must not be negative", s.ResourceName)
+		}
+		if s.PreviousVersions > 0 && (s.JSONKey != "" || s.SplitDelimiter != "") {
+			return nil, fmt.Errorf("secret %s can not combine previousVersions with splitDelimiter or jsonKey", s.ResourceName)
+		}
+		if s.PreviousVersionsCreatedAfter != "" {
+			if s.PreviousVersions == 0 {
+				return nil, fmt.Errorf("secret %s sets previousVersionsCreatedAfter without previousVersions", s.ResourceName)
+			}
+			if _, err := time.Parse(time.RFC3339, s.PreviousVersionsCreatedAfter); err != nil {
+				return nil, fmt.Errorf("invalid previousVersionsCreatedAfter for secret %s: %v", s.ResourceName, err)
+			}
+		}
+		if s.MinVersion < 0 {
+			return nil, fmt.Errorf("invalid minVersion for secret %s: must not be negative", s.ResourceName)
+		}
+		for _, p := range s.FallbackProjects {
+			if p == "" || strings.Contains(p, "/") {
+				return nil, fmt.Errorf("invalid fallbackProjects for secret %s: %q is not a project id", s.ResourceName, p)
+			}
+		}
+		if s.FileNameFrom != "" {
+			if s.FileName != "" || s.Path != "" {
+				return nil, fmt.Errorf("secret %s can not combine fileNameFrom with fileName or path", s.ResourceName)
+			}
+			if key, ok := strings.CutPrefix(s.FileNameFrom, "label:"); s.FileNameFrom != "secretId" && (!ok || key == "") {
+				return nil, fmt.Errorf("invalid fileNameFrom for secret %s: must be \"secretId\" or \"label:<key>\", got %q", s.ResourceName, s.FileNameFrom)
+			}
+			// Names are derived once the pod passes the gate, placeholders
+			// are written before.
+			if s.Placeholder != "" {
+				return nil, fmt.Errorf("secret %s can not combine fileNameFrom with a placeholder", s.ResourceName)
+			}
+		}
+		if len(s.ReplicaLocations) > 0 && !strings.Contains(s.ResourceName, "/locations/") {
+			return nil, fmt.Errorf("secret %s can not use replicaLocations: it is not a regional secret", s.ResourceName)
+		}
+		for _, l := range s.ReplicaLocations {
+			if l == "" || strings.Contains(l, "/") {
+				return nil, fmt.Errorf("invalid replicaLocations for secret %s: %q is not a location", s.ResourceName, l)
+			}
+		}
+		if s.SourceCharset != "" {
+			if _, err := charset(s.SourceCharset); err != nil {
+				return nil, fmt.Errorf("invalid sourceCharset for secret %s: %v", s.ResourceName, err)
+			}
+		}
+		if s.TrailingSeparator && s.SplitDelimiter == "" && len(s.ExtractEnvKeys) == 0 {
+			return nil, fmt.Errorf("secret %s sets trailingSeparator without splitDelimiter or extractEnvKeys", s.ResourceName)
+		}
+		if s.SplitDelimiter != "" && (s.Transform != "" || s.JSONKey != "") {
+			return nil, fmt.Errorf("secret %s can not combine splitDelimiter with a transform or jsonKey", s.ResourceName)
+		}
+		if s.ValidateRegex == "" {
+			continue
+		}
+		if _, err := regexp.Compile(s.ValidateRegex); err != nil {
+			return nil, fmt.Errorf("invalid validateRegex for secret %s: %v", s.ResourceName, err)
+		}
+	}
+	return out, nil
+}
+
+// loadSecretList reads the YAML list of secrets referenced by name from
+// SECRET_LIST_DIR. References may not leave the directory and referenced
+// lists may not contain further references.
+func loadSecretList(name string) ([]*Secret, error) {
+	dir, err := vars.SecretListDir.GetValue()
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("secret list reference %q is not allowed, SECRET_LIST_DIR is not set", name)
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("secret list reference %q must be a relative path within SECRET_LIST_DIR", name)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve SECRET_LIST_DIR: %v", err)
+	}
+	p, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret list %q: %v", name, err)
 	}
+	if rel, err := filepath.Rel(root, p); err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("secret list reference %q resolves outside SECRET_LIST_DIR", name)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret list %q: %v", name, err)
+	}
+	out := make([]*Secret, 0)
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret list %q: %v", name, err)
+	}
+	return out, nil
 }
 
 // Parse parses the input MountParams to the more structured MountConfig.
@@ -209,12 +735,108 @@ func Parse(in *MountParams) (*MountConfig, error) {
 	klog.V(5).InfoS(fmt.Sprintf("filePermission: %v", in.Permissions), "pod", podInfo)
 	klog.V(5).InfoS(fmt.Sprintf("targetPath: %v", in.TargetPath), "pod", podInfo)
 
+	if v, ok := attrib[attributeStripBOM]; ok {
+		stripBOM, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s attribute: %v", attributeStripBOM, err)
+		}
+		out.StripBOM = stripBOM
+	}
+
+	if v, ok := attrib[attributeRequireFresh]; ok {
+		requireFresh, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s attribute: %v", attributeRequireFresh, err)
+		}
+		out.RequireFresh = requireFresh
+	}
+
+	if v, ok := attrib[attributeLabels]; ok {
+		if err := yaml.Unmarshal([]byte(v), &out.Labels); err != nil {
+			return nil, fmt.Errorf("failed to parse %s attribute: %v", attributeLabels, err)
+		}
+	}
+
 	if _, ok := attrib["secrets"]; !ok {
 		return nil, errors.New("missing required 'secrets' attribute")
 	}
-	if err := yaml.Unmarshal([]byte(attrib["secrets"]), &out.Secrets); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal secrets attribute: %v", err)
+	out.Secrets, err = ParseSecrets([]byte(attrib["secrets"]))
+	if err != nil {
+		return nil, err
+	}
+
+	out.CombineIntoJSON = attrib[attributeCombineIntoJSON]
+	out.SELinuxContext = attrib[attributeSELinuxContext]
+	out.EmitManifest = attrib[attributeEmitManifest]
+	out.GateAnnotation = attrib[attributeGateAnnotation]
+	out.EmitEnvFile = attrib[attributeEmitEnvFile]
+	keys := make(map[string]bool)
+	for _, s := range out.Secrets {
+		if s.JSONKey == "" {
+			continue
+		}
+		if out.CombineIntoJSON == "" {
+			return nil, fmt.Errorf("secret %s has a jsonKey but the %s attribute is not set", s.ResourceName, attributeCombineIntoJSON)
+		}
+		if s.Transform != "" {
+			return nil, fmt.Errorf("secret %s can not have both a jsonKey and a transform", s.ResourceName)
+		}
+		if keys[s.JSONKey] {
+			return nil, fmt.Errorf("jsonKey %q is used by more than one secret", s.JSONKey)
+		}
+		keys[s.JSONKey] = true
+	}
+
+	envKeys := make(map[string]bool)
+	for _, s := range out.Secrets {
+		if s.EnvKey == "" {
+			continue
+		}
+		if out.EmitEnvFile == "" {
+			return nil, fmt.Errorf("secret %s has an envKey but the %s attribute is not set", s.ResourceName, attributeEmitEnvFile)
+		}
+		if !envKeyRegexp.MatchString(s.EnvKey) {
+			return nil, fmt.Errorf("invalid envKey %q for secret %s: must be letters, digits and underscores, not starting with a digit", s.EnvKey, s.ResourceName)
+		}
+		if s.Transform != "" || s.JSONKey != "" || s.SplitDelimiter != "" {
+			return nil, fmt.Errorf("secret %s can not combine an envKey with a transform, jsonKey or splitDelimiter", s.ResourceName)
+		}
+		if envKeys[s.EnvKey] {
+			return nil, fmt.Errorf("envKey %q is used by more than one secret", s.EnvKey)
+		}
+		envKeys[s.EnvKey] = true
+	}
+
+	if v, ok := attrib[attributeEmitTLSPair]; ok {
+		out.EmitTLSPair = &TLSPair{}
+		if err := yaml.Unmarshal([]byte(v), out.EmitTLSPair); err != nil {
+			return nil, fmt.Errorf("failed to parse %s attribute: %v", attributeEmitTLSPair, err)
+		}
+		if err := out.EmitTLSPair.validate(out.Secrets); err != nil {
+			return nil, fmt.Errorf("invalid %s attribute: %v", attributeEmitTLSPair, err)
+		}
 	}
 
 	return out, nil
 }
+
+// validate checks that the pair binds two distinct secrets of the mount that
+// are not combined into JSON.
+func (p *TLSPair) validate(secrets []*Secret) error {
+	if p.Cert == "" || p.Key == "" {
+		return errors.New("both cert and key must be set")
+	}
+	if p.Cert == p.Key {
+		return errors.New("cert and key must be different secrets")
+	}
+	for _, name := range []string{p.Cert, p.Key} {
+		i := slices.IndexFunc(secrets, func(s *Secret) bool { return s.ResourceName == name })
+		if i < 0 {
+			return fmt.Errorf("secret %s is not mounted", name)
+		}
+		if secrets[i].JSONKey != "" {
+			return fmt.Errorf("secret %s can not have a jsonKey", name)
+		}
+	}
+	return nil
+}
@@ -15,6 +15,10 @@
 package config
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -278,6 +282,82 @@ func TestParse(t *testing.T) {
 				AuthPodADC:  true,
 			},
 		},
+		{
+			name: "strip bom mount default",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"stripBOM": "true",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/secrets/test/versions/latest",
+						FileName:     "good1.txt",
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+				AuthPodADC:  true,
+				StripBOM:    true,
+			},
+		},
+		{
+			name: "mount labels, require fresh and gate",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"labels": "team: payments\napp: checkout\n",
+					"requireFresh": "true",
+					"gateAnnotation": "rollout.example.com/secrets",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+			want: &MountConfig{
+				Secrets: []*Secret{
+					{
+						ResourceName: "projects/project/secrets/test/versions/latest",
+						FileName:     "good1.txt",
+					},
+				},
+				PodInfo: &PodInfo{
+					Namespace:      "default",
+					Name:           "mypod",
+					UID:            "123",
+					ServiceAccount: "mysa",
+				},
+				TargetPath:     "/tmp/foo",
+				Permissions:    777,
+				AuthPodADC:     true,
+				Labels:         map[string]string{"team": "payments", "app": "checkout"},
+				RequireFresh:   true,
+				GateAnnotation: "rollout.example.com/secrets",
+			},
+		},
 	}
 	t.Setenv("ALLOW_NODE_PUBLISH_SECRET", "true")
 	for _, tc := range tests {
@@ -399,6 +479,419 @@ func TestParseErrors(t *testing.T) {
 				Permissions: 777,
 			},
 		},
+		{
+			name: "unparsable stripBOM",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n",
+					"stripBOM": "maybe",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "invalid validateRegex",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  validateRegex: \"^key-[0-9+$\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "splitDelimiter with transform",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  splitDelimiter: \",\"\n  transform: \"pem-to-jwk\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "invalid fallbackProjects",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  fallbackProjects: [\"projects/dr\"]\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "encodeOnWrite with encoding",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  encodeOnWrite: \"base64\"\n  encoding: \"base64\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unknown encodeOnWrite",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  encodeOnWrite: \"hex\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "additionalPaths with splitDelimiter",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  splitDelimiter: \"---\"\n  additionalPaths: [\"copy.txt\"]\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "prettyJSON without normalizeJSON",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  prettyJSON: true\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "envKey without emitEnvFile",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  envKey: \"DB_USER\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "invalid envKey",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  envKey: \"1DB-USER\"\n",
+					"emitEnvFile": "app.env",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "replicaLocations on global secret",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  replicaLocations: [\"us-east1\"]\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "bad replicaLocations",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/locations/us-central1/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  replicaLocations: [\"us/east1\"]\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "fileNameFrom with fileName",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  fileNameFrom: \"secretId\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "bad fileNameFrom",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileNameFrom: \"label:\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "trailingSeparator without segments",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  trailingSeparator: true\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "bad previousVersionsCreatedAfter",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  previousVersions: 2\n  previousVersionsCreatedAfter: \"yesterday\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unsupported extractEnvKeyCase",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  extractEnvKeys: [\"a\"]\n  extractEnvKeyCase: \"title\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "fileNameFrom with placeholder",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileNameFrom: \"secretId\"\n  placeholder: \"pending\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "negative minVersion",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/latest\"\n  fileName: \"good1.txt\"\n  minVersion: -1\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "unknown sourceCharset",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"good1.txt\"\n  sourceCharset: \"klingon\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "jsonKey without combineIntoJSON",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  jsonKey: \"test\"\n",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "duplicate jsonKey",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/a/versions/1\"\n  jsonKey: \"test\"\n- resourceName: \"projects/project/secrets/b/versions/1\"\n  jsonKey: \"test\"\n",
+					"combineIntoJSON": "combined.json",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "emitTLSPair without key",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/cert/versions/1\"\n  fileName: \"cert.pem\"\n- resourceName: \"projects/project/secrets/key/versions/1\"\n  fileName: \"key.pem\"\n",
+					"emitTLSPair": "cert: projects/project/secrets/cert/versions/1",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
+		{
+			name: "emitTLSPair with unmounted secret",
+			in: &MountParams{
+				Attributes: `
+				{
+					"secrets": "- resourceName: \"projects/project/secrets/cert/versions/1\"\n  fileName: \"cert.pem\"\n- resourceName: \"projects/project/secrets/key/versions/1\"\n  fileName: \"key.pem\"\n",
+					"emitTLSPair": "{cert: projects/project/secrets/cert/versions/1, key: projects/project/secrets/other/versions/1}",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}
+				`,
+				KubeSecrets: "{}",
+				TargetPath:  "/tmp/foo",
+				Permissions: 777,
+			},
+		},
 	}
 	t.Setenv("ALLOW_NODE_PUBLISH_SECRET", "true")
 	for _, tc := range tests {
@@ -502,3 +995,165 @@ func TestParseWithRestrictedNodePublishRef(t *testing.T) {
 func int32Ptr(i int32) *int32 {
 	return &i
 }
+
+func TestMountConfigIdentity(t *testing.T) {
+	podInfo := &PodInfo{Namespace: "default", Name: "mypod", ServiceAccount: "mysa"}
+	tests := []struct {
+		name          string
+		cfg           *MountConfig
+		wantMode      string
+		wantPrincipal string
+	}{
+		{
+			name:          "pod workload identity",
+			cfg:           &MountConfig{PodInfo: podInfo, AuthPodADC: true},
+			wantMode:      "pod-adc",
+			wantPrincipal: "default/mysa",
+		},
+		{
+			name:     "provider node identity",
+			cfg:      &MountConfig{PodInfo: podInfo, AuthProviderADC: true},
+			wantMode: "provider-adc",
+		},
+		{
+			name: "credentials file",
+			cfg: &MountConfig{
+				PodInfo:               podInfo,
+				AuthNodePublishSecret: true,
+				AuthKubeSecret:        []byte(`{"type": "service_account", "client_email": "sa@project.iam.gserviceaccount.com", "private_key": "a-secret"}`),
+			},
+			wantMode:      "nodePublishSecretRef",
+			wantPrincipal: "sa@project.iam.gserviceaccount.com",
+		},
+		{
+			name:     "no auth",
+			cfg:      &MountConfig{PodInfo: podInfo},
+			wantMode: "none",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mode, principal := tc.cfg.Identity()
+			if mode != tc.wantMode || principal != tc.wantPrincipal {
+				t.Errorf("Identity() = (%q, %q), want (%q, %q)", mode, principal, tc.wantMode, tc.wantPrincipal)
+			}
+			if strings.Contains(principal, "a-secret") {
+				t.Errorf("Identity() leaked key material: %q", principal)
+			}
+		})
+	}
+}
+
+func TestParseSecretsReference(t *testing.T) {
+	dir := t.TempDir()
+	list := "- resourceName: \"projects/project/secrets/a/versions/1\"\n  fileName: \"a.txt\"\n- resourceName: \"projects/project/secrets/b/versions/1\"\n  fileName: \"b.txt\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "list.yaml"), []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRET_LIST_DIR", dir)
+
+	tests := []struct {
+		name string
+		in   string
+		want []*Secret
+	}{
+		{
+			name: "whole list",
+			in:   "@list.yaml",
+			want: []*Secret{
+				{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt"},
+				{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt"},
+			},
+		},
+		{
+			name: "entry merged with inline secrets",
+			in:   "- resourceName: \"projects/project/secrets/c/versions/1\"\n  fileName: \"c.txt\"\n- \"@list.yaml\"\n",
+			want: []*Secret{
+				{ResourceName: "projects/project/secrets/c/versions/1", FileName: "c.txt"},
+				{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt"},
+				{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseSecrets([]byte(tc.in))
+			if err != nil {
+				t.Fatalf("ParseSecrets() got err = %v, want nil", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ParseSecrets() returned unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSecretsReferenceErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "malformed.yaml"), []byte("- resourceName: [unterminated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "outside.yaml")
+	if err := os.WriteFile(outside, []byte("[]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		in   string
+		want string
+	}{
+		{name: "malformed list", dir: dir, in: "@malformed.yaml", want: "failed to unmarshal secret list"},
+		{name: "missing file", dir: dir, in: "@missing.yaml", want: "failed to read secret list"},
+		{name: "traversal", dir: dir, in: "@../outside.yaml", want: "relative path"},
+		{name: "symlink escape", dir: dir, in: "- \"@link.yaml\"\n", want: "outside SECRET_LIST_DIR"},
+		{name: "references disabled", dir: "", in: "@malformed.yaml", want: "SECRET_LIST_DIR is not set"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SECRET_LIST_DIR", tc.dir)
+			_, err := ParseSecrets([]byte(tc.in))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseSecrets() got err = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestTranscodeContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		in      []byte
+		want    []byte
+		wantErr bool
+	}{
+		{name: "no charset", in: []byte("caf\xe9"), want: []byte("caf\xe9")},
+		{name: "latin-1", charset: "ISO-8859-1", in: []byte("caf\xe9 \xa3"), want: []byte("café £")},
+		{name: "latin-1 alias", charset: "latin1", in: []byte("\xfcber"), want: []byte("über")},
+		{name: "invalid shift_jis", charset: "Shift_JIS", in: []byte("\x81\x20"), wantErr: true},
+		{name: "unknown charset", charset: "klingon", in: []byte("x"), wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Secret{SourceCharset: tc.charset}
+			got, err := s.TranscodeContent(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("TranscodeContent() got err = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TranscodeContent() got err = %v", err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("TranscodeContent() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
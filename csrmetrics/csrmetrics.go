@@ -32,6 +32,29 @@ const (
 	OutboundRPCStatusOK       OutboundRPCStatus = "ok"
 )
 
+// SecretRequirement labels whether a mounted secret is required or optional.
+type SecretRequirement string
+
+// Requirement constants for secret metrics
+const (
+	SecretRequired SecretRequirement = "required"
+	SecretOptional SecretRequirement = "optional"
+)
+
+// SELinuxResult labels the outcome of applying an SELinux context to a mount.
+type SELinuxResult string
+
+// Results of applying an SELinux context
+const (
+	SELinuxApplied     SELinuxResult = "applied"
+	SELinuxUnsupported SELinuxResult = "unsupported"
+	SELinuxFailed      SELinuxResult = "error"
+)
+
+// MountLabelKeys are the mount labels copied onto mount metrics. Other labels
+// are only logged, bounding the cardinality of the metrics.
+var MountLabelKeys = []string{"team", "app", "owner"}
+
 var (
 	// Observation function to observe delay
 	// Update this method for unit tests
@@ -47,12 +70,78 @@ var (
 		Name: "outbound_rpc_latency",
 		Help: "Latency of outbound RPCs to GCP (in seconds)",
 	}, []string{"status", "kind"})
+
+	contentCompareCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_content_compare_count",
+		Help: "Count of mounted secret files compared against the content already on disk",
+	}, []string{"result"})
+
+	secretFailureCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_access_failure_count",
+		Help: "Count of secrets that failed to be fetched for a mount, optional failures are skipped",
+	}, []string{"requirement", "code"})
+
+	cacheCorruptionCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secret_cache_corruption_count",
+		Help: "Count of cached secrets discarded because they failed the integrity check",
+	})
+
+	scheduledDestroyWarningCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secret_scheduled_destroy_warning_count",
+		Help: "Count of mounted secret versions scheduled to be destroyed within the warning window",
+	})
+
+	staleServedCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secret_stale_served_count",
+		Help: "Count of expired cached secrets served because fetching them failed with a retryable error",
+	})
+
+	provenanceFailureCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_provenance_failure_count",
+		Help: "Count of secret provenance lookups that failed, by gRPC code",
+	}, []string{"code"})
+
+	versionDivergenceCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secret_version_divergence_count",
+		Help: "Count of secrets resolving to different versions across the locations of a mount",
+	})
+
+	selinuxLabelCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "selinux_label_count",
+		Help: "Count of SELinux contexts applied to mounts by result",
+	}, []string{"result"})
+
+	mountCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mount_event_count",
+		Help: "Count of mount events by result and allowlisted mount labels",
+	}, append([]string{"result"}, MountLabelKeys...))
+
+	mountsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mount_in_flight",
+		Help: "Number of mount events holding a slot of the mount concurrency limiter",
+	})
+
+	mountQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mount_queue_depth",
+		Help: "Number of mount events waiting for a slot of the mount concurrency limiter",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(
 		outboundRPCCount,
 		outboundRPCLatency,
+		contentCompareCount,
+		secretFailureCount,
+		cacheCorruptionCount,
+		scheduledDestroyWarningCount,
+		versionDivergenceCount,
+		staleServedCount,
+		provenanceFailureCount,
+		selinuxLabelCount,
+		mountCount,
+		mountsInFlight,
+		mountQueueDepth,
 	)
 }
 
@@ -67,3 +156,79 @@ func OutboundRPCStartRecorder(kind string) func(status OutboundRPCStatus) {
 		outboundRPCLatency.WithLabelValues(string(status), kind).Observe(timeSinceSeconds(start))
 	}
 }
+
+// RecordContentCompare records whether a mounted secret file changed compared
+// to the content already on disk.
+func RecordContentCompare(changed bool) {
+	result := "unchanged"
+	if changed {
+		result = "changed"
+	}
+	contentCompareCount.WithLabelValues(result).Inc()
+}
+
+// RecordSecretFailure records a secret that could not be fetched for a mount
+// with the gRPC code of the failure.
+func RecordSecretFailure(requirement SecretRequirement, code string) {
+	secretFailureCount.WithLabelValues(string(requirement), code).Inc()
+}
+
+// RecordCacheCorruption records a cache entry discarded because its checksum
+// no longer matched its contents.
+func RecordCacheCorruption() {
+	cacheCorruptionCount.Inc()
+}
+
+// RecordScheduledDestroyWarning records a mounted secret version that is
+// scheduled to be destroyed soon.
+func RecordScheduledDestroyWarning() {
+	scheduledDestroyWarningCount.Inc()
+}
+
+// RecordStaleServed records an expired cached secret served because fetching
+// it failed.
+func RecordStaleServed() {
+	staleServedCount.Inc()
+}
+
+// RecordProvenanceFailure records a failed provenance lookup with the gRPC
+// code of the failure.
+func RecordProvenanceFailure(code string) {
+	provenanceFailureCount.WithLabelValues(code).Inc()
+}
+
+// RecordVersionDivergence records a secret resolving to different versions
+// across the locations of a mount.
+func RecordVersionDivergence() {
+	versionDivergenceCount.Inc()
+}
+
+// RecordSELinuxLabel records the outcome of applying an SELinux context to a
+// mount.
+func RecordSELinuxLabel(result SELinuxResult) {
+	selinuxLabelCount.WithLabelValues(string(result)).Inc()
+}
+
+// RecordMount records the result of a mount event. Only the labels in
+// MountLabelKeys are recorded, missing ones are left empty.
+func RecordMount(labels map[string]string, ok bool) {
+	values := []string{"error"}
+	if ok {
+		values[0] = "ok"
+	}
+	for _, key := range MountLabelKeys {
+		values = append(values, labels[key])
+	}
+	mountCount.WithLabelValues(values...).Inc()
+}
+
+// AddMountsInFlight adjusts the number of mount events holding a limiter slot.
+func AddMountsInFlight(delta float64) {
+	mountsInFlight.Add(delta)
+}
+
+// AddMountsQueued adjusts the number of mount events waiting for a limiter
+// slot.
+func AddMountsQueued(delta float64) {
+	mountQueueDepth.Add(delta)
+}
@@ -206,3 +206,19 @@ func TestOutboundRPCStartRecorder(t *testing.T) {
 	}
 
 }
+
+func TestRecordMount(t *testing.T) {
+	RecordMount(map[string]string{"team": "payments", "cost-center": "1234"}, true)
+	RecordMount(map[string]string{"app": "checkout"}, false)
+
+	expected := `
+	# HELP mount_event_count Count of mount events by result and allowlisted mount labels
+	# TYPE mount_event_count counter
+	mount_event_count{app="",owner="",result="ok",team="payments"} 1
+	mount_event_count{app="checkout",owner="",result="error",team=""} 1
+	`
+
+	if err := testutil.CollectAndCompare(mountCount, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
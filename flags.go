@@ -0,0 +1,249 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/server"
+)
+
+// startupFlags holds the flag values checked by validateFlags.
+type startupFlags struct {
+	metricsAddr           string
+	enableProfile         bool
+	debugAddr             string
+	smConnectionPoolSize  int
+	iamConnectionPoolSize int
+	retryMaxAttempts      int
+	retryBackoff          time.Duration
+	regionRetryPolicies   string
+	fetchTimeout          time.Duration
+	mountMaxRetryDuration time.Duration
+	regionTimeouts        string
+	selfTest              bool
+	selfTestSecrets       string
+	validateSecrets       string
+	cacheTTL              time.Duration
+	serveStaleOnError     bool
+	cacheCoalesce         bool
+	maxStale              time.Duration
+	maxConcurrentMounts   int
+	maxSecretsPerMount    int
+	maxRecvMsgSize        int
+	adaptiveMin           int
+	adaptiveMax           int
+	mountOverflowPolicy   string
+	warmUpRegions         string
+	warmUpProbe           bool
+	logSuppressCodes      string
+	destroyWarningWindow  time.Duration
+	responseOrder         string
+	grpcCompression       string
+	mountErrorFormat      string
+	allowedEncodings      string
+	allowedTransforms     string
+	maxListedVersions     int
+	tokenRefreshWindow    time.Duration
+	fileNameSanitization  string
+	mountCallBudget       int
+	readyErrorThreshold   float64
+	readyErrorWindow      time.Duration
+}
+
+// currentFlags returns the parsed command line flags.
+func currentFlags() startupFlags {
+	return startupFlags{
+		metricsAddr:           *metricsAddr,
+		enableProfile:         *enableProfile,
+		debugAddr:             *debugAddr,
+		smConnectionPoolSize:  *smConnectionPoolSize,
+		iamConnectionPoolSize: *iamConnectionPoolSize,
+		retryMaxAttempts:      *retryMaxAttempts,
+		retryBackoff:          *retryBackoff,
+		regionRetryPolicies:   *regionRetryPolicies,
+		fetchTimeout:          *fetchTimeout,
+		mountMaxRetryDuration: *mountMaxRetryDuration,
+		regionTimeouts:        *regionTimeouts,
+		selfTest:              *selfTest,
+		selfTestSecrets:       *selfTestSecrets,
+		validateSecrets:       *validateSecrets,
+		cacheTTL:              *cacheTTL,
+		serveStaleOnError:     *serveStaleOnError,
+		cacheCoalesce:         *cacheCoalesce,
+		maxStale:              *maxStale,
+		maxConcurrentMounts:   *maxConcurrentMounts,
+		maxSecretsPerMount:    *maxSecretsPerMount,
+		maxRecvMsgSize:        *maxRecvMsgSize,
+		adaptiveMin:           *adaptiveConcurrencyMin,
+		adaptiveMax:           *adaptiveConcurrencyMax,
+		mountOverflowPolicy:   *mountOverflowPolicy,
+		warmUpRegions:         *warmUpRegions,
+		warmUpProbe:           *warmUpProbe,
+		logSuppressCodes:      *logSuppressCodes,
+		destroyWarningWindow:  *destroyWarningWindow,
+		responseOrder:         *responseOrder,
+		grpcCompression:       *grpcCompression,
+		mountErrorFormat:      *mountErrorFormat,
+		allowedEncodings:      *allowedEncodings,
+		allowedTransforms:     *allowedTransforms,
+		maxListedVersions:     *maxListedVersions,
+		tokenRefreshWindow:    *tokenRefreshWindow,
+		fileNameSanitization:  *fileNameSanitization,
+		mountCallBudget:       *mountCallBudget,
+		readyErrorThreshold:   *readyErrorThreshold,
+		readyErrorWindow:      *readyErrorWindow,
+	}
+}
+
+// validateFlags checks the flag values and their combinations so that the
+// provider does not start in a broken state. All problems are reported
+// together.
+func validateFlags(f startupFlags) error {
+	var errs []error
+	add := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	if _, _, err := net.SplitHostPort(f.metricsAddr); err != nil {
+		add("-metrics_addr %q is not a valid listen address: %v", f.metricsAddr, err)
+	}
+	if f.enableProfile {
+		if _, _, err := net.SplitHostPort(f.debugAddr); err != nil {
+			add("-debug_addr %q is not a valid listen address: %v", f.debugAddr, err)
+		}
+	}
+	if f.smConnectionPoolSize <= 0 {
+		add("-sm_connection_pool_size must be positive, got %d", f.smConnectionPoolSize)
+	}
+	if f.iamConnectionPoolSize <= 0 {
+		add("-iam_connection_pool_size must be positive, got %d", f.iamConnectionPoolSize)
+	}
+	if f.retryMaxAttempts < 0 {
+		add("-retry-max-attempts must not be negative, got %d", f.retryMaxAttempts)
+	}
+	if f.retryMaxAttempts > 0 && f.retryBackoff <= 0 {
+		add("-retry-backoff must be positive when -retry-max-attempts is set, got %v", f.retryBackoff)
+	}
+	if _, err := server.ParseRetryPolicies(f.regionRetryPolicies); err != nil {
+		add("-region-retry-policies: %v", err)
+	}
+	if _, err := server.ParseLocationTimeouts(f.regionTimeouts); err != nil {
+		add("-region-timeouts: %v", err)
+	}
+	if f.mountMaxRetryDuration < 0 {
+		add("-mount-max-retry-duration must not be negative, got %v", f.mountMaxRetryDuration)
+	}
+	if f.fetchTimeout < 0 {
+		add("-fetch-timeout must not be negative, got %v", f.fetchTimeout)
+	}
+	if _, err := server.ParseLogSuppressCodes(f.logSuppressCodes); err != nil {
+		add("-log-suppress-codes: %v", err)
+	}
+	if f.selfTest && f.selfTestSecrets == "" {
+		add("-selftest requires -selftest-secrets")
+	}
+	if f.selfTest && f.validateSecrets != "" {
+		add("-selftest and -validate-secrets are mutually exclusive")
+	}
+	if f.cacheTTL < 0 {
+		add("-cache-ttl must not be negative, got %v", f.cacheTTL)
+	}
+	if f.serveStaleOnError && f.cacheTTL <= 0 {
+		add("-serve-stale-on-error requires -cache-ttl")
+	}
+	if f.cacheCoalesce && f.cacheTTL <= 0 {
+		add("-cache-coalesce requires -cache-ttl")
+	}
+	if f.maxListedVersions < 0 {
+		add("-max-listed-versions must not be negative, got %d", f.maxListedVersions)
+	}
+	if f.readyErrorThreshold < 0 || f.readyErrorThreshold > 1 {
+		add("-ready-error-threshold must be between 0 and 1, got %v", f.readyErrorThreshold)
+	}
+	if f.readyErrorThreshold > 0 && f.readyErrorWindow <= 0 {
+		add("-ready-error-window must be positive with -ready-error-threshold, got %v", f.readyErrorWindow)
+	}
+	if f.mountCallBudget < 0 {
+		add("-mount-call-budget must not be negative, got %d", f.mountCallBudget)
+	}
+	if f.tokenRefreshWindow < 0 {
+		add("-token-refresh-window must not be negative, got %v", f.tokenRefreshWindow)
+	}
+	if f.maxStale < 0 {
+		add("-max-stale must not be negative, got %v", f.maxStale)
+	}
+	if f.destroyWarningWindow < 0 {
+		add("-destroy-warning-window must not be negative, got %v", f.destroyWarningWindow)
+	}
+	if f.maxConcurrentMounts < 0 {
+		add("-max-concurrent-mounts must not be negative, got %d", f.maxConcurrentMounts)
+	}
+	if f.maxSecretsPerMount < 0 {
+		add("-max-secrets-per-mount must not be negative, got %d", f.maxSecretsPerMount)
+	}
+	if f.maxRecvMsgSize < 0 {
+		add("-max-recv-msg-size must not be negative, got %d", f.maxRecvMsgSize)
+	}
+	if f.adaptiveMax < 0 {
+		add("-adaptive-concurrency-max must not be negative, got %d", f.adaptiveMax)
+	}
+	if f.adaptiveMax > 0 && (f.adaptiveMin <= 0 || f.adaptiveMin > f.adaptiveMax) {
+		add("-adaptive-concurrency-min must be between 1 and -adaptive-concurrency-max, got %d", f.adaptiveMin)
+	}
+	if f.mountOverflowPolicy != server.OverflowQueue && f.mountOverflowPolicy != server.OverflowReject {
+		add("-mount-overflow-policy must be %q or %q, got %q", server.OverflowQueue, server.OverflowReject, f.mountOverflowPolicy)
+	}
+	switch f.responseOrder {
+	case server.OrderConfig, server.OrderPath, server.OrderResourceName:
+	default:
+		add("-response-order must be %q, %q or %q, got %q", server.OrderConfig, server.OrderPath, server.OrderResourceName, f.responseOrder)
+	}
+	if f.fileNameSanitization != server.FileNameReject && f.fileNameSanitization != server.FileNameReplace {
+		add("-file-name-sanitization must be %q or %q, got %q", server.FileNameReject, server.FileNameReplace, f.fileNameSanitization)
+	}
+	if f.mountErrorFormat != server.ErrorFormatText && f.mountErrorFormat != server.ErrorFormatJSON {
+		add("-mount-error-format must be %q or %q, got %q", server.ErrorFormatText, server.ErrorFormatJSON, f.mountErrorFormat)
+	}
+	capabilities := server.NewCapabilities("")
+	for _, e := range server.ParseList(f.allowedEncodings) {
+		if !slices.Contains(capabilities.Encodings, e) {
+			add("-allowed-encodings contains unknown encoding %q, known encodings are %v", e, capabilities.Encodings)
+		}
+	}
+	for _, t := range server.ParseList(f.allowedTransforms) {
+		if !slices.Contains(capabilities.Transforms, t) {
+			add("-allowed-transforms contains unknown transform %q, known transforms are %v", t, capabilities.Transforms)
+		}
+	}
+	if f.grpcCompression != server.CompressionNone && f.grpcCompression != server.CompressionGzip {
+		add("-grpc-compression must be %q or %q, got %q", server.CompressionNone, server.CompressionGzip, f.grpcCompression)
+	}
+	if f.warmUpProbe && f.warmUpRegions == "" {
+		add("-warmup-probe requires -warmup-regions")
+	}
+	for _, loc := range server.ParseList(f.warmUpRegions) {
+		if strings.ContainsAny(loc, "/: ") {
+			add("-warmup-regions contains invalid region %q", loc)
+		}
+	}
+
+	return errors.Join(errs...)
+}
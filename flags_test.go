@@ -0,0 +1,168 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validFlags() startupFlags {
+	return startupFlags{
+		metricsAddr:           ":8095",
+		debugAddr:             "localhost:6060",
+		smConnectionPoolSize:  5,
+		iamConnectionPoolSize: 5,
+		retryBackoff:          time.Second,
+		mountOverflowPolicy:   "queue",
+		responseOrder:         "config-order",
+		grpcCompression:       "none",
+		mountErrorFormat:      "text",
+		fileNameSanitization:  "reject",
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	if err := validateFlags(validFlags()); err != nil {
+		t.Errorf("validateFlags() got err = %v, want nil for defaults", err)
+	}
+
+	f := validFlags()
+	f.warmUpRegions = "us-central1, europe-west1,"
+	if err := validateFlags(f); err != nil {
+		t.Errorf("validateFlags() got err = %v, want nil for a spaced region list", err)
+	}
+}
+
+func TestValidateFlagsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(f *startupFlags)
+		want   []string
+	}{
+		{
+			name: "bad metrics address",
+			modify: func(f *startupFlags) {
+				f.metricsAddr = "8095"
+			},
+			want: []string{"-metrics_addr"},
+		},
+		{
+			name: "retry attempts without backoff",
+			modify: func(f *startupFlags) {
+				f.retryMaxAttempts = 3
+				f.retryBackoff = 0
+			},
+			want: []string{"-retry-backoff"},
+		},
+		{
+			name: "selftest without secrets and with validate",
+			modify: func(f *startupFlags) {
+				f.selfTest = true
+				f.validateSecrets = "/tmp/secrets.yaml"
+			},
+			want: []string{"-selftest requires -selftest-secrets", "mutually exclusive"},
+		},
+		{
+			name: "negative durations and counts",
+			modify: func(f *startupFlags) {
+				f.cacheTTL = -time.Minute
+				f.maxConcurrentMounts = -1
+				f.smConnectionPoolSize = 0
+				f.maxSecretsPerMount = -1
+				f.destroyWarningWindow = -time.Hour
+				f.maxRecvMsgSize = -1
+				f.fetchTimeout = -time.Second
+				f.mountMaxRetryDuration = -time.Second
+				f.maxStale = -time.Minute
+				f.maxListedVersions = -1
+				f.tokenRefreshWindow = -time.Minute
+				f.mountCallBudget = -1
+				f.readyErrorThreshold = 1.5
+			},
+			want: []string{"-max-listed-versions", "-ready-error-threshold", "-mount-call-budget", "-token-refresh-window", "-max-stale", "-mount-max-retry-duration", "-cache-ttl", "-max-concurrent-mounts", "-sm_connection_pool_size", "-max-secrets-per-mount", "-destroy-warning-window", "-max-recv-msg-size", "-fetch-timeout"},
+		},
+		{
+			name: "ready threshold without window",
+			modify: func(f *startupFlags) {
+				f.readyErrorThreshold = 0.5
+				f.readyErrorWindow = 0
+			},
+			want: []string{"-ready-error-window must be positive"},
+		},
+		{
+			name: "cache options without cache",
+			modify: func(f *startupFlags) {
+				f.serveStaleOnError = true
+				f.cacheCoalesce = true
+			},
+			want: []string{"-serve-stale-on-error requires -cache-ttl", "-cache-coalesce requires -cache-ttl"},
+		},
+		{
+			name: "bad policies",
+			modify: func(f *startupFlags) {
+				f.regionRetryPolicies = "us-central1=five"
+				f.mountOverflowPolicy = "drop"
+				f.logSuppressCodes = "NotFound,Missing"
+				f.responseOrder = "random"
+				f.grpcCompression = "zstd"
+				f.regionTimeouts = "us-central1=soon"
+				f.mountErrorFormat = "xml"
+				f.fileNameSanitization = "strip"
+				f.allowedEncodings = "base64,rot13"
+				f.allowedTransforms = "pkcs12-extract,unzip"
+			},
+			want: []string{"-allowed-encodings contains unknown encoding \"rot13\"", "-allowed-transforms contains unknown transform \"unzip\"", "-file-name-sanitization", "-mount-error-format", "-region-retry-policies", "-region-timeouts", "-mount-overflow-policy", "-log-suppress-codes", "-response-order", "-grpc-compression"},
+		},
+		{
+			name: "adaptive min above max",
+			modify: func(f *startupFlags) {
+				f.adaptiveMin = 10
+				f.adaptiveMax = 5
+			},
+			want: []string{"-adaptive-concurrency-min"},
+		},
+		{
+			name: "probe without regions",
+			modify: func(f *startupFlags) {
+				f.warmUpProbe = true
+			},
+			want: []string{"-warmup-probe"},
+		},
+		{
+			name: "bad warm-up region",
+			modify: func(f *startupFlags) {
+				f.warmUpRegions = "us-central1,projects/p"
+			},
+			want: []string{"-warmup-regions"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := validFlags()
+			tc.modify(&f)
+			err := validateFlags(f)
+			if err == nil {
+				t.Fatalf("validateFlags() got err = nil, want error")
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("validateFlags() error %q does not mention %q", err, w)
+				}
+			}
+		})
+	}
+}
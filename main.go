@@ -18,7 +18,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net"
@@ -34,14 +37,17 @@ import (
 	iam "cloud.google.com/go/iam/credentials/apiv1"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/auth"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/infra"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/server"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/vars"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -53,14 +59,69 @@ import (
 )
 
 var (
-	kubeconfig            = flag.String("kubeconfig", "", "absolute path to kubeconfig file")
-	logFormatJSON         = flag.Bool("log-format-json", true, "set log formatter to json")
-	metricsAddr           = flag.String("metrics_addr", ":8095", "configure http listener for reporting metrics")
-	enableProfile         = flag.Bool("enable-pprof", false, "enable pprof profiling")
-	debugAddr             = flag.String("debug_addr", "localhost:6060", "port for pprof profiling")
-	_                     = flag.Bool("write_secrets", false, "[unused]")
-	smConnectionPoolSize  = flag.Int("sm_connection_pool_size", 5, "size of the connection pool for the secret manager API client")
-	iamConnectionPoolSize = flag.Int("iam_connection_pool_size", 5, "size of the connection pool for the IAM API client")
+	kubeconfig              = flag.String("kubeconfig", "", "absolute path to kubeconfig file")
+	logFormatJSON           = flag.Bool("log-format-json", true, "set log formatter to json")
+	metricsAddr             = flag.String("metrics_addr", ":8095", "configure http listener for reporting metrics")
+	enableProfile           = flag.Bool("enable-pprof", false, "enable pprof profiling")
+	debugAddr               = flag.String("debug_addr", "localhost:6060", "port for pprof profiling")
+	_                       = flag.Bool("write_secrets", false, "[unused]")
+	smConnectionPoolSize    = flag.Int("sm_connection_pool_size", 5, "size of the connection pool for the secret manager API client")
+	iamConnectionPoolSize   = flag.Int("iam_connection_pool_size", 5, "size of the connection pool for the IAM API client")
+	retryMaxAttempts        = flag.Int("retry-max-attempts", 0, "maximum attempts for AccessSecretVersion calls, 0 keeps the client library defaults")
+	retryBackoff            = flag.Duration("retry-backoff", time.Second, "initial backoff between AccessSecretVersion attempts, only used when retry-max-attempts is greater than 0")
+	selfTest                = flag.Bool("selftest", false, "access each of the selftest-secrets with the provider credentials, print pass/fail per target and exit")
+	selfTestSecrets         = flag.String("selftest-secrets", "", "comma separated secret versions for selftest, e.g. one global and one regional resource")
+	validateSecrets         = flag.String("validate-secrets", "", "path to the mount attributes (JSON) or secrets list of a SecretProviderClass to validate with the provider credentials, prints a JSON report and exits")
+	serveStaleOnError       = flag.Bool("serve-stale-on-error", false, "serve expired cached secrets when fetching them fails with a retryable error, requires -cache-ttl")
+	cacheCoalesce           = flag.Bool("cache-coalesce", false, "share the fetch of a secret between concurrent mounts missing it in the cache, requires -cache-ttl")
+	maxStale                = flag.Duration("max-stale", time.Hour, "how long after expiring cached secrets may be served by -serve-stale-on-error")
+	cacheTTL                = flag.Duration("cache-ttl", 0, "cache secret payloads across mounts for this duration, 0 disables caching")
+	detectContentChanges    = flag.Bool("detect-content-changes", false, "compare mounted secrets against existing files and record whether they changed")
+	fetchTimeout            = flag.Duration("fetch-timeout", 0, "timeout of fetching each secret, retries included, 0 keeps the client library per call timeout")
+	regionTimeouts          = flag.String("region-timeouts", "", "per-location overrides of -fetch-timeout as location=duration, e.g. us-central1=10s,global=5s")
+	manifestSigningKey      = flag.String("manifest-signing-key", "", "path of a PEM encoded PKCS #8 Ed25519 private key signing the manifests of mounts with emitManifest set")
+	regionRetryPolicies     = flag.String("region-retry-policies", "", "per-location retry overrides as location=attempts:backoff, e.g. us-central1=5:200ms,global=3:1s")
+	retryMessages           = flag.String("retry-messages", "", "comma separated error message substrings retried in addition to the Unavailable and ResourceExhausted codes; errors such as PermissionDenied or NotFound are never retried")
+	mountMaxRetryDuration   = flag.Duration("mount-max-retry-duration", 0, "maximum time spent retrying Secret Manager calls across a whole mount, after which failures are returned, 0 disables the ceiling")
+	failOnEmptyMount        = flag.Bool("fail-on-empty-mount", false, "fail mounts that request no secrets instead of returning an empty response")
+	maxListedVersions       = flag.Int("max-listed-versions", 100, "maximum number of versions listed to find the previousVersions of a secret, 0 lists all")
+	listedBestEffort        = flag.Bool("listed-versions-best-effort", false, "write the previousVersions found within -max-listed-versions instead of failing the mount")
+	allowedEncodings        = flag.String("allowed-encodings", "", "comma separated encodings secrets may use, all are allowed when empty")
+	allowedTransforms       = flag.String("allowed-transforms", "", "comma separated transforms secrets may use, all are allowed when empty")
+	tokenRefreshWindow      = flag.Duration("token-refresh-window", time.Minute, "fetch a new token for a mount this long before its current token expires")
+	retryUnauthenticated    = flag.Bool("retry-unauthenticated", true, "refresh the mount token once and retry secrets rejected with Unauthenticated")
+	fileNameSanitization    = flag.String("file-name-sanitization", server.FileNameReject, "handling of unsafe characters in file names derived from secret metadata: reject or replace them with underscores")
+	mountCallBudget         = flag.Int("mount-call-budget", 0, "weighted cost of Secret Manager calls per mount after which optional lookups are skipped, list calls weigh 5 and others 1, 0 is unlimited")
+	readyErrorThreshold     = flag.Float64("ready-error-threshold", 0, "fraction of secret fetches failing against Secret Manager within -ready-error-window above which /ready reports not ready, 0 disables the check")
+	readyErrorWindow        = flag.Duration("ready-error-window", 5*time.Minute, "rolling window of the -ready-error-threshold error rate")
+	checkTargetWritable     = flag.Bool("check-target-writable", false, "fail mounts with a clear error when the mount target directory is not writable, before fetching any secret")
+	forbidLatest            = flag.Bool("forbid-latest", false, "reject mounts of secrets referenced by the latest version alias instead of a pinned version")
+	maxConcurrentMounts     = flag.Int("max-concurrent-mounts", 0, "maximum number of mounts handled at once, 0 disables the limit")
+	skipTerminatingPods     = flag.Bool("skip-terminating-pods", false, "look up the mounting pod and fail the mount without fetching secrets when it is being deleted, requires get on pods")
+	mountOverflowPolicy     = flag.String("mount-overflow-policy", server.OverflowQueue, "handling of mounts beyond max-concurrent-mounts: queue waits for a slot, reject fails the mount so the driver retries")
+	timingManifest          = flag.Bool("debug-timing-manifest", false, "add a .gcp-provider-timings.json file with per-secret fetch timings to every mount, for debugging only")
+	reportReplication       = flag.Bool("report-replication", false, "log the replication locations of every mounted secret, requires secretmanager.secrets.get")
+	diagnoseAccessDenied    = flag.Bool("diagnose-access-denied", false, "log a redacted summary of the IAM bindings of secrets whose access is denied, for debugging only, requires secretmanager.secrets.getIamPolicy")
+	maxRecvMsgSize          = flag.Int("max-recv-msg-size", 0, "maximum size in bytes of Secret Manager responses, 0 keeps the gRPC default of 4MiB")
+	maxSecretsPerMount      = flag.Int("max-secrets-per-mount", 1000, "reject mounts with more secrets than this, 0 disables the limit")
+	adaptiveConcurrencyMin  = flag.Int("adaptive-concurrency-min", 1, "lowest number of concurrent Secret Manager calls the adaptive limit can shrink to")
+	destroyWarningWindow    = flag.Duration("destroy-warning-window", 0, "warn about mounted secret versions scheduled to be destroyed within this window, 0 disables the check")
+	mountErrorFormat        = flag.String("mount-error-format", server.ErrorFormatText, "format of the per-secret failures in mount errors: text or json")
+	responseOrder           = flag.String("response-order", server.OrderConfig, "order of the files and object versions in mount responses: config-order, alphabetical-by-path or by-resource-name")
+	dedupObjectVersions     = flag.Bool("dedup-object-versions", false, "list a secret mounted to several files once in the object versions of mount responses instead of once per file")
+	defaultProject          = flag.String("default-project", "", "project used for resource names with the \"-\" project placeholder, e.g. projects/-/secrets/name/versions/1")
+	detectDefaultProject    = flag.Bool("detect-default-project", false, "detect -default-project from the GCE metadata server at startup when it is not set, it stays unset outside of GCE")
+	enforceSameProject      = flag.Bool("enforce-same-project", false, "reject secrets outside of the workload project, -default-project or the project detected from the GCE metadata server")
+	checkLocations          = flag.Bool("check-locations", false, "reject regional secrets in locations that are not known Google Cloud regions before calling Secret Manager")
+	knownLocations          = flag.String("known-locations", "", "comma separated locations replacing the built-in list of regions used by -check-locations")
+	allowedProjects         = flag.String("allowed-projects", "", "comma separated projects exempt from -enforce-same-project")
+	grpcCompression         = flag.String("grpc-compression", server.CompressionNone, "compression of Secret Manager calls: none or gzip")
+	detectVersionDivergence = flag.Bool("detect-version-divergence", false, "warn when a secret fetched from several locations in one mount resolves to different versions")
+	logSuppressCodes        = flag.String("log-suppress-codes", "", "comma separated gRPC codes, e.g. NotFound, whose failures of optional secrets are only logged at -v=5; they are still counted in metrics")
+	groupByLocation         = flag.Bool("group-by-location", false, "fetch the secrets of each location of a mount one after the other to reuse the endpoint connection, locations are still fetched concurrently")
+	adaptiveConcurrencyMax  = flag.Int("adaptive-concurrency-max", 0, "highest number of concurrent Secret Manager calls, shrunk under sustained ResourceExhausted or Unavailable errors; 0 disables the adaptive limit")
+	warmUpRegions           = flag.String("warmup-regions", "", "comma separated regions whose Secret Manager clients are created at startup, e.g. us-central1,europe-west1")
+	warmUpProbe             = flag.Bool("warmup-probe", false, "issue a cheap request to each warmup-regions endpoint at startup to establish the connection")
 
 	version = "dev"
 )
@@ -77,6 +138,12 @@ func main() {
 		klog.SetLogger(logger)
 	}
 
+	if err := validateFlags(currentFlags()); err != nil {
+		klog.ErrorS(err, "invalid flags")
+		klog.Flush()
+		os.Exit(2)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 	var err error
@@ -89,27 +156,6 @@ func main() {
 	ua := fmt.Sprintf("%s/%s", uai, version)
 	klog.InfoS(fmt.Sprintf("starting %s", ua))
 
-	// Kubernetes Client
-	var rc *rest.Config
-	if *kubeconfig != "" {
-		klog.V(5).InfoS("using kubeconfig", "path", *kubeconfig)
-		rc, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	} else {
-		klog.V(5).InfoS("using in-cluster kubeconfig")
-		rc, err = rest.InClusterConfig()
-	}
-	if err != nil {
-		klog.ErrorS(err, "failed to read kubeconfig")
-		klog.Fatal("failed to read kubeconfig")
-	}
-	rc.ContentType = runtime.ContentTypeProtobuf
-
-	clientset, err := kubernetes.NewForConfig(rc)
-	if err != nil {
-		klog.ErrorS(err, "failed to configure k8s client")
-		klog.Fatal("failed to configure k8s client")
-	}
-
 	// Secret Manager client
 	//
 	// build without auth so that authentication can be re-added on a per-RPC
@@ -138,6 +184,39 @@ func main() {
 	// To cache the clients for regional endpoints.
 	m := make(map[string]*secretmanager.Client)
 
+	if *selfTest {
+		code := runSelfTest(ctx, sc, m, smOpts)
+		klog.Flush()
+		os.Exit(code)
+	}
+
+	if *validateSecrets != "" {
+		code := validate(ctx, sc, m, smOpts, *validateSecrets)
+		klog.Flush()
+		os.Exit(code)
+	}
+
+	// Kubernetes Client
+	var rc *rest.Config
+	if *kubeconfig != "" {
+		klog.V(5).InfoS("using kubeconfig", "path", *kubeconfig)
+		rc, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	} else {
+		klog.V(5).InfoS("using in-cluster kubeconfig")
+		rc, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		klog.ErrorS(err, "failed to read kubeconfig")
+		klog.Fatal("failed to read kubeconfig")
+	}
+	rc.ContentType = runtime.ContentTypeProtobuf
+
+	clientset, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		klog.ErrorS(err, "failed to configure k8s client")
+		klog.Fatal("failed to configure k8s client")
+	}
+
 	// IAM client
 	//
 	// build without auth so that authentication can be re-added on a per-RPC
@@ -181,12 +260,161 @@ func main() {
 		HTTPClient:     hc,
 	}
 
+	if *retryMaxAttempts <= 0 {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "retry-backoff" {
+				klog.InfoS("ignoring retry-backoff since retry-max-attempts is not set")
+			}
+		})
+	}
+
+	retryPolicies, err := server.ParseRetryPolicies(*regionRetryPolicies)
+	if err != nil {
+		klog.ErrorS(err, "failed to parse region retry policies")
+		klog.Fatal("failed to parse region retry policies")
+	}
+
+	timeouts, err := server.ParseLocationTimeouts(*regionTimeouts)
+	if err != nil {
+		klog.ErrorS(err, "failed to parse region timeouts")
+		klog.Fatal("failed to parse region timeouts")
+	}
+
+	var manifestKey ed25519.PrivateKey
+	if *manifestSigningKey != "" {
+		manifestKey, err = server.LoadManifestKey(*manifestSigningKey)
+		if err != nil {
+			klog.ErrorS(err, "failed to load manifest signing key")
+			klog.Fatal("failed to load manifest signing key")
+		}
+	}
+
+	project := *defaultProject
+	if project == "" && *detectDefaultProject {
+		dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		project = server.DetectDefaultProject(dctx, c.MetadataClient)
+		cancel()
+		if project != "" {
+			klog.InfoS("detected default project", "project", project)
+		}
+	}
+
+	var sameProject string
+	if *enforceSameProject {
+		sameProject = project
+		if sameProject == "" {
+			dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			sameProject = server.DetectDefaultProject(dctx, c.MetadataClient)
+			cancel()
+		}
+		if sameProject == "" {
+			klog.Fatal("-enforce-same-project requires -default-project outside of GCE")
+		}
+		klog.InfoS("rejecting secrets outside of the workload project", "project", sameProject, "allowed_projects", *allowedProjects)
+	}
+
+	var locations []string
+	if *checkLocations {
+		locations = server.DefaultLocations
+		if *knownLocations != "" {
+			locations = server.ParseList(*knownLocations)
+		}
+	}
+
+	suppressCodes, err := server.ParseLogSuppressCodes(*logSuppressCodes)
+	if err != nil {
+		klog.ErrorS(err, "failed to parse log suppress codes")
+		klog.Fatal("failed to parse log suppress codes")
+	}
+
+	var cache *server.SecretCache
+	if *cacheTTL > 0 {
+		cache = server.NewSecretCache(*cacheTTL)
+		if *serveStaleOnError {
+			cache.ServeStale(*maxStale)
+		}
+		if *cacheCoalesce {
+			cache.Coalesce()
+		}
+	}
+
+	var errorRate *server.ErrorRateTracker
+	if *readyErrorThreshold > 0 {
+		errorRate = server.NewErrorRateTracker(*readyErrorWindow, *readyErrorThreshold)
+	}
+
+	if *warmUpRegions != "" {
+		server.WarmUpRegions(ctx, server.ParseList(*warmUpRegions), m, smOpts, *warmUpProbe)
+	}
+
+	var limiter *server.MountLimiter
+	if *maxConcurrentMounts > 0 {
+		limiter, err = server.NewMountLimiter(*maxConcurrentMounts, *mountOverflowPolicy)
+		if err != nil {
+			klog.ErrorS(err, "failed to configure mount limiter")
+			klog.Fatal("failed to configure mount limiter")
+		}
+	}
+
+	var concurrency *server.AdaptiveLimiter
+	if *adaptiveConcurrencyMax > 0 {
+		concurrency, err = server.NewAdaptiveLimiter(*adaptiveConcurrencyMin, *adaptiveConcurrencyMax)
+		if err != nil {
+			klog.ErrorS(err, "failed to configure adaptive concurrency")
+			klog.Fatal("failed to configure adaptive concurrency")
+		}
+	}
+
 	// setup provider grpc server
 	s := &server.Server{
 		SecretClient:          sc,
 		AuthClient:            c,
 		RegionalSecretClients: m,
 		SmOpts:                smOpts,
+		MountLimiter:          limiter,
+		Pods:                  c,
+		SkipTerminatingPods:   *skipTerminatingPods,
+		MountOptions: server.MountOptions{
+			DefaultRetryPolicy:      server.RetryPolicy{MaxAttempts: *retryMaxAttempts, Backoff: *retryBackoff},
+			RetryPolicies:           retryPolicies,
+			RetryMessages:           server.ParseList(*retryMessages),
+			MaxRetryDuration:        *mountMaxRetryDuration,
+			CallBudget:              *mountCallBudget,
+			DefaultTimeout:          *fetchTimeout,
+			Timeouts:                timeouts,
+			ManifestKey:             manifestKey,
+			DetectContentChanges:    *detectContentChanges,
+			Cache:                   cache,
+			ErrorRate:               errorRate,
+			ForbidLatest:            *forbidLatest,
+			AllowedEncodings:        server.ParseList(*allowedEncodings),
+			MaxListedVersions:       *maxListedVersions,
+			VersionsBestEffort:      *listedBestEffort,
+			AllowedTransforms:       server.ParseList(*allowedTransforms),
+			TimingManifest:          *timingManifest,
+			ReportReplication:       *reportReplication,
+			DiagnoseAccessDenied:    *diagnoseAccessDenied,
+			MaxSecretsPerMount:      *maxSecretsPerMount,
+			FailOnEmptyMount:        *failOnEmptyMount,
+			CheckTargetWritable:     *checkTargetWritable,
+			TokenRefreshWindow:      *tokenRefreshWindow,
+			RetryUnauthenticated:    *retryUnauthenticated,
+			MaxRecvMsgSize:          *maxRecvMsgSize,
+			Concurrency:             concurrency,
+			GroupByLocation:         *groupByLocation,
+			LogSuppressCodes:        suppressCodes,
+			DestroyWarningWindow:    *destroyWarningWindow,
+			ResponseOrder:           *responseOrder,
+			ErrorFormat:             *mountErrorFormat,
+			FileNameSanitization:    *fileNameSanitization,
+			DedupObjectVersions:     *dedupObjectVersions,
+			DefaultProject:          project,
+			SameProject:             sameProject,
+			AllowedProjects:         server.ParseList(*allowedProjects),
+			KnownLocations:          locations,
+			Compression:             *grpcCompression,
+			DetectVersionDivergence: *detectVersionDivergence,
+		},
 	}
 
 	p, err := vars.ProviderName.GetValue()
@@ -228,9 +456,11 @@ func main() {
 	}
 
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/capabilities", server.CapabilitiesHandler(version))
 	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.Handle("/ready", errorRate)
 	go func() {
 		if err := ms.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			klog.ErrorS(err, "metrics http server error")
@@ -263,3 +493,86 @@ func main() {
 	klog.InfoS("terminating")
 	g.GracefulStop()
 }
+
+// validate checks the secrets list at path with the provider credentials and
+// prints a JSON report to stdout. It returns the process exit code.
+func validate(ctx context.Context, sc *secretmanager.Client, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption, path string) int {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		klog.ErrorS(err, "unable to read secrets list", "path", path)
+		return 1
+	}
+	cfg, err := parseValidateInput(data)
+	if err != nil {
+		klog.ErrorS(err, "unable to parse mount configuration", "path", path)
+		return 1
+	}
+	if err := server.CheckMountConfig(cfg); err != nil {
+		klog.ErrorS(err, "invalid mount configuration", "path", path)
+		return 1
+	}
+	creds, err := providerCreds(ctx)
+	if err != nil {
+		klog.ErrorS(err, "unable to obtain provider credentials")
+		return 1
+	}
+
+	reports := server.ValidateMountConfig(ctx, sc, creds, cfg, regionalClients, smOpts)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(reports); err != nil {
+		klog.ErrorS(err, "unable to write report")
+		return 1
+	}
+	for _, r := range reports {
+		if !r.Accessible {
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseValidateInput parses either the mount attributes of a
+// SecretProviderClass as a JSON object, which is checked like a mount
+// request, or a bare secrets list.
+func parseValidateInput(data []byte) (*config.MountConfig, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		secrets, err := config.ParseSecrets(data)
+		if err != nil {
+			return nil, err
+		}
+		return &config.MountConfig{Secrets: secrets, PodInfo: &config.PodInfo{}}, nil
+	}
+	return config.Parse(&config.MountParams{
+		Attributes:  string(data),
+		KubeSecrets: "{}",
+		TargetPath:  "/validate",
+		Permissions: 0644,
+	})
+}
+
+// runSelfTest accesses the selftest-secrets with the provider credentials. It
+// returns the process exit code.
+func runSelfTest(ctx context.Context, sc *secretmanager.Client, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption) int {
+	creds, err := providerCreds(ctx)
+	if err != nil {
+		klog.ErrorS(err, "unable to obtain provider credentials")
+		return 1
+	}
+	if err := server.SelfTest(ctx, sc, creds, regionalClients, smOpts, server.MountOptions{}, server.ParseList(*selfTestSecrets), os.Stdout); err != nil {
+		klog.ErrorS(err, "self test failed")
+		return 1
+	}
+	return 0
+}
+
+// providerCreds returns per-RPC credentials from the Application Default
+// Credentials of the provider.
+func providerCreds(ctx context.Context) (credentials.PerRPCCredentials, error) {
+	ts, err := google.DefaultTokenSource(ctx, secretmanager.DefaultAuthScopes()...)
+	if err != nil {
+		return nil, err
+	}
+	return oauth.TokenSource{TokenSource: ts}, nil
+}
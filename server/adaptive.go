@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// shrinkAfterErrors is the number of consecutive retryable errors after
+// which the adaptive limit is halved. Isolated errors do not shrink it.
+const shrinkAfterErrors = 3
+
+// AdaptiveLimiter bounds the number of concurrent Secret Manager calls across
+// all mounts. The limit is halved under sustained retryable errors, such as
+// ResourceExhausted, and grows back by one after a full limit's worth of
+// consecutive successes. It always stays within [min, max].
+type AdaptiveLimiter struct {
+	min, max int
+
+	mu        sync.Mutex
+	limit     int
+	inFlight  int
+	errors    int
+	successes int
+	// changed is closed and replaced whenever a slot is released.
+	changed chan struct{}
+}
+
+// NewAdaptiveLimiter returns a limiter starting at max concurrent calls.
+func NewAdaptiveLimiter(min, max int) (*AdaptiveLimiter, error) {
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("adaptive concurrency bounds must satisfy 0 < min <= max, got min %d and max %d", min, max)
+	}
+	return &AdaptiveLimiter{
+		min:     min,
+		max:     max,
+		limit:   max,
+		changed: make(chan struct{}),
+	}, nil
+}
+
+// acquire waits for a slot under the current limit.
+func (l *AdaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// release returns a slot and adjusts the limit based on the outcome of the
+// call that held it.
+func (l *AdaptiveLimiter) release(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	switch {
+	case slices.Contains(retryableCodes, status.Code(err)):
+		l.successes = 0
+		l.errors++
+		if l.errors >= shrinkAfterErrors && l.limit > l.min {
+			l.limit = max(l.min, l.limit/2)
+			l.errors = 0
+			klog.InfoS("reducing Secret Manager concurrency after sustained errors", "limit", l.limit, "code", status.Code(err).String())
+		}
+	case err == nil:
+		l.errors = 0
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.max {
+			l.limit++
+			l.successes = 0
+			klog.V(3).InfoS("increasing Secret Manager concurrency", "limit", l.limit)
+		}
+	default:
+		// Errors such as NotFound or PermissionDenied say nothing about load.
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// currentLimit returns the effective concurrency limit.
+func (l *AdaptiveLimiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
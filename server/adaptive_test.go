@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdaptiveLimiterShrinksAndRecovers(t *testing.T) {
+	l, err := NewAdaptiveLimiter(2, 16)
+	if err != nil {
+		t.Fatalf("NewAdaptiveLimiter() got err = %v, want nil", err)
+	}
+	call := func(err error) {
+		t.Helper()
+		if err := l.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire() got err = %v, want nil", err)
+		}
+		l.release(err)
+	}
+
+	// Isolated errors and non-retryable errors leave the limit alone.
+	call(status.Error(codes.ResourceExhausted, "quota"))
+	call(nil)
+	call(status.Error(codes.NotFound, "missing"))
+	if got := l.currentLimit(); got != 16 {
+		t.Fatalf("limit after isolated errors = %d, want 16", got)
+	}
+
+	// Sustained errors shrink the limit down to the minimum.
+	for i := 0; i < 30; i++ {
+		call(status.Error(codes.ResourceExhausted, "quota"))
+	}
+	if got := l.currentLimit(); got != 2 {
+		t.Fatalf("limit after sustained errors = %d, want 2", got)
+	}
+
+	// Recovery grows it back, bounded by the maximum.
+	for i := 0; i < 1000; i++ {
+		call(nil)
+	}
+	if got := l.currentLimit(); got != 16 {
+		t.Errorf("limit after recovery = %d, want 16", got)
+	}
+}
+
+func TestAdaptiveLimiterBlocksAtLimit(t *testing.T) {
+	l, err := NewAdaptiveLimiter(1, 1)
+	if err != nil {
+		t.Fatalf("NewAdaptiveLimiter() got err = %v, want nil", err)
+	}
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() got err = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("acquire() over the limit got err = %v, want DeadlineExceeded", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- l.acquire(context.Background()) }()
+	l.release(nil)
+	if err := <-done; err != nil {
+		t.Errorf("acquire() after release got err = %v, want nil", err)
+	}
+}
+
+func TestHandleMountEventAdaptiveConcurrency(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		cfg.Secrets = append(cfg.Secrets, &config.Secret{
+			ResourceName: "projects/project/secrets/" + name + "/versions/1",
+			FileName:     name + ".txt",
+		})
+	}
+
+	l, err := NewAdaptiveLimiter(1, 8)
+	if err != nil {
+		t.Fatalf("NewAdaptiveLimiter() got err = %v, want nil", err)
+	}
+	opts := MountOptions{
+		Concurrency:        l,
+		DefaultRetryPolicy: RetryPolicy{MaxAttempts: 1},
+	}
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err == nil {
+		t.Fatalf("handleMountEvent() got err = nil, want error")
+	}
+	if got := l.currentLimit(); got >= 8 {
+		t.Errorf("limit after sustained ResourceExhausted = %d, want < 8", got)
+	}
+}
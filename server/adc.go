@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Defaults for the endpoints of a service account key file, matching the keys
+// created by the IAM API.
+const (
+	defaultAuthURI        = "https://accounts.google.com/o/oauth2/auth"
+	defaultTokenURI       = "https://oauth2.googleapis.com/token"
+	defaultAuthProviderCA = "https://www.googleapis.com/oauth2/v1/certs"
+)
+
+// serviceAccountKey is the application_default_credentials.json format of a
+// service account key.
+type serviceAccountKey struct {
+	Type                    string `json:"type"`
+	ProjectID               string `json:"project_id,omitempty"`
+	PrivateKeyID            string `json:"private_key_id"`
+	PrivateKey              string `json:"private_key"`
+	ClientEmail             string `json:"client_email"`
+	ClientID                string `json:"client_id,omitempty"`
+	AuthURI                 string `json:"auth_uri"`
+	TokenURI                string `json:"token_uri"`
+	AuthProviderX509CertURL string `json:"auth_provider_x509_cert_url"`
+	ClientX509CertURL       string `json:"client_x509_cert_url,omitempty"`
+	UniverseDomain          string `json:"universe_domain,omitempty"`
+}
+
+// serviceAccountADC validates a service account key JSON and writes it in the
+// application_default_credentials.json format, filling in the default
+// endpoints where they are missing.
+func serviceAccountADC(contents []byte) ([]byte, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(contents, &key); err != nil {
+		return nil, fmt.Errorf("service account key is not valid JSON: %v", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("unsupported credential type %q, expected service_account", key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKeyID == "" {
+		return nil, errors.New("service account key is missing client_email or private_key_id")
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("service account key has no PEM encoded private_key")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, errors.New("service account private_key is not a valid private key")
+		}
+	}
+
+	if key.AuthURI == "" {
+		key.AuthURI = defaultAuthURI
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = defaultTokenURI
+	}
+	if key.AuthProviderX509CertURL == "" {
+		key.AuthProviderX509CertURL = defaultAuthProviderCA
+	}
+	return json.MarshalIndent(key, "", "  ")
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2/google"
+)
+
+func testServiceAccountKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestServiceAccountADC(t *testing.T) {
+	in, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "abc123",
+		"private_key":    testServiceAccountKey(t),
+		"client_email":   "app@project.iam.gserviceaccount.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := transform("service-account-adc", transformInput{path: "application_default_credentials.json", contents: in})
+	if err != nil {
+		t.Fatalf("transform() got err = %v, want nil", err)
+	}
+	if len(files) != 1 || files[0].path != "application_default_credentials.json" {
+		t.Fatalf("transform() got %d files, want application_default_credentials.json only", len(files))
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(files[0].contents, &got); err != nil {
+		t.Fatalf("transform() returned invalid JSON: %v", err)
+	}
+	if got["token_uri"] != defaultTokenURI || got["client_email"] != "app@project.iam.gserviceaccount.com" {
+		t.Errorf("transform() got %v, want default token_uri and the original client_email", got)
+	}
+	// The client libraries must accept the file as ADC.
+	if _, err := google.CredentialsFromJSON(context.Background(), files[0].contents, "https://www.googleapis.com/auth/cloud-platform"); err != nil {
+		t.Errorf("google.CredentialsFromJSON() got err = %v, want nil", err)
+	}
+}
+
+func TestServiceAccountADCErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "not json", in: "not json", want: "not valid JSON"},
+		{name: "user credentials", in: `{"type": "authorized_user"}`, want: "unsupported credential type"},
+		{name: "missing email", in: `{"type": "service_account", "private_key_id": "abc"}`, want: "missing client_email"},
+		{name: "bad private key", in: `{"type": "service_account", "private_key_id": "abc", "client_email": "a@b", "private_key": "nope"}`, want: "no PEM"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := transform("service-account-adc", transformInput{path: "adc.json", contents: []byte(tc.in)})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("transform() got err = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"slices"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkAllowlists fails with FailedPrecondition when a secret uses an
+// encoding or transform missing from the allowlists of opts. Empty
+// allowlists allow everything.
+func checkAllowlists(secrets []*config.Secret, opts MountOptions) error {
+	for _, secret := range secrets {
+		if len(opts.AllowedEncodings) > 0 {
+			for _, enc := range []string{secret.Encoding, secret.EncodeOnWrite} {
+				if enc != "" && !slices.Contains(opts.AllowedEncodings, enc) {
+					return status.Errorf(codes.FailedPrecondition, "secret %s uses encoding %q which is not allowed by policy, allowed encodings are %v", secret.ResourceName, enc, opts.AllowedEncodings)
+				}
+			}
+		}
+		if len(opts.AllowedTransforms) > 0 && secret.Transform != "" && !slices.Contains(opts.AllowedTransforms, secret.Transform) {
+			return status.Errorf(codes.FailedPrecondition, "secret %s uses transform %q which is not allowed by policy, allowed transforms are %v", secret.ResourceName, secret.Transform, opts.AllowedTransforms)
+		}
+	}
+	return nil
+}
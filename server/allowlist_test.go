@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventAllowlists(t *testing.T) {
+	cert := testCertificate(t)
+
+	tests := []struct {
+		name     string
+		secret   *config.Secret
+		opts     MountOptions
+		wantCode codes.Code
+	}{
+		{
+			name:   "allowed transform",
+			secret: &config.Secret{Transform: "cert-fingerprint-sha256"},
+			opts:   MountOptions{AllowedTransforms: []string{"cert-fingerprint-sha256"}},
+		},
+		{
+			name:     "disallowed transform",
+			secret:   &config.Secret{Transform: "cert-fingerprint-sha256"},
+			opts:     MountOptions{AllowedTransforms: []string{"pem-to-jwk"}},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:   "empty allowlists",
+			secret: &config.Secret{Transform: "cert-fingerprint-sha256", EncodeOnWrite: "base64"},
+		},
+		{
+			name:     "disallowed encoding",
+			secret:   &config.Secret{EncodeOnWrite: "base64"},
+			opts:     MountOptions{AllowedEncodings: []string{"hex"}},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:   "no transform with transform allowlist",
+			secret: &config.Secret{},
+			opts:   MountOptions{AllowedTransforms: []string{"pem-to-jwk"}, AllowedEncodings: []string{"base64"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			var mu sync.Mutex
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					mu.Lock()
+					calls++
+					mu.Unlock()
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: cert},
+					}, nil
+				},
+			})
+			tc.secret.ResourceName = "projects/project/secrets/cert/versions/1"
+			tc.secret.FileName = "cert.pem"
+			cfg := &config.MountConfig{
+				Secrets:     []*config.Secret{tc.secret},
+				Permissions: 0640,
+				PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+			}
+
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, tc.opts)
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("handleMountEvent() got err = %v, want code %v", err, tc.wantCode)
+			}
+			if tc.wantCode != codes.OK && calls != 0 {
+				t.Errorf("AccessSecretVersion() calls = %d, want none for a rejected mount", calls)
+			}
+		})
+	}
+}
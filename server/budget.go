@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"k8s.io/klog/v2"
+)
+
+// Weights of the Secret Manager calls of a mount against
+// MountOptions.CallBudget, listing being the most expensive.
+const (
+	accessCost     = 1
+	getVersionCost = 1
+	getSecretCost  = 1
+	listCost       = 5
+)
+
+// callBudget bounds the weighted cost of the calls of a mount. Required calls
+// always proceed and spend from it, optional lookups only run while it
+// covers their cost. A nil budget is unlimited.
+type callBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// newCallBudget returns a budget of total, or nil when total is not
+// positive.
+func newCallBudget(total int) *callBudget {
+	if total <= 0 {
+		return nil
+	}
+	return &callBudget{remaining: total}
+}
+
+// spend records the cost of a required call.
+func (b *callBudget) spend(cost int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining -= cost
+}
+
+// take spends cost for an optional call and reports whether it may run.
+func (b *callBudget) take(cost int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining < cost {
+		return false
+	}
+	b.remaining -= cost
+	return true
+}
+
+// logBudgetExhausted warns that the optional lookup of secret was skipped.
+func logBudgetExhausted(lookup string, secret *config.Secret, cfg *config.MountConfig) {
+	klog.InfoS("WARNING: skipping optional lookup, the call budget of the mount is exhausted", "lookup", lookup, "resource_name", secret.ResourceName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+)
+
+func TestHandleMountEventCallBudget(t *testing.T) {
+	var mu sync.Mutex
+	lookups := 0
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			return &secretmanagerpb.SecretVersion{Name: req.Name, Etag: "etag"}, nil
+		},
+		getSecretFn: func(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			return &secretmanagerpb.Secret{Name: req.Name}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt", Metadata: true, ReplicationFile: true},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		budget      int
+		wantFiles   int
+		wantLookups int
+	}{
+		{name: "unlimited", budget: 0, wantFiles: 3, wantLookups: 2},
+		{name: "covers every call", budget: 3, wantFiles: 3, wantLookups: 2},
+		{name: "covers the version lookup", budget: 2, wantFiles: 2, wantLookups: 1},
+		// The access itself always proceeds, even over budget.
+		{name: "spent by the access", budget: 1, wantFiles: 1, wantLookups: 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lookups = 0
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{CallBudget: tc.budget})
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if len(got.Files) != tc.wantFiles {
+				t.Errorf("handleMountEvent() wrote %d files, want %d", len(got.Files), tc.wantFiles)
+			}
+			if lookups != tc.wantLookups {
+				t.Errorf("handleMountEvent() made %d optional lookups, want %d", lookups, tc.wantLookups)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"k8s.io/klog/v2"
+)
+
+// SecretCache caches AccessSecretVersion responses across mount events to
+// reduce calls to the Secret Manager API. Entries are scoped to the identity
+// of the mount so a cached payload is only served to mounts using the same
+// credentials that originally fetched it.
+type SecretCache struct {
+	ttl time.Duration
+	now func() time.Time
+	// maxStale is how long expired entries are kept to be served when
+	// Secret Manager is unavailable.
+	maxStale time.Duration
+	// coalesce lets mounts reference the entries they use, see Coalesce.
+	coalesce bool
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// refs counts the mounts in progress using each key.
+	refs map[string]int
+	// fetching holds the keys being fetched by a mount when coalescing,
+	// closed once the fetch ends.
+	fetching map[string]chan struct{}
+}
+
+type cacheEntry struct {
+	resp    *secretmanagerpb.AccessSecretVersionResponse
+	expires time.Time
+	// sum is the checksum of resp when it was stored.
+	sum [sha256.Size]byte
+}
+
+// NewSecretCache returns a cache whose entries expire after ttl unless the
+// secret overrides it.
+func NewSecretCache(ttl time.Duration) *SecretCache {
+	return &SecretCache{
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*cacheEntry),
+		refs:     make(map[string]int),
+		fetching: make(map[string]chan struct{}),
+	}
+}
+
+// ServeStale keeps entries for up to max after they expire so they can be
+// served when fetching the secret fails with a retryable error. It must be
+// called before the cache is used.
+func (c *SecretCache) ServeStale(max time.Duration) {
+	c.maxStale = max
+}
+
+// Coalesce shares fetches between concurrent mounts of the same secrets. A
+// mount missing an entry waits for another mount already fetching it rather
+// than calling Secret Manager again, and references the entries it uses until
+// it returns so they are not evicted meanwhile. References never make an
+// expired entry fresh. It must be called before the cache is used.
+func (c *SecretCache) Coalesce() {
+	c.coalesce = true
+}
+
+// acquire references key when coalescing, reporting whether it did. Each
+// successful acquire must be followed by a release.
+func (c *SecretCache) acquire(key string) bool {
+	if !c.coalesce {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs[key]++
+	return true
+}
+
+// release drops a reference taken by acquire.
+func (c *SecretCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refs[key]--; c.refs[key] <= 0 {
+		delete(c.refs, key)
+	}
+}
+
+// startFetch registers the caller as the fetcher of key when coalescing and
+// no other mount is fetching it, returning the function to call, possibly
+// more than once, when the fetch ends. Otherwise it returns the channel
+// closed when the fetch of the other mount ends, after which the entry should
+// be looked up again.
+func (c *SecretCache) startFetch(key string) (<-chan struct{}, func()) {
+	if !c.coalesce {
+		return nil, func() {}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.fetching[key]; ok {
+		return ch, nil
+	}
+	ch := make(chan struct{})
+	c.fetching[key] = ch
+	return nil, sync.OnceFunc(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.fetching, key)
+		close(ch)
+	})
+}
+
+// get returns the unexpired response stored for key.
+func (c *SecretCache) get(key string) (*secretmanagerpb.AccessSecretVersionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookup(key, 0)
+}
+
+// stale returns the response stored for key if it expired less than
+// maxStale ago, along with how long ago it expired. Unexpired entries are
+// returned as well.
+func (c *SecretCache) stale(key string) (*secretmanagerpb.AccessSecretVersionResponse, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.lookup(key, c.maxStale)
+	if !ok {
+		return nil, 0, false
+	}
+	return resp, max(c.now().Sub(c.entries[key].expires), 0), true
+}
+
+// lookup returns the response stored for key if it expired less than grace
+// ago. Entries past the stale window are removed unless referenced by a
+// mount. c.mu must be held.
+func (c *SecretCache) lookup(key string, grace time.Duration) (*secretmanagerpb.AccessSecretVersionResponse, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires.Add(c.maxStale)) && c.refs[key] == 0 {
+		delete(c.entries, key)
+		return nil, false
+	}
+	if !c.now().Before(e.expires.Add(grace)) {
+		return nil, false
+	}
+	if responseSum(e.resp) != e.sum {
+		// Never serve an entry whose version and payload no longer agree,
+		// the caller fetches it again instead.
+		klog.ErrorS(nil, "discarding corrupted cache entry", "resource_name", e.resp.GetName())
+		csrmetrics.RecordCacheCorruption()
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.resp, true
+}
+
+// put stores resp for key for the duration of ttl.
+func (c *SecretCache) put(key string, resp *secretmanagerpb.AccessSecretVersionResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &cacheEntry{resp: resp, expires: c.now().Add(ttl), sum: responseSum(resp)}
+}
+
+// responseSum checksums the version name and payload of resp.
+func responseSum(resp *secretmanagerpb.AccessSecretVersionResponse) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(resp.GetName()))
+	h.Write([]byte{0})
+	h.Write(resp.GetPayload().GetData())
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// ttlFor returns how long the secret may be cached. A non-positive duration
+// means the secret must not be cached.
+func (c *SecretCache) ttlFor(secret *config.Secret) time.Duration {
+	if secret.NoCache {
+		return 0
+	}
+	if secret.CacheTTLSeconds != nil {
+		return time.Duration(*secret.CacheTTLSeconds) * time.Second
+	}
+	return c.ttl
+}
+
+// cacheKey identifies a secret version for the credentials of the mount.
+func cacheKey(cfg *config.MountConfig, resource string) string {
+	mode, principal := cfg.Identity()
+	if cfg.AuthNodePublishSecret {
+		// The key file itself is the credential, not the email it claims.
+		sum := sha256.Sum256(cfg.AuthKubeSecret)
+		principal = hex.EncodeToString(sum[:])
+	}
+	return mode + "|" + principal + "|" + resource
+}
@@ -0,0 +1,432 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// countingAccess returns an accessFn that counts calls per resource name.
+func countingAccess(calls map[string]int, mu *sync.Mutex) func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	return func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		mu.Lock()
+		calls[req.Name]++
+		mu.Unlock()
+		return &secretmanagerpb.AccessSecretVersionResponse{
+			Name:    req.Name,
+			Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+		}, nil
+	}
+}
+
+func TestHandleMountEventNoCache(t *testing.T) {
+	const cached = "projects/project/secrets/cached/versions/1"
+	const uncached = "projects/project/secrets/uncached/versions/1"
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: cached, FileName: "cached.txt"},
+			{ResourceName: uncached, FileName: "uncached.txt", NoCache: true},
+		},
+		Permissions: 777,
+		AuthPodADC:  true,
+		PodInfo: &config.PodInfo{
+			Namespace:      "default",
+			Name:           "test-pod",
+			ServiceAccount: "default",
+		},
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+	opts := MountOptions{Cache: NewSecretCache(time.Hour)}
+
+	for i := 0; i < 3; i++ {
+		if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+		}
+	}
+
+	if calls[cached] != 1 {
+		t.Errorf("AccessSecretVersion(%s) calls = %d, want 1", cached, calls[cached])
+	}
+	if calls[uncached] != 3 {
+		t.Errorf("AccessSecretVersion(%s) calls = %d, want 3", uncached, calls[uncached])
+	}
+}
+
+func TestHandleMountEventRequireFresh(t *testing.T) {
+	const secret = "projects/project/secrets/test/versions/1"
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: secret, FileName: "good1.txt"},
+		},
+		Permissions: 777,
+		AuthPodADC:  true,
+		PodInfo: &config.PodInfo{
+			Namespace:      "default",
+			Name:           "test-pod",
+			ServiceAccount: "default",
+		},
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	access := countingAccess(calls, &mu)
+	failing := false
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if failing {
+				return nil, status.Error(codes.PermissionDenied, "access revoked")
+			}
+			return access(ctx, req)
+		},
+	})
+	opts := MountOptions{Cache: NewSecretCache(time.Hour)}
+
+	// Warm the cache, then remount requiring fresh reads.
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	cfg.RequireFresh = true
+	for i := 0; i < 2; i++ {
+		if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+		}
+	}
+	if calls[secret] != 3 {
+		t.Errorf("AccessSecretVersion(%s) calls = %d, want 3", secret, calls[secret])
+	}
+
+	// A failed fresh fetch is not hidden by the cached payload.
+	failing = true
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err == nil || !strings.Contains(err.Error(), "access revoked") {
+		t.Errorf("handleMountEvent() got err = %v, want the fetch error", err)
+	}
+	cfg.RequireFresh = false
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Errorf("handleMountEvent() got err = %v, want the cached payload without RequireFresh", err)
+	}
+}
+
+func TestHandleMountEventCacheTTLPerSecret(t *testing.T) {
+	const short = "projects/project/secrets/short/versions/1"
+	const long = "projects/project/secrets/long/versions/1"
+	const disabled = "projects/project/secrets/disabled/versions/1"
+	shortTTL, longTTL, noTTL := int64(60), int64(3600), int64(0)
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: short, FileName: "short.txt", CacheTTLSeconds: &shortTTL},
+			{ResourceName: long, FileName: "long.txt", CacheTTLSeconds: &longTTL},
+			{ResourceName: disabled, FileName: "disabled.txt", CacheTTLSeconds: &noTTL},
+		},
+		Permissions: 777,
+		AuthPodADC:  true,
+		PodInfo: &config.PodInfo{
+			Namespace:      "default",
+			Name:           "test-pod",
+			ServiceAccount: "default",
+		},
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+
+	now := time.Now()
+	cache := NewSecretCache(10 * time.Second)
+	cache.now = func() time.Time { return now }
+	opts := MountOptions{Cache: cache}
+
+	mount := func() {
+		t.Helper()
+		if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+		}
+	}
+
+	mount()
+	// Past the global TTL but within both per-secret TTLs.
+	now = now.Add(30 * time.Second)
+	mount()
+	// The short TTL has expired, the long one has not.
+	now = now.Add(time.Minute)
+	mount()
+
+	want := map[string]int{short: 2, long: 1, disabled: 3}
+	for name, n := range want {
+		if calls[name] != n {
+			t.Errorf("AccessSecretVersion(%s) calls = %d, want %d", name, calls[name], n)
+		}
+	}
+}
+
+func TestHandleMountEventCacheCorruption(t *testing.T) {
+	const resource = "projects/project/secrets/test/versions/1"
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: resource, FileName: "good1.txt"},
+		},
+		Permissions: 777,
+		AuthPodADC:  true,
+		PodInfo: &config.PodInfo{
+			Namespace:      "default",
+			Name:           "test-pod",
+			ServiceAccount: "default",
+		},
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+	cache := NewSecretCache(time.Hour)
+	opts := MountOptions{Cache: cache}
+
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+
+	// Corrupt the cached payload behind the cache's back.
+	cache.entries[cacheKey(cfg, resource)].resp = &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    resource,
+		Payload: &secretmanagerpb.SecretPayload{Data: []byte("garbage")},
+	}
+	before := metricValue(t, "secret_cache_corruption_count", nil)
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if string(got.Files[0].Contents) != "My Secret" {
+		t.Errorf("handleMountEvent() contents = %q, want the re-fetched payload", got.Files[0].Contents)
+	}
+	if calls[resource] != 2 {
+		t.Errorf("AccessSecretVersion calls = %d, want 2", calls[resource])
+	}
+	if got := metricValue(t, "secret_cache_corruption_count", nil) - before; got != 1 {
+		t.Errorf("cache corruptions = %v, want 1", got)
+	}
+}
+
+func TestCacheKeyScopedToIdentity(t *testing.T) {
+	const resource = "projects/project/secrets/test/versions/1"
+	podA := &config.MountConfig{AuthPodADC: true, PodInfo: &config.PodInfo{Namespace: "a", ServiceAccount: "sa"}}
+	podB := &config.MountConfig{AuthPodADC: true, PodInfo: &config.PodInfo{Namespace: "b", ServiceAccount: "sa"}}
+	keyA := &config.MountConfig{AuthNodePublishSecret: true, AuthKubeSecret: []byte(`{"client_email": "sa@example.com", "private_key": "a"}`), PodInfo: &config.PodInfo{}}
+	keyB := &config.MountConfig{AuthNodePublishSecret: true, AuthKubeSecret: []byte(`{"client_email": "sa@example.com", "private_key": "b"}`), PodInfo: &config.PodInfo{}}
+
+	if cacheKey(podA, resource) == cacheKey(podB, resource) {
+		t.Errorf("cacheKey() is shared between service accounts of different namespaces")
+	}
+	if cacheKey(keyA, resource) == cacheKey(keyB, resource) {
+		t.Errorf("cacheKey() is shared between different keys claiming the same email")
+	}
+}
+
+func TestHandleMountEventServeStaleOnError(t *testing.T) {
+	const secret = "projects/project/secrets/test/versions/1"
+
+	tests := []struct {
+		name      string
+		code      codes.Code
+		maxStale  time.Duration
+		expiredBy time.Duration
+		wantStale bool
+	}{
+		{name: "unavailable", code: codes.Unavailable, maxStale: time.Hour, expiredBy: time.Minute, wantStale: true},
+		{name: "permission denied", code: codes.PermissionDenied, maxStale: time.Hour, expiredBy: time.Minute},
+		{name: "beyond max staleness", code: codes.Unavailable, maxStale: time.Hour, expiredBy: 2 * time.Hour},
+		{name: "disabled", code: codes.Unavailable, expiredBy: time.Minute},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: secret, FileName: "good1.txt"},
+				},
+				Permissions: 0640,
+				AuthPodADC:  true,
+				PodInfo: &config.PodInfo{
+					Namespace:      "default",
+					Name:           "test-pod",
+					ServiceAccount: "default",
+				},
+			}
+			failing := false
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					if failing {
+						return nil, status.Error(tc.code, "outage")
+					}
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+					}, nil
+				},
+			})
+			now := time.Now()
+			cache := NewSecretCache(time.Minute)
+			cache.now = func() time.Time { return now }
+			cache.ServeStale(tc.maxStale)
+			// A single attempt keeps Unavailable from being retried.
+			opts := MountOptions{Cache: cache, DefaultRetryPolicy: RetryPolicy{MaxAttempts: 1}}
+
+			if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			failing = true
+			now = now.Add(time.Minute + tc.expiredBy)
+			before := metricValue(t, "secret_stale_served_count", nil)
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+			if gotStale := err == nil; gotStale != tc.wantStale {
+				t.Fatalf("handleMountEvent() got err = %v, want stale value served = %v", err, tc.wantStale)
+			}
+			if !tc.wantStale {
+				return
+			}
+			if string(got.GetFiles()[0].GetContents()) != "My Secret" {
+				t.Errorf("handleMountEvent() got contents %q, want the cached payload", got.GetFiles()[0].GetContents())
+			}
+			if d := metricValue(t, "secret_stale_served_count", nil) - before; d != 1 {
+				t.Errorf("secret_stale_served_count changed by %v, want 1", d)
+			}
+			// Serving the stale value must not extend its lifetime.
+			now = now.Add(tc.maxStale)
+			if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err == nil {
+				t.Errorf("handleMountEvent() got err = nil past the max staleness, want the fetch error")
+			}
+		})
+	}
+}
+
+func TestHandleMountEventCacheCoalesce(t *testing.T) {
+	const (
+		shared = "projects/project/secrets/shared/versions/1"
+		slow   = "projects/project/secrets/slow/versions/1"
+	)
+	unblock := map[string]chan struct{}{shared: make(chan struct{}), slow: make(chan struct{})}
+	calls := make(map[string]int)
+	var mu sync.Mutex
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			mu.Lock()
+			calls[req.Name]++
+			ch := unblock[req.Name]
+			mu.Unlock()
+			<-ch
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	newCfg := func(resources ...string) *config.MountConfig {
+		cfg := &config.MountConfig{
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+		for i, r := range resources {
+			cfg.Secrets = append(cfg.Secrets, &config.Secret{ResourceName: r, FileName: fmt.Sprintf("file%d", i)})
+		}
+		return cfg
+	}
+	sharedCalls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[shared]
+	}
+
+	var clock sync.Mutex
+	now := time.Now()
+	cache := NewSecretCache(time.Minute)
+	cache.now = func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		return now
+	}
+	cache.Coalesce()
+	opts := MountOptions{Cache: cache}
+	key := cacheKey(newCfg(), shared)
+	refs := func() int {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return cache.refs[key]
+	}
+	mount := func(wg *sync.WaitGroup, resources ...string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), newCfg(resources...), make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+				t.Errorf("handleMountEvent() got err = %v, want nil", err)
+			}
+		}()
+	}
+
+	// Mounts starting while the secret is fetched wait for that fetch.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		mount(&wg, shared)
+	}
+	for refs() != 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock[shared])
+	wg.Wait()
+	if got := sharedCalls(); got != 1 {
+		t.Errorf("shared secret fetched %d times by concurrent mounts, want 1", got)
+	}
+	if got := refs(); got != 0 {
+		t.Errorf("shared entry has %d references after every mount, want 0", got)
+	}
+
+	// A reference keeps the expired entry but does not serve it as fresh.
+	var slowMount sync.WaitGroup
+	mount(&slowMount, shared, slow)
+	for refs() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Lock()
+	now = now.Add(2 * time.Minute)
+	clock.Unlock()
+	mount(&wg, shared)
+	wg.Wait()
+	if got := sharedCalls(); got != 2 {
+		t.Errorf("shared secret fetched %d times, want 2 once expired while referenced", got)
+	}
+	close(unblock[slow])
+	slowMount.Wait()
+	if got := refs(); got != 0 {
+		t.Errorf("shared entry has %d references after every mount, want 0", got)
+	}
+}
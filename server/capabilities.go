@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"k8s.io/klog/v2"
+)
+
+// Capabilities describes what this build of the provider supports. It is
+// built from the registered encodings, transforms and secret options so it
+// can not drift from the implementation.
+type Capabilities struct {
+	Version       string   `json:"version"`
+	Encodings     []string `json:"encodings"`
+	Transforms    []string `json:"transforms"`
+	SecretOptions []string `json:"secretOptions"`
+}
+
+// NewCapabilities returns the capabilities of the provider at version.
+func NewCapabilities(version string) Capabilities {
+	return Capabilities{
+		Version:       version,
+		Encodings:     config.Encodings(),
+		Transforms:    transformNames(),
+		SecretOptions: config.SecretOptions(),
+	}
+}
+
+// CapabilitiesHandler serves the capabilities of the provider at version as
+// JSON.
+func CapabilitiesHandler(version string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(NewCapabilities(version)); err != nil {
+			klog.ErrorS(err, "unable to write capabilities")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCapabilitiesHandler(t *testing.T) {
+	transforms["test-transform"] = singleFile(func(contents []byte) ([]byte, error) { return contents, nil })
+	t.Cleanup(func() { delete(transforms, "test-transform") })
+
+	rec := httptest.NewRecorder()
+	CapabilitiesHandler("v1.2.3").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CapabilitiesHandler() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got Capabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() got err = %v", err)
+	}
+	if got.Version != "v1.2.3" {
+		t.Errorf("Version = %q, want %q", got.Version, "v1.2.3")
+	}
+	if !slices.Contains(got.Transforms, "test-transform") {
+		t.Errorf("Transforms = %v, want it to contain %q", got.Transforms, "test-transform")
+	}
+	if !slices.Contains(got.Encodings, "base64") {
+		t.Errorf("Encodings = %v, want it to contain %q", got.Encodings, "base64")
+	}
+	for _, opt := range []string{"resourceName", "transform", "encoding"} {
+		if !slices.Contains(got.SecretOptions, opt) {
+			t.Errorf("SecretOptions = %v, want it to contain %q", got.SecretOptions, opt)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+)
+
+// combinedValue returns the JSON value of a secret in the combined file. Text
+// is kept as is while binary payloads, which are not valid UTF-8, are base64
+// encoded.
+func combinedValue(contents []byte) string {
+	if utf8.Valid(contents) {
+		return string(contents)
+	}
+	return base64.StdEncoding.EncodeToString(contents)
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// Compression settings for Secret Manager calls.
+const (
+	// CompressionNone sends and receives uncompressed messages.
+	CompressionNone = "none"
+	// CompressionGzip compresses messages with gzip, trading CPU for
+	// bandwidth on large secrets.
+	CompressionGzip = "gzip"
+)
+
+// compressionCallOption returns the call option enabling compression, or nil
+// when messages are not compressed.
+func compressionCallOption(compression string) gax.CallOption {
+	if compression != CompressionGzip {
+		return nil
+	}
+	return gax.WithGRPCOptions(grpc.UseCompressor(gzip.Name))
+}
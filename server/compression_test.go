@@ -0,0 +1,48 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc"
+)
+
+func TestCompressionCallOption(t *testing.T) {
+	tests := []struct {
+		compression string
+		want        string
+	}{
+		{compression: "", want: ""},
+		{compression: CompressionNone, want: ""},
+		{compression: CompressionGzip, want: "gzip"},
+	}
+	for _, tc := range tests {
+		got := ""
+		if opt := compressionCallOption(tc.compression); opt != nil {
+			var settings gax.CallSettings
+			opt.Resolve(&settings)
+			for _, o := range settings.GRPC {
+				if c, ok := o.(grpc.CompressorCallOption); ok {
+					got = c.CompressorType
+				}
+			}
+		}
+		if got != tc.want {
+			t.Errorf("compressionCallOption(%q) compressor = %q, want %q", tc.compression, got, tc.want)
+		}
+	}
+}
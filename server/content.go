@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+)
+
+// stripBOM removes a leading UTF-8 or UTF-16 byte order mark from contents.
+// Contents without a byte order mark are returned unchanged.
+func stripBOM(contents []byte) []byte {
+	for _, bom := range [][]byte{bomUTF8, bomUTF16BE, bomUTF16LE} {
+		if bytes.HasPrefix(contents, bom) {
+			return contents[len(bom):]
+		}
+	}
+	return contents
+}
+
+// trimSpace removes leading and trailing Unicode whitespace from text
+// contents. Contents that are not valid UTF-8 are treated as binary and
+// returned unchanged.
+func trimSpace(contents []byte) []byte {
+	if !utf8.Valid(contents) {
+		return contents
+	}
+	return bytes.TrimSpace(contents)
+}
+
+// normalizeJSON parses contents as a single JSON value and returns it in a
+// canonical form with sorted object keys, compact or indented by two spaces
+// when pretty is set. Numbers keep their original precision.
+func normalizeJSON(contents []byte, pretty bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("payload is not valid JSON: unexpected data after the top-level value")
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+// contentChanged reports whether contents differ from the file at path by
+// comparing SHA-256 digests. A missing file counts as changed.
+func contentChanged(path string, contents []byte) (bool, error) {
+	existing, err := os.ReadFile(path) // #nosec G304 path is confined to the mount target by the caller
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sha256.Sum256(existing) != sha256.Sum256(contents), nil
+}
+
+// validateContent checks contents against pattern. Contents that are not
+// valid UTF-8 are rejected since the pattern is matched as text.
+func validateContent(pattern string, contents []byte) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid validateRegex: %v", err)
+	}
+	if !utf8.Valid(contents) {
+		return errors.New("payload is not valid UTF-8")
+	}
+	if !re.Match(contents) {
+		return fmt.Errorf("payload does not match validateRegex %q", pattern)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentChanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(path, []byte("old value"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		contents []byte
+		want     bool
+	}{
+		{
+			name:     "unchanged",
+			path:     path,
+			contents: []byte("old value"),
+			want:     false,
+		},
+		{
+			name:     "changed",
+			path:     path,
+			contents: []byte("new value"),
+			want:     true,
+		},
+		{
+			name:     "missing file",
+			path:     filepath.Join(dir, "missing.txt"),
+			contents: []byte("new value"),
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := contentChanged(tt.path, tt.contents)
+			if err != nil {
+				t.Fatalf("contentChanged() got err = %v, want nil", err)
+			}
+			if got != tt.want {
+				t.Errorf("contentChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		contents []byte
+		wantErr  bool
+	}{
+		{
+			name:     "match",
+			pattern:  `^key-[0-9]+$`,
+			contents: []byte("key-1234"),
+		},
+		{
+			name:     "mismatch",
+			pattern:  `^key-[0-9]+$`,
+			contents: []byte("garbage"),
+			wantErr:  true,
+		},
+		{
+			name:     "not utf-8",
+			pattern:  `.*`,
+			contents: []byte{0xff, 0xfe, 0x00},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid regex",
+			pattern:  `^key-[0-9+$`,
+			contents: []byte("key-1234"),
+			wantErr:  true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateContent(tc.pattern, tc.contents)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("validateContent() got err = %v, want err = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrimSpace(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{name: "spaces", in: []byte("  token  "), want: []byte("token")},
+		{name: "tabs and newlines", in: []byte("\t\ntoken\r\n\t"), want: []byte("token")},
+		{name: "unicode whitespace", in: []byte("\u00a0\u2003token\u3000"), want: []byte("token")},
+		{name: "inner whitespace kept", in: []byte(" user name \n"), want: []byte("user name")},
+		{name: "only whitespace", in: []byte(" \t\n"), want: []byte{}},
+		{name: "binary passthrough", in: []byte{' ', 0xff, 0x00, '\n'}, want: []byte{' ', 0xff, 0x00, '\n'}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := trimSpace(tc.in); !bytes.Equal(got, tc.want) {
+				t.Errorf("trimSpace(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		pretty   bool
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "compact",
+			contents: "{\n  \"b\": [1, 2.50, 12345678901234567890],\n  \"a\": {\"y\": null, \"x\": \"<tag>\"}\n}\n",
+			want:     `{"a":{"x":"<tag>","y":null},"b":[1,2.50,12345678901234567890]}`,
+		},
+		{
+			name:     "pretty",
+			contents: `{"b":true,"a":[1,"two"]}`,
+			pretty:   true,
+			want:     "{\n  \"a\": [\n    1,\n    \"two\"\n  ],\n  \"b\": true\n}",
+		},
+		{
+			name:     "scalar",
+			contents: ` "value" `,
+			want:     `"value"`,
+		},
+		{name: "invalid", contents: `{"a": 1,}`, wantErr: true},
+		{name: "truncated", contents: `{"a": [1, 2`, wantErr: true},
+		{name: "trailing data", contents: `{"a": 1} {"b": 2}`, wantErr: true},
+		{name: "empty", contents: ``, wantErr: true},
+		{name: "not json", contents: `password=hunter2`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeJSON([]byte(tc.contents), tc.pretty)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("normalizeJSON() got err = %v, want err = %v", err, tc.wantErr)
+			}
+			if string(got) != tc.want {
+				t.Errorf("normalizeJSON() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
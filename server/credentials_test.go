@@ -0,0 +1,187 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/auth"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// fakeProvider is a CredentialProvider for mounts matching applies. Its token
+// source fails with the provider name so tests can tell which one was used.
+type fakeProvider struct {
+	name    string
+	applies func(cfg *config.MountConfig) bool
+}
+
+func (p fakeProvider) Name() string { return p.name }
+
+func (p fakeProvider) Applies(cfg *config.MountConfig) bool { return p.applies(cfg) }
+
+func (p fakeProvider) TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error) {
+	return nil, fmt.Errorf("selected %s", p.name)
+}
+
+func TestMountCredentialProviderSelection(t *testing.T) {
+	providers := []auth.CredentialProvider{
+		fakeProvider{name: "provider-adc", applies: func(cfg *config.MountConfig) bool { return cfg.AuthProviderADC }},
+		fakeProvider{name: "any", applies: func(cfg *config.MountConfig) bool { return true }},
+	}
+
+	tests := []struct {
+		name      string
+		auth      string
+		providers []auth.CredentialProvider
+		want      string
+	}{
+		{name: "first applying provider", auth: "provider-adc", providers: providers, want: "selected provider-adc"},
+		{name: "precedence falls through", auth: "pod-adc", providers: providers, want: "selected any"},
+		{name: "no provider applies", auth: "pod-adc", providers: providers[:1], want: "no auth method configured"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{CredentialProviders: tc.providers}
+			_, err := s.Mount(context.Background(), &v1alpha1.MountRequest{
+				Attributes: `{
+					"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"token\"\n",
+					"auth": "` + tc.auth + `",
+					"csi.storage.k8s.io/pod.namespace": "default",
+					"csi.storage.k8s.io/pod.name": "mypod",
+					"csi.storage.k8s.io/pod.uid": "123",
+					"csi.storage.k8s.io/serviceAccount.name": "mysa"
+				}`,
+				Secrets:    "{}",
+				TargetPath: "/tmp/foo",
+				Permission: "420",
+			})
+			if status.Code(err) != codes.PermissionDenied || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Mount() got err = %v, want PermissionDenied containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// tokenProvider is a CredentialProvider applying to every mount with a
+// static token source.
+type tokenProvider struct {
+	name string
+}
+
+func (p tokenProvider) Name() string { return p.name }
+
+func (p tokenProvider) Applies(cfg *config.MountConfig) bool { return true }
+
+func (p tokenProvider) TokenSource(ctx context.Context, cfg *config.MountConfig) (oauth2.TokenSource, error) {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}), nil
+}
+
+func TestMountReportsIdentity(t *testing.T) {
+	t.Setenv("ALLOW_NODE_PUBLISH_SECRET", "true")
+	const key = `{"type": "service_account", "client_email": "key-sa@project.iam.gserviceaccount.com", "private_key": "secret-material"}`
+	tests := []struct {
+		name        string
+		auth        string
+		kubeSecrets string
+		secrets     string
+		want        []string
+	}{
+		{
+			name:        "node publish secret",
+			kubeSecrets: `{"key.json": ` + strconv.Quote(key) + `}`,
+			secrets:     `- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"token\"\n`,
+			want:        []string{`auth="nodePublishSecretRef"`, `principal="key-sa@project.iam.gserviceaccount.com"`, `provider="fake"`},
+		},
+		{
+			name:    "provider adc",
+			auth:    "provider-adc",
+			secrets: `- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"token\"\n`,
+			want:    []string{`auth="provider-adc"`, `principal=""`, `provider="fake"`},
+		},
+		{
+			name:    "pod adc",
+			auth:    "pod-adc",
+			secrets: `- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"token\"\n`,
+			want:    []string{`auth="pod-adc"`, `principal="default/mysa"`, `provider="fake"`, `impersonated=null`},
+		},
+		{
+			name:    "impersonation",
+			auth:    "pod-adc",
+			secrets: `- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"token\"\n  impersonateServiceAccount: \"reader@project.iam.gserviceaccount.com\"\n`,
+			want:    []string{`auth="pod-adc"`, `principal="default/mysa"`, `impersonated=["reader@project.iam.gserviceaccount.com"]`},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := captureLogs(t, 3)
+			s := &Server{
+				SecretClient:        mock(t, &mockSecretServer{}),
+				CredentialProviders: []auth.CredentialProvider{tokenProvider{name: "fake"}},
+			}
+			attributes := `{
+				"secrets": "` + tc.secrets + `",
+				"csi.storage.k8s.io/pod.namespace": "default",
+				"csi.storage.k8s.io/pod.name": "mypod",
+				"csi.storage.k8s.io/pod.uid": "123",
+				"csi.storage.k8s.io/serviceAccount.name": "mysa"`
+			if tc.auth != "" {
+				attributes += `, "auth": "` + tc.auth + `"`
+			}
+			kubeSecrets := tc.kubeSecrets
+			if kubeSecrets == "" {
+				kubeSecrets = "{}"
+			}
+			// The identity is reported before any secret is fetched, the
+			// canceled context keeps the mount from reaching Secret Manager.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			s.Mount(ctx, &v1alpha1.MountRequest{
+				Attributes: attributes + "}",
+				Secrets:    kubeSecrets,
+				TargetPath: "/tmp/foo",
+				Permission: "420",
+			})
+			klog.Flush()
+
+			var line string
+			for _, l := range strings.Split(b.String(), "\n") {
+				if strings.Contains(l, `"mount identity"`) {
+					line = l
+				}
+			}
+			if line == "" {
+				t.Fatalf("Mount() did not report the mount identity, logs:\n%s", b)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(line, want) {
+					t.Errorf("mount identity %s, want it to contain %s", line, want)
+				}
+			}
+			if strings.Contains(b.String(), "secret-material") {
+				t.Errorf("Mount() logged key material:\n%s", b)
+			}
+		})
+	}
+}
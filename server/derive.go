@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policies for file names derived from secret metadata that are not safe to
+// use as is.
+const (
+	// FileNameReject fails the mount.
+	FileNameReject = "reject"
+	// FileNameReplace replaces each unsafe character with an underscore.
+	FileNameReplace = "replace"
+)
+
+// deriveFileNames sets the file name of the secrets using FileNameFrom,
+// looking up the secret for label derived names. Derived names are sanitized
+// according to policy and may not collide with the file of another secret.
+func deriveFileNames(ctx context.Context, secrets []*config.Secret, policy string, client *secretmanager.Client, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption, budget *callBudget, callOpts []gax.CallOption) error {
+	derived := false
+	for _, secret := range secrets {
+		if secret.FileNameFrom == "" {
+			continue
+		}
+		var name string
+		if key, ok := strings.CutPrefix(secret.FileNameFrom, "label:"); ok {
+			secretClient, _, err := secretClientFor(ctx, secret.ResourceName, client, regionalClients, smOpts)
+			if err != nil {
+				return err
+			}
+			budget.spend(getSecretCost)
+			s, err := getSecret(ctx, secretClient, secret.ResourceName, callOpts)
+			if err != nil {
+				return err
+			}
+			if name, ok = s.GetLabels()[key]; !ok {
+				return status.Errorf(codes.FailedPrecondition, "secret %s has no label %q to name its file", secret.ResourceName, key)
+			}
+		} else {
+			r, err := parseResourceName(secret.ResourceName)
+			if err != nil {
+				return err
+			}
+			name = r.secret
+		}
+		fileName, err := sanitizeFileName(name, policy)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "file name derived for secret %s: %v", secret.ResourceName, err)
+		}
+		secret.FileName = fileName
+		derived = true
+	}
+	if !derived {
+		return nil
+	}
+
+	// Sanitizing may map different names to the same file, which must not
+	// silently overwrite another secret.
+	seen := make(map[string]*config.Secret, len(secrets))
+	for _, secret := range secrets {
+		p := path.Clean(secret.PathString())
+		if secret.PathString() == "" {
+			continue
+		}
+		if other, ok := seen[p]; ok && (other.FileNameFrom != "" || secret.FileNameFrom != "") {
+			return status.Errorf(codes.InvalidArgument, "secrets %s and %s are both written to %s", other.ResourceName, secret.ResourceName, p)
+		}
+		seen[p] = secret
+	}
+	return nil
+}
+
+// sanitizeFileName returns name when it only contains letters, digits, '.',
+// '_' and '-'. Other characters fail under FileNameReject, the default, and
+// become '_' under FileNameReplace.
+func sanitizeFileName(name, policy string) (string, error) {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			b.WriteRune(r)
+			continue
+		}
+		if policy != FileNameReplace {
+			return "", fmt.Errorf("%q contains unsafe character %q", name, r)
+		}
+		b.WriteByte('_')
+	}
+	out := b.String()
+	if out == "" || out == "." || out == ".." {
+		return "", fmt.Errorf("%q does not name a file", name)
+	}
+	return out, nil
+}
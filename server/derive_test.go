@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{name: "safe", in: "db-password_1.txt", policy: FileNameReject, want: "db-password_1.txt"},
+		{name: "reject slashes and spaces", in: "team/db password", policy: FileNameReject, wantErr: true},
+		{name: "default rejects", in: "a b", policy: "", wantErr: true},
+		{name: "replace slashes and spaces", in: "team/db password", policy: FileNameReplace, want: "team_db_password"},
+		{name: "replace non ascii", in: "clé", policy: FileNameReplace, want: "cl_"},
+		{name: "dot dot", in: "..", policy: FileNameReplace, wantErr: true},
+		{name: "empty", in: "", policy: FileNameReplace, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := sanitizeFileName(tc.in, tc.policy)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("sanitizeFileName(%q, %q) got err = %v, want err = %v", tc.in, tc.policy, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("sanitizeFileName(%q, %q) = %q, want %q", tc.in, tc.policy, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventFileNameFrom(t *testing.T) {
+	labels := map[string]string{
+		"projects/project/secrets/db": "team/db password",
+		"projects/project/secrets/a":  "x y",
+		"projects/project/secrets/b":  "x/y",
+	}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getSecretFn: func(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+			return &secretmanagerpb.Secret{Name: req.Name, Labels: map[string]string{"file": labels[req.Name]}}, nil
+		},
+	})
+	mount := func(policy string, secrets ...*config.Secret) ([]string, error) {
+		cfg := &config.MountConfig{
+			Secrets:     secrets,
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+		got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{FileNameSanitization: policy})
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, f := range got.Files {
+			paths = append(paths, f.Path)
+		}
+		return paths, nil
+	}
+
+	paths, err := mount(FileNameReplace,
+		&config.Secret{ResourceName: "projects/project/secrets/db/versions/1", FileNameFrom: "label:file"},
+		&config.Secret{ResourceName: "projects/project/secrets/api-key/versions/1", FileNameFrom: "secretId"},
+	)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if strings.Join(paths, ",") != "team_db_password,api-key" {
+		t.Errorf("handleMountEvent() paths = %v, want the sanitized label and the secret id", paths)
+	}
+
+	_, err = mount(FileNameReject, &config.Secret{ResourceName: "projects/project/secrets/db/versions/1", FileNameFrom: "label:file"})
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "unsafe character") {
+		t.Errorf("handleMountEvent() got err = %v, want the unsafe name rejected", err)
+	}
+
+	// "x y" and "x/y" are distinct labels but the same file once sanitized.
+	_, err = mount(FileNameReplace,
+		&config.Secret{ResourceName: "projects/project/secrets/a/versions/1", FileNameFrom: "label:file"},
+		&config.Secret{ResourceName: "projects/project/secrets/b/versions/1", FileNameFrom: "label:file"},
+	)
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "both written to x_y") {
+		t.Errorf("handleMountEvent() got err = %v, want the collision rejected", err)
+	}
+}
+
+func TestHandleMountEventFileNameFromLookups(t *testing.T) {
+	var mu sync.Mutex
+	lookups := 0
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getSecretFn: func(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			return &secretmanagerpb.Secret{Name: req.Name, Labels: map[string]string{"file": "db"}}, nil
+		},
+	})
+	mount := func(opts MountOptions) error {
+		lookups = 0
+		cfg := &config.MountConfig{
+			Secrets: []*config.Secret{
+				{ResourceName: "projects/project/secrets/db/versions/1", FileNameFrom: "label:file"},
+			},
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+		_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+		return err
+	}
+
+	// Rejected mounts do not look up the secret.
+	if err := mount(MountOptions{SameProject: "other"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("handleMountEvent() got err = %v, want code %v", err, codes.FailedPrecondition)
+	}
+	if lookups != 0 {
+		t.Errorf("GetSecret() calls = %d, want none before the mount is validated", lookups)
+	}
+
+	// The lookup spends from the budget, leaving nothing for the optional
+	// replication lookup.
+	if err := mount(MountOptions{CallBudget: 2, ReportReplication: true}); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if lookups != 1 {
+		t.Errorf("GetSecret() calls = %d, want 1 with the budget spent on the file name", lookups)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+)
+
+// destroyWithin returns when version is scheduled to be destroyed and whether
+// that is within window of now. Versions without a scheduled destruction are
+// never within the window.
+func destroyWithin(version *secretmanagerpb.SecretVersion, window time.Duration, now time.Time) (time.Time, bool) {
+	if version.GetScheduledDestroyTime() == nil {
+		return time.Time{}, false
+	}
+	at := version.GetScheduledDestroyTime().AsTime()
+	return at, at.Sub(now) <= window
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sort"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+)
+
+// versionDivergence is a secret fetched from several locations in one mount
+// that resolved to different versions.
+type versionDivergence struct {
+	// secret is the logical secret, projects/*/secrets/*/versions/* without
+	// a location.
+	secret string
+	// versions maps each location, "global" for the global endpoint, to the
+	// version it resolved to.
+	versions map[string]string
+}
+
+// divergentVersions compares the resolved versions of secrets referenced from
+// more than one location with the same project, id and version. Secrets that
+// were not fetched are ignored.
+func divergentVersions(secrets []*config.Secret, results []*secretmanagerpb.AccessSecretVersionResponse) []versionDivergence {
+	byLogical := make(map[string]map[string]string)
+	for i, secret := range secrets {
+		if results[i] == nil {
+			continue
+		}
+		name, err := parseResourceName(secret.ResourceName)
+		if err != nil {
+			continue
+		}
+		resolved, err := parseResourceName(results[i].GetName())
+		if err != nil {
+			continue
+		}
+		logical := "projects/" + name.project + "/secrets/" + name.secret + "/versions/" + name.version
+		loc := name.location
+		if loc == "" {
+			loc = globalLocation
+		}
+		if byLogical[logical] == nil {
+			byLogical[logical] = make(map[string]string)
+		}
+		byLogical[logical][loc] = resolved.version
+	}
+
+	var out []versionDivergence
+	for logical, versions := range byLogical {
+		seen := make(map[string]bool)
+		for _, v := range versions {
+			seen[v] = true
+		}
+		if len(seen) > 1 {
+			out = append(out, versionDivergence{secret: logical, versions: versions})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].secret < out[j].secret })
+	return out
+}
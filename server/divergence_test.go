@@ -0,0 +1,47 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDivergentVersions(t *testing.T) {
+	secrets := []*config.Secret{
+		{ResourceName: "projects/p/secrets/a/versions/latest"},
+		{ResourceName: "projects/p/locations/us-east1/secrets/a/versions/latest"},
+		{ResourceName: "projects/p/locations/us-east1/secrets/b/versions/latest"},
+		{ResourceName: "projects/p/locations/us-west1/secrets/b/versions/latest"},
+		{ResourceName: "projects/p/locations/us-west1/secrets/c/versions/latest"},
+	}
+	results := []*secretmanagerpb.AccessSecretVersionResponse{
+		{Name: "projects/p/secrets/a/versions/2"},
+		{Name: "projects/p/locations/us-east1/secrets/a/versions/1"},
+		{Name: "projects/p/locations/us-east1/secrets/b/versions/5"},
+		{Name: "projects/p/locations/us-west1/secrets/b/versions/5"},
+		nil,
+	}
+
+	want := []versionDivergence{
+		{secret: "projects/p/secrets/a/versions/latest", versions: map[string]string{"global": "2", "us-east1": "1"}},
+	}
+	if diff := cmp.Diff(want, divergentVersions(secrets, results), cmp.AllowUnexported(versionDivergence{})); diff != "" {
+		t.Errorf("divergentVersions() diff (-want +got):\n%s", diff)
+	}
+}
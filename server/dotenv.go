@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+)
+
+// parseDotenv parses KEY=VALUE lines. Blank lines, comments and an optional
+// "export " prefix are ignored and quoted values are unquoted.
+func parseDotenv(contents []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	for n, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid dotenv entry on line %d", n+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 {
+			switch {
+			case value[0] == '"' && value[len(value)-1] == '"':
+				value = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\$`, "$", `\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+			case value[0] == '\'' && value[len(value)-1] == '\'':
+				value = value[1 : len(value)-1]
+			}
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+// extractEnvKeys returns the ExtractEnvKeys of the secret from the dotenv
+// formatted contents as KEY=VALUE entries joined by ExtractEnvSeparator, or
+// each ended by it with TrailingSeparator.
+func extractEnvKeys(secret *config.Secret, contents []byte) ([]byte, error) {
+	env, err := parseDotenv(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	sep := secret.ExtractEnvSeparator
+	if sep == "" {
+		sep = "\n"
+	}
+
+	entries := make([]string, 0, len(secret.ExtractEnvKeys))
+	for _, key := range secret.ExtractEnvKeys {
+		value, ok := env[key]
+		if !ok {
+			if slices.Contains(secret.ExtractEnvOptionalKeys, key) {
+				continue
+			}
+			return nil, fmt.Errorf("missing key %q", key)
+		}
+		switch secret.ExtractEnvKeyCase {
+		case "":
+		case "upper":
+			key = strings.ToUpper(key)
+		case "lower":
+			key = strings.ToLower(key)
+		default:
+			return nil, fmt.Errorf("unsupported key case: %s", secret.ExtractEnvKeyCase)
+		}
+		entries = append(entries, key+"="+value)
+	}
+	out := strings.Join(entries, sep)
+	if secret.TrailingSeparator && len(entries) > 0 {
+		out += sep
+	}
+	return []byte(out), nil
+}
+
+// envEntry is a line of the MountConfig.EmitEnvFile file.
+type envEntry struct {
+	key   string
+	value []byte
+}
+
+// envFile formats entries as KEY=VALUE lines parseDotenv reads back.
+func envFile(entries []envEntry) []byte {
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.key)
+		b.WriteByte('=')
+		b.WriteString(envValue(e.value))
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// envValue quotes a dotenv value when needed. Plain values are written as is,
+// values without quotes or newlines are single quoted so nothing is expanded
+// and the rest are double quoted with backslash escapes, "$" included for the
+// same reason. Binary values are base64 encoded like in the combined JSON
+// file.
+func envValue(contents []byte) string {
+	if !utf8.Valid(contents) {
+		return combinedValue(contents)
+	}
+	v := string(contents)
+	if v != "" && strings.Trim(v, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-.,:/@%+=") == "" {
+		return v
+	}
+	if !strings.ContainsAny(v, "'\n\r") {
+		return "'" + v + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`).Replace(v) + `"`
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/testing/protocmp"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const testDotenv = `# database settings
+db_user=admin
+export db_pass="p@ss\"word"
+db_host = 'localhost'
+`
+
+func TestParseDotenv(t *testing.T) {
+	got, err := parseDotenv([]byte(testDotenv))
+	if err != nil {
+		t.Fatalf("parseDotenv() got err = %v, want nil", err)
+	}
+	want := map[string]string{"db_user": "admin", "db_pass": `p@ss"word`, "db_host": "localhost"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("parseDotenv()[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+	if _, err := parseDotenv([]byte("not an entry")); err == nil {
+		t.Errorf("parseDotenv() got err = nil, want error for malformed line")
+	}
+}
+
+func TestHandleMountEventExtractEnvKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  *config.Secret
+		want    string
+		wantErr string
+	}{
+		{
+			name: "multiple keys with formatting",
+			secret: &config.Secret{
+				ExtractEnvKeys:      []string{"db_user", "db_pass"},
+				ExtractEnvSeparator: ";",
+				ExtractEnvKeyCase:   "upper",
+			},
+			want: `DB_USER=admin;DB_PASS=p@ss"word`,
+		},
+		{
+			name: "trailing separator",
+			secret: &config.Secret{
+				ExtractEnvKeys:    []string{"db_user", "db_host"},
+				TrailingSeparator: true,
+			},
+			want: "db_user=admin\ndb_host=localhost\n",
+		},
+		{
+			name: "optional missing key",
+			secret: &config.Secret{
+				ExtractEnvKeys:         []string{"db_port", "db_host"},
+				ExtractEnvOptionalKeys: []string{"db_port"},
+			},
+			want: "db_host=localhost",
+		},
+		{
+			name: "missing key",
+			secret: &config.Secret{
+				ExtractEnvKeys: []string{"db_user", "db_port"},
+			},
+			wantErr: `missing key "db_port"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.secret.ResourceName = "projects/project/secrets/test/versions/1"
+			tt.secret.FileName = "db.env"
+			cfg := &config.MountConfig{
+				Secrets:     []*config.Secret{tt.secret},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name: "projects/project/secrets/test/versions/1",
+						Payload: &secretmanagerpb.SecretPayload{
+							Data: []byte(testDotenv),
+						},
+					}, nil
+				},
+			})
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("handleMountEvent() got err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if string(got.Files[0].Contents) != tt.want {
+				t.Errorf("handleMountEvent() got contents = %q, want %q", got.Files[0].Contents, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvFileRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"PLAIN":     "s3cr3t_value-1.2:/@%+=",
+		"EMPTY":     "",
+		"SPACES":    "  padded value  ",
+		"DOLLAR":    "pa$$word `whoami`",
+		"HASH":      "value # not a comment",
+		"QUOTES":    `it's "quoted"`,
+		"BACKSLASH": `C:\path\n`,
+		"NEWLINES":  "-----BEGIN KEY-----\nabc\n-----END KEY-----\n",
+		"CRLF":      "line one\r\nline two\r\n",
+		"CR":        "trailing\r",
+		"EXPANSION": "it's $HOME and ${USER}",
+	}
+	var entries []envEntry
+	for k, v := range values {
+		entries = append(entries, envEntry{key: k, value: []byte(v)})
+	}
+	file := envFile(entries)
+	for _, want := range []string{`EXPANSION="it's \$HOME and \${USER}"`, `CR="trailing\r"`} {
+		if !strings.Contains(string(file), want) {
+			t.Errorf("envFile() = %s, want it to contain %s", file, want)
+		}
+	}
+	got, err := parseDotenv(file)
+	if err != nil {
+		t.Fatalf("parseDotenv() got err = %v, want nil", err)
+	}
+	if diff := cmp.Diff(values, got); diff != "" {
+		t.Errorf("parseDotenv(envFile()) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleMountEventEmitEnvFile(t *testing.T) {
+	payloads := map[string][]byte{
+		"projects/project/secrets/user/versions/1":   []byte("admin"),
+		"projects/project/secrets/pass/versions/1":   []byte(`p@ss "word"` + "\n"),
+		"projects/project/secrets/binary/versions/1": {0xff, 0x00, 0xfe},
+		"projects/project/secrets/file/versions/1":   []byte("on disk"),
+	}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: payloads[req.Name]},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/user/versions/1", EnvKey: "DB_USER"},
+			{ResourceName: "projects/project/secrets/pass/versions/1", EnvKey: "DB_PASSWORD"},
+			{ResourceName: "projects/project/secrets/binary/versions/1", EnvKey: "BLOB"},
+			{ResourceName: "projects/project/secrets/file/versions/1", FileName: "file.txt"},
+		},
+		EmitEnvFile: "app.env",
+		Permissions: 0640,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := []*v1alpha1.File{
+		{Path: "file.txt", Mode: 0640, Contents: []byte("on disk")},
+		{Path: "app.env", Mode: 0640, Contents: []byte("DB_USER=admin\nDB_PASSWORD=\"p@ss \\\"word\\\"\\n\"\nBLOB=/wD+\n")},
+	}
+	if diff := cmp.Diff(want, got.GetFiles(), protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() files diff (-want +got):\n%s", diff)
+	}
+	if n := len(got.GetObjectVersion()); n != 4 {
+		t.Errorf("handleMountEvent() got %d object versions, want 4", n)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/status"
+)
+
+// Formats of the message of mount errors aggregating per-secret failures.
+const (
+	// ErrorFormatText joins the failure messages with commas.
+	ErrorFormatText = "text"
+	// ErrorFormatJSON encodes the failures as a JSON array of secretFailure.
+	ErrorFormatJSON = "json"
+)
+
+// secretFailure is a failed secret in a mount error message with
+// ErrorFormatJSON.
+type secretFailure struct {
+	// Secret is the resource name of the secret.
+	Secret string `json:"secret"`
+	// Code is the name of the gRPC code of the failure, e.g. NotFound.
+	Code string `json:"code"`
+	// Message is the message of the failure without the code.
+	Message string `json:"message"`
+}
+
+// jsonFailures encodes the failures of the named secrets. Secrets without a
+// failure are left out.
+func jsonFailures(names []string, errs []error) string {
+	failures := make([]secretFailure, 0, len(errs))
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		s := status.Convert(err)
+		failures = append(failures, secretFailure{Secret: names[i], Code: s.Code().String(), Message: s.Message()})
+	}
+	b, _ := json.Marshal(failures)
+	return string(b)
+}
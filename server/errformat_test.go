@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventErrorFormat(t *testing.T) {
+	const (
+		missing = "projects/project/secrets/missing/versions/1"
+		denied  = "projects/project/secrets/denied/versions/1"
+		good    = "projects/project/secrets/good/versions/1"
+	)
+	mountErr := func(t *testing.T, format string) error {
+		t.Helper()
+		client := mock(t, &mockSecretServer{
+			accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+				switch req.Name {
+				case missing:
+					return nil, status.Error(codes.NotFound, "secret not found")
+				case denied:
+					return nil, status.Error(codes.PermissionDenied, "permission denied")
+				}
+				return &secretmanagerpb.AccessSecretVersionResponse{
+					Name:    req.Name,
+					Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+				}, nil
+			},
+		})
+		cfg := &config.MountConfig{
+			Secrets: []*config.Secret{
+				{ResourceName: missing, FileName: "missing.txt"},
+				{ResourceName: good, FileName: "good.txt"},
+				{ResourceName: denied, FileName: "denied.txt"},
+			},
+			Permissions: 0640,
+			PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+		}
+		_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ErrorFormat: format})
+		if err == nil {
+			t.Fatalf("handleMountEvent() got err = nil, want failures")
+		}
+		return err
+	}
+
+	t.Run("text", func(t *testing.T) {
+		err := mountErr(t, "")
+		for _, want := range []string{"secret not found", "permission denied"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("handleMountEvent() got err = %v, want it to contain %q", err, want)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		err := mountErr(t, ErrorFormatJSON)
+		var got []secretFailure
+		if err := json.Unmarshal([]byte(status.Convert(err).Message()), &got); err != nil {
+			t.Fatalf("failed to parse error message %q: %v", status.Convert(err).Message(), err)
+		}
+		want := []secretFailure{
+			{Secret: missing, Code: "NotFound", Message: "secret not found"},
+			{Secret: denied, Code: "PermissionDenied", Message: "permission denied"},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("handleMountEvent() failures diff (-want +got):\n%s", diff)
+		}
+		if n := len(status.Convert(err).Details()); n != 2 {
+			t.Errorf("handleMountEvent() got %d error details, want 2", n)
+		}
+	})
+}
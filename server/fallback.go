@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// accessFallbacks retries secret in each of its fallback projects after the
+// access in its own project failed with primaryErr. Only NotFound and
+// Unavailable fail over, any other error is returned as is. When every
+// project fails the error lists each attempt.
+func accessFallbacks(ctx context.Context, client *secretmanager.Client, secret *config.Secret, primaryErr error, limiter *AdaptiveLimiter, callOpts []gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	if !failsOver(primaryErr) {
+		return nil, primaryErr
+	}
+	attempts := []string{fmt.Sprintf("%s: %v", secret.ResourceName, primaryErr)}
+	lastErr := primaryErr
+	for _, project := range secret.FallbackProjects {
+		name := fallbackResource(secret.ResourceName, project)
+		resp, err := accessSecretVersion(ctx, client, name, limiter, callOpts)
+		if err == nil {
+			klog.InfoS("secret served from fallback project", "resource_name", secret.ResourceName, "fallback", name)
+			return resp, nil
+		}
+		attempts = append(attempts, fmt.Sprintf("%s: %v", name, err))
+		lastErr = err
+		if !failsOver(err) {
+			break
+		}
+	}
+	return nil, status.Errorf(status.Code(lastErr), "all projects failed for secret %s: %s", secret.ResourceName, strings.Join(attempts, "; "))
+}
+
+// replica is a copy of a regional secret in another location along with the
+// client serving that location.
+type replica struct {
+	name   string
+	client *secretmanager.Client
+}
+
+// replicasFor returns the replicas of secret in each of its replica
+// locations. Clients for new locations are created and cached in
+// regionalClients, so it must not run concurrently with other users of the
+// map.
+func replicasFor(ctx context.Context, secret *config.Secret, client *secretmanager.Client, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption) ([]replica, error) {
+	r, err := parseResourceName(secret.ResourceName)
+	if err != nil {
+		return nil, err
+	}
+	if r.location == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "secret %s can not use replica locations: it is not a regional secret", secret.ResourceName)
+	}
+	var replicas []replica
+	for _, loc := range secret.ReplicaLocations {
+		name := replicaName(r, loc)
+		replicaClient, _, err := secretClientFor(ctx, name, client, regionalClients, smOpts)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, replica{name: name, client: replicaClient})
+	}
+	return replicas, nil
+}
+
+// replicaName returns the name of the secret version r in location loc.
+func replicaName(r resourceName, loc string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/secrets/%s/versions/%s", r.project, loc, r.secret, r.version)
+}
+
+// checkReplicaLocations rejects replica locations of secret missing from
+// known. Secrets that are not regional are left to replicasFor.
+func checkReplicaLocations(secret *config.Secret, known []string) error {
+	if len(secret.ReplicaLocations) == 0 {
+		return nil
+	}
+	r, err := parseResourceName(secret.ResourceName)
+	if err != nil || r.location == "" {
+		return nil
+	}
+	for _, loc := range secret.ReplicaLocations {
+		if err := checkLocation(replicaName(r, loc), known); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accessReplicas retries secret in each of its replica locations after the
+// access in its own location failed with primaryErr. Like accessFallbacks
+// only NotFound and Unavailable fail over and the error lists each attempt
+// when every location fails.
+func accessReplicas(ctx context.Context, secret *config.Secret, replicas []replica, primaryErr error, limiter *AdaptiveLimiter, callOpts []gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	if !failsOver(primaryErr) {
+		return nil, primaryErr
+	}
+	attempts := []string{fmt.Sprintf("%s: %v", secret.ResourceName, primaryErr)}
+	lastErr := primaryErr
+	for _, r := range replicas {
+		resp, err := accessSecretVersion(ctx, r.client, r.name, limiter, callOpts)
+		if err == nil {
+			klog.InfoS("secret served from replica location", "resource_name", secret.ResourceName, "replica", r.name)
+			return resp, nil
+		}
+		attempts = append(attempts, fmt.Sprintf("%s: %v", r.name, err))
+		lastErr = err
+		if !failsOver(err) {
+			break
+		}
+	}
+	return nil, status.Errorf(status.Code(lastErr), "all locations failed for secret %s: %s", secret.ResourceName, strings.Join(attempts, "; "))
+}
+
+// failsOver reports whether err allows trying the next fallback project.
+func failsOver(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound, codes.Unavailable:
+		return true
+	}
+	return false
+}
+
+// fallbackResource returns resource with its project replaced by project.
+func fallbackResource(resource, project string) string {
+	parts := strings.SplitN(resource, "/", 3)
+	if len(parts) < 3 {
+		return resource
+	}
+	return parts[0] + "/" + project + "/" + parts[2]
+}
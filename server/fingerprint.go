@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// certFingerprintSHA256 replaces a PEM or DER encoded certificate with its
+// SHA256 fingerprint, formatted according to in.format.
+func certFingerprintSHA256(in transformInput) ([]transformedFile, error) {
+	der := in.contents
+	if block, _ := pem.Decode(in.contents); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unsupported PEM block %q, want CERTIFICATE", block.Type)
+		}
+		der = block.Bytes
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		return nil, fmt.Errorf("secret is not a PEM or DER encoded certificate: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+	var fingerprint string
+	switch in.format {
+	case "", "colon-upper":
+		fingerprint = strings.ToUpper(colonHex(sum[:]))
+	case "colon-lower":
+		fingerprint = colonHex(sum[:])
+	case "upper":
+		fingerprint = strings.ToUpper(hex.EncodeToString(sum[:]))
+	case "lower":
+		fingerprint = hex.EncodeToString(sum[:])
+	default:
+		return nil, fmt.Errorf("unknown fingerprint format %q, supported formats are colon-upper, colon-lower, upper and lower", in.format)
+	}
+	return []transformedFile{{path: in.path, contents: []byte(fingerprint)}}, nil
+}
+
+// colonHex encodes b as lowercase hex pairs separated by colons.
+func colonHex(b []byte) string {
+	pairs := make([]string, len(b))
+	for i, c := range b {
+		pairs[i] = hex.EncodeToString([]byte{c})
+	}
+	return strings.Join(pairs, ":")
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed DER encoded certificate.
+func testCertificate(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertFingerprintSHA256(t *testing.T) {
+	der := testCertificate(t)
+	sum := sha256.Sum256(der)
+	lower := hex.EncodeToString(sum[:])
+	var pairs []string
+	for i := 0; i < len(lower); i += 2 {
+		pairs = append(pairs, lower[i:i+2])
+	}
+	colon := strings.Join(pairs, ":")
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	tests := []struct {
+		name     string
+		contents []byte
+		format   string
+		want     string
+	}{
+		{name: "pem default", contents: pemCert, want: strings.ToUpper(colon)},
+		{name: "der default", contents: der, want: strings.ToUpper(colon)},
+		{name: "colon lower", contents: pemCert, format: "colon-lower", want: colon},
+		{name: "upper", contents: der, format: "upper", want: strings.ToUpper(lower)},
+		{name: "lower", contents: pemCert, format: "lower", want: lower},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			files, err := transform("cert-fingerprint-sha256", transformInput{path: "tls/fingerprint", contents: tc.contents, format: tc.format})
+			if err != nil {
+				t.Fatalf("transform() got err = %v, want nil", err)
+			}
+			if len(files) != 1 || files[0].path != "tls/fingerprint" {
+				t.Fatalf("transform() got %d files, want tls/fingerprint only", len(files))
+			}
+			if got := string(files[0].contents); got != tc.want {
+				t.Errorf("transform() got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCertFingerprintSHA256Errors(t *testing.T) {
+	der := testCertificate(t)
+	tests := []struct {
+		name     string
+		contents []byte
+		format   string
+		want     string
+	}{
+		{name: "not a certificate", contents: []byte("hunter2"), want: "not a PEM or DER encoded certificate"},
+		{name: "pem key", contents: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}), want: `unsupported PEM block "PRIVATE KEY"`},
+		{name: "bad format", contents: der, format: "base64", want: `unknown fingerprint format "base64"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := transform("cert-fingerprint-sha256", transformInput{path: "fingerprint", contents: tc.contents, format: tc.format})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("transform() got err = %v, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// placeholderVersion is the ObjectVersion of a placeholder, so that the
+// driver rotates it once the gate opens and the secret is fetched.
+const placeholderVersion = "placeholder"
+
+// gateOpen reports whether the pod carries the gate annotation of cfg. A gate
+// of the form "key=value" also requires the annotation to have the value.
+func gateOpen(cfg *config.MountConfig) bool {
+	key, value, hasValue := strings.Cut(cfg.GateAnnotation, "=")
+	got, ok := cfg.PodInfo.Annotations[key]
+	return ok && (!hasValue || got == value)
+}
+
+// placeholderResponse is the response of a mount whose gate is closed: each
+// secret with a placeholder is replaced by it, the others are skipped.
+func placeholderResponse(cfg *config.MountConfig) (*v1alpha1.MountResponse, error) {
+	if cfg.Permissions > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid file permission %d", cfg.Permissions)
+	}
+	out := &v1alpha1.MountResponse{}
+	for _, secret := range cfg.Secrets {
+		if secret.Placeholder == "" {
+			continue
+		}
+		// #nosec G115 Checking limit
+		mode := int32(cfg.Permissions)
+		if secret.Mode != nil {
+			mode = *secret.Mode
+		}
+		out.Files = append(out.Files, &v1alpha1.File{
+			Path:     secret.PathString(),
+			Mode:     mode,
+			Contents: []byte(secret.Placeholder),
+		})
+		out.ObjectVersion = append(out.ObjectVersion, &v1alpha1.ObjectVersion{
+			Id:      secret.ResourceName,
+			Version: placeholderVersion,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/auth"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestHandleMountEventGateAnnotation(t *testing.T) {
+	const withPlaceholder = "projects/project/secrets/db/versions/1"
+	const skipped = "projects/project/secrets/api/versions/1"
+
+	tests := []struct {
+		name        string
+		gate        string
+		annotations map[string]string
+		wantCalls   int32
+		want        *v1alpha1.MountResponse
+	}{
+		{
+			name:        "gate present",
+			gate:        "rollout.example.com/secrets",
+			annotations: map[string]string{"rollout.example.com/secrets": ""},
+			wantCalls:   2,
+			want: &v1alpha1.MountResponse{
+				Files: []*v1alpha1.File{
+					{Path: "db.txt", Mode: 0640, Contents: []byte("My Secret")},
+					{Path: "api.txt", Mode: 0640, Contents: []byte("My Secret")},
+				},
+				ObjectVersion: []*v1alpha1.ObjectVersion{
+					{Id: withPlaceholder, Version: withPlaceholder},
+					{Id: skipped, Version: skipped},
+				},
+			},
+		},
+		{
+			name:        "gate absent",
+			gate:        "rollout.example.com/secrets",
+			annotations: map[string]string{"other": "true"},
+			want: &v1alpha1.MountResponse{
+				Files: []*v1alpha1.File{
+					{Path: "db.txt", Mode: 0640, Contents: []byte("pending")},
+				},
+				ObjectVersion: []*v1alpha1.ObjectVersion{
+					{Id: withPlaceholder, Version: placeholderVersion},
+				},
+			},
+		},
+		{
+			name:        "gate value mismatch",
+			gate:        "rollout.example.com/secrets=enabled",
+			annotations: map[string]string{"rollout.example.com/secrets": "disabled"},
+			want: &v1alpha1.MountResponse{
+				Files: []*v1alpha1.File{
+					{Path: "db.txt", Mode: 0640, Contents: []byte("pending")},
+				},
+				ObjectVersion: []*v1alpha1.ObjectVersion{
+					{Id: withPlaceholder, Version: placeholderVersion},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					calls.Add(1)
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: withPlaceholder, FileName: "db.txt", Placeholder: "pending"},
+					{ResourceName: skipped, FileName: "api.txt"},
+				},
+				GateAnnotation: tc.gate,
+				Permissions:    0640,
+				PodInfo: &config.PodInfo{
+					Namespace:   "default",
+					Name:        "test-pod",
+					Annotations: tc.annotations,
+				},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("handleMountEvent() diff (-want +got):\n%s", diff)
+			}
+			if calls.Load() != tc.wantCalls {
+				t.Errorf("AccessSecretVersion() calls = %d, want %d", calls.Load(), tc.wantCalls)
+			}
+		})
+	}
+}
+
+// fakePods is a PodMetadataSource returning fixed metadata.
+type fakePods struct {
+	meta *metav1.ObjectMeta
+	err  error
+}
+
+func (f fakePods) PodMetadata(ctx context.Context, namespace, name string) (*metav1.ObjectMeta, error) {
+	return f.meta, f.err
+}
+
+func TestMountGateAnnotationLookup(t *testing.T) {
+	req := &v1alpha1.MountRequest{
+		Attributes: `{
+			"secrets": "- resourceName: \"projects/project/secrets/test/versions/1\"\n  fileName: \"test.txt\"\n  placeholder: \"pending\"\n",
+			"gateAnnotation": "rollout.example.com/secrets",
+			"auth": "provider-adc",
+			"csi.storage.k8s.io/pod.namespace": "default",
+			"csi.storage.k8s.io/pod.name": "mypod",
+			"csi.storage.k8s.io/pod.uid": "123",
+			"csi.storage.k8s.io/serviceAccount.name": "mysa"
+		}`,
+		Secrets:    "{}",
+		TargetPath: "/tmp/foo",
+		Permission: "420",
+	}
+	// Selecting a credential provider fails the mount right after the
+	// annotations are looked up.
+	providers := []auth.CredentialProvider{fakeProvider{name: "adc", applies: func(*config.MountConfig) bool { return true }}}
+
+	tests := []struct {
+		name     string
+		source   PodMetadataSource
+		wantCode codes.Code
+	}{
+		{name: "not configured", wantCode: codes.FailedPrecondition},
+		{name: "lookup failure", source: fakePods{err: errors.New("forbidden")}, wantCode: codes.Unavailable},
+		{name: "lookup success", source: fakePods{meta: &metav1.ObjectMeta{}}, wantCode: codes.PermissionDenied},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{CredentialProviders: providers, Pods: tc.source}
+			if _, err := s.Mount(context.Background(), req); status.Code(err) != tc.wantCode {
+				t.Errorf("Mount() got err = %v, want code %v", err, tc.wantCode)
+			}
+		})
+	}
+}
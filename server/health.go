@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// minReadySamples is the number of fetches within the window below which the
+// error rate is not trusted and the provider stays ready.
+const minReadySamples = 5
+
+// ErrorRateTracker reports the provider not ready while the share of secret
+// fetches failing against Secret Manager within a rolling window exceeds a
+// threshold, and ready again once it drops back.
+type ErrorRateTracker struct {
+	window    time.Duration
+	threshold float64
+	now       func() time.Time
+
+	mu      sync.Mutex
+	fetches []fetchOutcome
+	ready   bool
+}
+
+// fetchOutcome is a secret fetch recorded by an ErrorRateTracker.
+type fetchOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// NewErrorRateTracker returns a tracker over window that reports not ready
+// above threshold, a fraction between 0 and 1.
+func NewErrorRateTracker(window time.Duration, threshold float64) *ErrorRateTracker {
+	return &ErrorRateTracker{window: window, threshold: threshold, now: time.Now, ready: true}
+}
+
+// record adds the outcome of a secret fetch, doing nothing for a nil tracker.
+// Only errors pointing at Secret Manager itself, rather than at the mount
+// configuration or permissions, count as failures.
+func (t *ErrorRateTracker) record(err error) {
+	if t == nil {
+		return
+	}
+	failed := false
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted:
+		failed = true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.prune(now)
+	t.fetches = append(t.fetches, fetchOutcome{at: now, failed: failed})
+}
+
+// prune drops the fetches recorded before the window ending at now, so that
+// the tracker does not grow while nobody asks for readiness.
+func (t *ErrorRateTracker) prune(now time.Time) {
+	cutoff := now.Add(-t.window)
+	i := 0
+	for i < len(t.fetches) && t.fetches[i].at.Before(cutoff) {
+		i++
+	}
+	t.fetches = slices.Delete(t.fetches, 0, i)
+}
+
+// Ready reports whether the error rate within the window is at most the
+// threshold, along with the rate.
+func (t *ErrorRateTracker) Ready() (bool, float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(t.now())
+
+	failed := 0
+	for _, f := range t.fetches {
+		if f.failed {
+			failed++
+		}
+	}
+	var rate float64
+	if len(t.fetches) > 0 {
+		rate = float64(failed) / float64(len(t.fetches))
+	}
+	ready := len(t.fetches) < minReadySamples || rate <= t.threshold
+	if ready != t.ready {
+		klog.InfoS("provider readiness changed", "ready", ready, "error_rate", rate, "fetches", len(t.fetches), "window", t.window)
+		t.ready = ready
+	}
+	return ready, rate
+}
+
+// ServeHTTP implements a readiness endpoint, always ready for a nil tracker.
+func (t *ErrorRateTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if ready, rate := t.Ready(); !ready {
+		http.Error(w, fmt.Sprintf("secret manager error rate %.2f exceeds %.2f over %v", rate, t.threshold, t.window), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
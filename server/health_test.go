@@ -0,0 +1,176 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorRateTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewErrorRateTracker(time.Minute, 0.5)
+	tracker.now = func() time.Time { return now }
+
+	readyCode := func() int {
+		w := httptest.NewRecorder()
+		tracker.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+
+	// Failures below the minimum number of samples are not trusted.
+	for i := 0; i < minReadySamples-1; i++ {
+		tracker.record(status.Error(codes.Unavailable, "unavailable"))
+	}
+	if got := readyCode(); got != http.StatusOK {
+		t.Errorf("ready with too few samples = %d, want %d", got, http.StatusOK)
+	}
+
+	// Configuration errors are not Secret Manager failures.
+	tracker.record(status.Error(codes.NotFound, "not found"))
+	tracker.record(nil)
+	if ready, rate := tracker.Ready(); ready {
+		t.Errorf("Ready() = true at rate %v, want false above the threshold", rate)
+	}
+	if got := readyCode(); got != http.StatusServiceUnavailable {
+		t.Errorf("ready above threshold = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+
+	// Successes bring the rate back under the threshold.
+	for i := 0; i < 3; i++ {
+		tracker.record(nil)
+	}
+	if ready, rate := tracker.Ready(); !ready || rate != 4.0/9 {
+		t.Errorf("Ready() = %v, %v, want true, %v", ready, rate, 4.0/9)
+	}
+
+	// Failures leave the window.
+	for i := 0; i < 10; i++ {
+		tracker.record(status.Error(codes.DeadlineExceeded, "deadline"))
+	}
+	if ready, _ := tracker.Ready(); ready {
+		t.Errorf("Ready() = true, want false after a burst of failures")
+	}
+	now = now.Add(2 * time.Minute)
+	if got := readyCode(); got != http.StatusOK {
+		t.Errorf("ready after the window = %d, want %d", got, http.StatusOK)
+	}
+
+	// Recording alone drops the fetches outside the window.
+	for i := 0; i < 10; i++ {
+		tracker.record(nil)
+	}
+	now = now.Add(2 * time.Minute)
+	tracker.record(nil)
+	if len(tracker.fetches) != 1 {
+		t.Errorf("tracker holds %d fetches, want 1 after the window passed", len(tracker.fetches))
+	}
+
+	var disabled *ErrorRateTracker
+	w := httptest.NewRecorder()
+	disabled.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("ready without tracker = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHandleMountEventRecordsErrorRate(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return nil, status.Error(codes.Internal, "backend error")
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	tracker := NewErrorRateTracker(time.Minute, 0.5)
+	for i := 0; i < minReadySamples; i++ {
+		if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ErrorRate: tracker, DefaultRetryPolicy: RetryPolicy{MaxAttempts: 1}}); err == nil {
+			t.Fatalf("handleMountEvent() got err = nil, want an error")
+		}
+	}
+	if ready, rate := tracker.Ready(); ready || rate != 1 {
+		t.Errorf("Ready() = %v, %v, want false, 1", ready, rate)
+	}
+}
+
+func TestHandleMountEventRecordsFinalOutcome(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if strings.Contains(req.Name, "/optional/") {
+				return nil, status.Error(codes.Unavailable, "backend error")
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getSecretFn: func(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+			return nil, status.Error(codes.Unavailable, "backend error")
+		},
+	})
+	mount := func(tracker *ErrorRateTracker, secrets ...*config.Secret) error {
+		cfg := &config.MountConfig{
+			Secrets:     secrets,
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+		_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ErrorRate: tracker, DefaultRetryPolicy: RetryPolicy{MaxAttempts: 1}})
+		return err
+	}
+
+	// Skipped optional secrets do not count as failures.
+	tracker := NewErrorRateTracker(time.Minute, 0.5)
+	for i := 0; i < minReadySamples; i++ {
+		if err := mount(tracker, &config.Secret{ResourceName: "projects/project/secrets/optional/versions/1", FileName: "optional.txt", Optional: true}); err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+		}
+	}
+	if ready, rate := tracker.Ready(); !ready || rate != 0 {
+		t.Errorf("Ready() = %v, %v, want true, 0", ready, rate)
+	}
+
+	// Mounts failing before any secret is fetched are recorded once.
+	tracker = NewErrorRateTracker(time.Minute, 0.5)
+	for i := 0; i < minReadySamples; i++ {
+		if err := mount(tracker, &config.Secret{ResourceName: "projects/project/secrets/test/versions/1", FileNameFrom: "label:file"}); status.Code(err) != codes.Unavailable {
+			t.Fatalf("handleMountEvent() got err = %v, want code %v", err, codes.Unavailable)
+		}
+	}
+	if ready, rate := tracker.Ready(); ready || rate != 1 || len(tracker.fetches) != minReadySamples {
+		t.Errorf("Ready() = %v, %v with %d fetches, want false, 1 with %d", ready, rate, len(tracker.fetches), minReadySamples)
+	}
+}
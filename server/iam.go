@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// logIAMPolicySummary logs who has access to the secret owning version, to
+// help debug a PermissionDenied access. The diagnosis is best effort: the
+// provider usually lacks secretmanager.secrets.getIamPolicy, in which case
+// only that failure is logged.
+func logIAMPolicySummary(ctx context.Context, client *secretmanager.Client, version string, callOpts []gax.CallOption, pod klog.ObjectRef) {
+	name, _, _ := strings.Cut(version, "/versions/")
+
+	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_get_iam_policy_requests")
+	policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: name}, callOpts...)
+	if err != nil {
+		if e, ok := status.FromError(err); ok {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+		}
+		klog.InfoS("unable to fetch the IAM policy to diagnose denied access, grant secretmanager.secrets.getIamPolicy to the provider to enable it", "resource_name", name, "err", err, "pod", pod)
+		return
+	}
+	smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+	klog.InfoS("access denied, IAM bindings of the secret", "resource_name", name, "bindings", iamPolicySummary(policy), "pod", pod)
+}
+
+// iamPolicySummary describes each binding of policy as its role followed by
+// its redacted members. Conditional bindings are marked with the condition
+// title.
+func iamPolicySummary(policy *iampb.Policy) []string {
+	var out []string
+	for _, b := range policy.GetBindings() {
+		members := make([]string, 0, len(b.GetMembers()))
+		for _, m := range b.GetMembers() {
+			members = append(members, redactMember(m))
+		}
+		role := b.GetRole()
+		if c := b.GetCondition(); c != nil {
+			role = fmt.Sprintf("%s (if %q)", role, c.GetTitle())
+		}
+		out = append(out, fmt.Sprintf("%s: %s", role, strings.Join(members, ", ")))
+	}
+	return out
+}
+
+// redactMember keeps the type and domain of an IAM member and the first
+// character of its name, e.g. "user:a***@example.com". Members without an
+// email, such as allUsers, are kept as is.
+func redactMember(member string) string {
+	kind, id, ok := strings.Cut(member, ":")
+	if !ok {
+		return member
+	}
+	local, domain, ok := strings.Cut(id, "@")
+	if !ok || local == "" {
+		return kind + ":***"
+	}
+	return fmt.Sprintf("%s:%s***@%s", kind, local[:1], domain)
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventDiagnoseAccessDenied(t *testing.T) {
+	const secret = "projects/project/secrets/test/versions/1"
+
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{
+				Role:    "roles/secretmanager.secretAccessor",
+				Members: []string{"user:alice@example.com", "serviceAccount:app@project.iam.gserviceaccount.com"},
+			},
+			{
+				Role:      "roles/secretmanager.admin",
+				Members:   []string{"group:admins@example.com"},
+				Condition: &expr.Expr{Title: "office hours"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		diagnose  bool
+		policyErr error
+		want      []string
+		wantCalls int32
+	}{
+		{
+			name:      "policy summary",
+			diagnose:  true,
+			want:      []string{"access denied, IAM bindings of the secret", `roles/secretmanager.secretAccessor: user:a***@example.com, serviceAccount:a***@project.iam.gserviceaccount.com`, `roles/secretmanager.admin (if \"office hours\"): group:a***@example.com`},
+			wantCalls: 1,
+		},
+		{
+			name:      "missing getIamPolicy permission",
+			diagnose:  true,
+			policyErr: status.Error(codes.PermissionDenied, "getIamPolicy denied"),
+			want:      []string{"unable to fetch the IAM policy to diagnose denied access"},
+			wantCalls: 1,
+		},
+		{name: "off by default"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := captureLogs(t, 0)
+			var policyCalls atomic.Int32
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return nil, status.Error(codes.PermissionDenied, "permission denied")
+				},
+				getPolicyFn: func(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+					policyCalls.Add(1)
+					if req.GetResource() != "projects/project/secrets/test" {
+						return nil, status.Errorf(codes.InvalidArgument, "unexpected resource %s", req.GetResource())
+					}
+					return policy, tc.policyErr
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: secret, FileName: "good1.txt"},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{DiagnoseAccessDenied: tc.diagnose})
+			if !strings.Contains(err.Error(), "permission denied") {
+				t.Errorf("handleMountEvent() got err = %v, want the access failure", err)
+			}
+			if policyCalls.Load() != tc.wantCalls {
+				t.Errorf("GetIamPolicy() calls = %d, want %d", policyCalls.Load(), tc.wantCalls)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("logs do not contain %q:\n%s", want, b.String())
+				}
+			}
+			if strings.Contains(b.String(), "alice") {
+				t.Errorf("logs include an unredacted member:\n%s", b.String())
+			}
+		})
+	}
+}
+
+func TestRedactMember(t *testing.T) {
+	got := []string{
+		redactMember("user:alice@example.com"),
+		redactMember("serviceAccount:app@project.iam.gserviceaccount.com"),
+		redactMember("allUsers"),
+		redactMember("principal://iam.googleapis.com/projects/1/locations/global/workforcePools/pool/subject/bob"),
+	}
+	want := []string{
+		"user:a***@example.com",
+		"serviceAccount:a***@project.iam.gserviceaccount.com",
+		"allUsers",
+		"principal:***",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("redactMember() diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/status"
+)
+
+// impersonateFunc returns the credentials of the service account
+// impersonated by the mount identity.
+type impersonateFunc func(serviceAccount string) (credentials.PerRPCCredentials, error)
+
+// impersonator impersonates service accounts with the token source of the
+// mount.
+func impersonator(ctx context.Context, ts oauth2.TokenSource) impersonateFunc {
+	return func(serviceAccount string) (credentials.PerRPCCredentials, error) {
+		its, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: serviceAccount,
+			Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+		}, option.WithTokenSource(ts))
+		if err != nil {
+			return nil, fmt.Errorf("unable to impersonate %s: %w", serviceAccount, err)
+		}
+		return oauth.TokenSource{TokenSource: its}, nil
+	}
+}
+
+// identities hands out the credentials used for the secrets of a mount,
+// impersonating each service account once.
+type identities struct {
+	mount       credentials.PerRPCCredentials
+	impersonate impersonateFunc
+	accounts    map[string]credentials.PerRPCCredentials
+}
+
+// get returns the credentials of serviceAccount, or of the mount when empty.
+func (i *identities) get(serviceAccount string) (credentials.PerRPCCredentials, error) {
+	if serviceAccount == "" {
+		return i.mount, nil
+	}
+	if creds, ok := i.accounts[serviceAccount]; ok {
+		return creds, nil
+	}
+	if i.impersonate == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "impersonating %s is not supported for this mount", serviceAccount)
+	}
+	creds, err := i.impersonate(serviceAccount)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if i.accounts == nil {
+		i.accounts = make(map[string]credentials.PerRPCCredentials)
+	}
+	i.accounts[serviceAccount] = creds
+	return creds, nil
+}
+
+// impersonatedAccounts returns the service accounts the secrets impersonate,
+// each once and in order.
+func impersonatedAccounts(secrets []*config.Secret) []string {
+	var out []string
+	for _, s := range secrets {
+		if s.ImpersonateServiceAccount != "" && !slices.Contains(out, s.ImpersonateServiceAccount) {
+			out = append(out, s.ImpersonateServiceAccount)
+		}
+	}
+	return out
+}
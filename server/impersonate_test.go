@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// accountCreds are per-RPC credentials naming the service account they
+// belong to.
+type accountCreds string
+
+func (a accountCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": string(a)}, nil
+}
+
+func (a accountCreds) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestHandleMountEventImpersonateServiceAccount(t *testing.T) {
+	const (
+		app     = "projects/app/secrets/db/versions/1"
+		shared  = "projects/shared/secrets/tls/versions/1"
+		billing = "projects/billing/secrets/key/versions/1"
+		other   = "projects/billing/secrets/other/versions/1"
+	)
+
+	var mu sync.Mutex
+	callers := make(map[string]string)
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			mu.Lock()
+			callers[req.Name] = strings.Join(md.Get("authorization"), ",")
+			mu.Unlock()
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	impersonated := make(map[string]int)
+	opts := MountOptions{
+		impersonate: func(serviceAccount string) (credentials.PerRPCCredentials, error) {
+			impersonated[serviceAccount]++
+			return accountCreds(serviceAccount), nil
+		},
+	}
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: app, FileName: "db.txt"},
+			{ResourceName: shared, FileName: "tls.txt", ImpersonateServiceAccount: "shared@shared.iam.gserviceaccount.com"},
+			{ResourceName: billing, FileName: "key.txt", ImpersonateServiceAccount: "billing@billing.iam.gserviceaccount.com"},
+			{ResourceName: other, FileName: "other.txt", ImpersonateServiceAccount: "billing@billing.iam.gserviceaccount.com"},
+		},
+		Permissions: 0640,
+		PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+	}
+
+	if _, err := handleMountEvent(context.Background(), client, accountCreds("mount"), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := map[string]string{
+		app:     "mount",
+		shared:  "shared@shared.iam.gserviceaccount.com",
+		billing: "billing@billing.iam.gserviceaccount.com",
+		other:   "billing@billing.iam.gserviceaccount.com",
+	}
+	if diff := cmp.Diff(want, callers); diff != "" {
+		t.Errorf("AccessSecretVersion() callers diff (-want +got):\n%s", diff)
+	}
+	wantImpersonated := map[string]int{
+		"shared@shared.iam.gserviceaccount.com":   1,
+		"billing@billing.iam.gserviceaccount.com": 1,
+	}
+	if diff := cmp.Diff(wantImpersonated, impersonated); diff != "" {
+		t.Errorf("impersonated service accounts diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleMountEventImpersonateFailure(t *testing.T) {
+	client := mock(t, &mockSecretServer{})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/shared/secrets/tls/versions/1", FileName: "tls.txt", ImpersonateServiceAccount: "shared@shared.iam.gserviceaccount.com"},
+		},
+		Permissions: 0640,
+		PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+	}
+
+	tests := []struct {
+		name string
+		opts MountOptions
+		want string
+	}{
+		{name: "not supported", want: "not supported"},
+		{
+			name: "impersonation denied",
+			opts: MountOptions{impersonate: func(serviceAccount string) (credentials.PerRPCCredentials, error) {
+				return nil, errors.New("missing roles/iam.serviceAccountTokenCreator")
+			}},
+			want: "serviceAccountTokenCreator",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("handleMountEvent() got err = %v, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// pemToJWK converts the PEM encoded keys in contents to JSON Web Keys (RFC
+// 7517). A single key is written as a JWK, several keys as a JWK Set.
+func pemToJWK(contents []byte) ([]byte, error) {
+	var keys []map[string]string
+	rest := contents
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		key, err := parsePEMKey(block)
+		if err != nil {
+			return nil, err
+		}
+		jwk, err := keyToJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwk)
+	}
+
+	switch len(keys) {
+	case 0:
+		return nil, errors.New("no PEM encoded key found")
+	case 1:
+		return json.Marshal(keys[0])
+	default:
+		return json.Marshal(map[string][]map[string]string{"keys": keys})
+	}
+}
+
+// parsePEMKey parses the public or private key in block.
+func parsePEMKey(block *pem.Block) (any, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q, expected a public or private key", block.Type)
+	}
+}
+
+// keyToJWK returns the JWK members of key.
+func keyToJWK(key any) (map[string]string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsaJWK(k), nil
+	case *rsa.PrivateKey:
+		k.Precompute()
+		jwk := rsaJWK(&k.PublicKey)
+		jwk["d"] = b64(k.D.Bytes())
+		jwk["p"] = b64(k.Primes[0].Bytes())
+		jwk["q"] = b64(k.Primes[1].Bytes())
+		jwk["dp"] = b64(k.Precomputed.Dp.Bytes())
+		jwk["dq"] = b64(k.Precomputed.Dq.Bytes())
+		jwk["qi"] = b64(k.Precomputed.Qinv.Bytes())
+		return jwk, nil
+	case *ecdsa.PublicKey:
+		return ecJWK(k)
+	case *ecdsa.PrivateKey:
+		jwk, err := ecJWK(&k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		jwk["d"] = b64(k.D.FillBytes(make([]byte, (k.Curve.Params().BitSize+7)/8)))
+		return jwk, nil
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": b64(k)}, nil
+	case ed25519.PrivateKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   b64(k.Public().(ed25519.PublicKey)),
+			"d":   b64(k.Seed()),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func rsaJWK(k *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"n":   b64(k.N.Bytes()),
+		"e":   b64(big.NewInt(int64(k.E)).Bytes()),
+	}
+}
+
+func ecJWK(k *ecdsa.PublicKey) (map[string]string, error) {
+	params := k.Curve.Params()
+	switch params.Name {
+	case "P-256", "P-384", "P-521":
+	default:
+		return nil, fmt.Errorf("unsupported elliptic curve %s", params.Name)
+	}
+	size := (params.BitSize + 7) / 8
+	return map[string]string{
+		"kty": "EC",
+		"crv": params.Name,
+		"x":   b64(k.X.FillBytes(make([]byte, size))),
+		"y":   b64(k.Y.FillBytes(make([]byte, size))),
+	}, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPEMToJWKRSAPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	files, err := transform("pem-to-jwk", transformInput{path: "key.json", contents: in})
+	if err != nil {
+		t.Fatalf("transform() got err = %v, want nil", err)
+	}
+	if len(files) != 1 || files[0].path != "key.json" {
+		t.Fatalf("transform() got %d files, want key.json only", len(files))
+	}
+	out := files[0].contents
+	var got map[string]string
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("transform() returned invalid JSON %q: %v", out, err)
+	}
+	want := map[string]string{
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   "AQAB",
+	}
+	if len(got) != len(want) {
+		t.Errorf("transform() got members %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("transform() member %q = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestPEMToJWKRejectsCertificate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	_, err = transform("pem-to-jwk", transformInput{path: "key.json", contents: in})
+	if err == nil || !strings.Contains(err.Error(), "CERTIFICATE") {
+		t.Errorf("transform() got err = %v, want unsupported CERTIFICATE error", err)
+	}
+}
+
+func TestTransformUnknown(t *testing.T) {
+	if _, err := transform("pem-to-xml", transformInput{path: "key.json", contents: []byte("x")}); err == nil {
+		t.Errorf("transform() got err = nil, want error for unknown transform")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+)
+
+// kmsKeyVersions returns the Cloud KMS key versions encrypting the replicas
+// of version. It is empty when Google-managed encryption is used.
+func kmsKeyVersions(version *secretmanagerpb.SecretVersion) []string {
+	var out []string
+	add := func(cmek *secretmanagerpb.CustomerManagedEncryptionStatus) {
+		if cmek.GetKmsKeyVersionName() != "" {
+			out = append(out, cmek.GetKmsKeyVersionName())
+		}
+	}
+	// Regional secrets report the key on the version itself.
+	add(version.GetCustomerManagedEncryption())
+	add(version.GetReplicationStatus().GetAutomatic().GetCustomerManagedEncryption())
+	for _, replica := range version.GetReplicationStatus().GetUserManaged().GetReplicas() {
+		add(replica.GetCustomerManagedEncryption())
+	}
+	return out
+}
+
+// checkKMSKey fails unless every replica of version is encrypted with a
+// version of key.
+func checkKMSKey(version *secretmanagerpb.SecretVersion, key string) error {
+	used := kmsKeyVersions(version)
+	if len(used) == 0 {
+		return fmt.Errorf("not encrypted with a customer-managed key, %s is required", key)
+	}
+	prefix := strings.TrimSuffix(key, "/") + "/cryptoKeyVersions/"
+	var errs []error
+	for _, v := range used {
+		if !strings.HasPrefix(v, prefix) {
+			errs = append(errs, fmt.Errorf("encrypted with %s, %s is required", v, key))
+		}
+	}
+	return errors.Join(errs...)
+}
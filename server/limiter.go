@@ -0,0 +1,85 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policies for mounts arriving while the limiter is full.
+const (
+	// OverflowQueue waits for a slot until the mount request is cancelled.
+	OverflowQueue = "queue"
+	// OverflowReject fails the mount immediately with ResourceExhausted. The
+	// driver retries the mount later.
+	OverflowReject = "reject"
+)
+
+// MountLimiter caps the number of mount events handled concurrently across
+// all pods on the node.
+type MountLimiter struct {
+	slots  chan struct{}
+	reject bool
+}
+
+// NewMountLimiter returns a limiter allowing max concurrent mounts, with
+// excess mounts handled according to policy.
+func NewMountLimiter(max int, policy string) (*MountLimiter, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("max concurrent mounts must be positive, got %d", max)
+	}
+	l := &MountLimiter{slots: make(chan struct{}, max)}
+	switch policy {
+	case OverflowQueue:
+	case OverflowReject:
+		l.reject = true
+	default:
+		return nil, fmt.Errorf("unknown mount overflow policy %q, must be %q or %q", policy, OverflowQueue, OverflowReject)
+	}
+	return l, nil
+}
+
+// acquire takes a slot and returns the function releasing it. The mount
+// in-flight and queue depth gauges track the slots held and the mounts
+// waiting for one.
+func (l *MountLimiter) acquire(ctx context.Context) (func(), error) {
+	release := func() {
+		csrmetrics.AddMountsInFlight(-1)
+		<-l.slots
+	}
+	select {
+	case l.slots <- struct{}{}:
+		csrmetrics.AddMountsInFlight(1)
+		return release, nil
+	default:
+	}
+	if l.reject {
+		return nil, status.Error(codes.ResourceExhausted, "too many concurrent mounts, try again later")
+	}
+	csrmetrics.AddMountsQueued(1)
+	defer csrmetrics.AddMountsQueued(-1)
+	select {
+	case l.slots <- struct{}{}:
+		csrmetrics.AddMountsInFlight(1)
+		return release, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
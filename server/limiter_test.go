@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMountLimiterCapsInFlight(t *testing.T) {
+	const max = 2
+	l, err := NewMountLimiter(max, OverflowQueue)
+	if err != nil {
+		t.Fatalf("NewMountLimiter() got err = %v, want nil", err)
+	}
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background())
+			if err != nil {
+				t.Errorf("acquire() got err = %v, want nil", err)
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			inFlight++
+			if inFlight > peak {
+				peak = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if peak > max {
+		t.Errorf("peak in-flight mounts = %d, want <= %d", peak, max)
+	}
+}
+
+func TestMountLimiterReject(t *testing.T) {
+	l, err := NewMountLimiter(1, OverflowReject)
+	if err != nil {
+		t.Fatalf("NewMountLimiter() got err = %v, want nil", err)
+	}
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() got err = %v, want nil", err)
+	}
+	if _, err := l.acquire(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("acquire() on full limiter got err = %v, want ResourceExhausted", err)
+	}
+	release()
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Errorf("acquire() after release got err = %v, want nil", err)
+	}
+}
+
+func TestMountLimiterQueueCancelled(t *testing.T) {
+	l, err := NewMountLimiter(1, OverflowQueue)
+	if err != nil {
+		t.Fatalf("NewMountLimiter() got err = %v, want nil", err)
+	}
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() got err = %v, want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("acquire() with expired context got err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestNewMountLimiterErrors(t *testing.T) {
+	if _, err := NewMountLimiter(0, OverflowQueue); err == nil {
+		t.Errorf("NewMountLimiter(0) got err = nil, want error")
+	}
+	if _, err := NewMountLimiter(1, "drop"); err == nil {
+		t.Errorf("NewMountLimiter() with unknown policy got err = nil, want error")
+	}
+}
+
+func TestMountLimiterGauges(t *testing.T) {
+	inFlight := func() float64 { return metricValue(t, "mount_in_flight", nil) }
+	queued := func() float64 { return metricValue(t, "mount_queue_depth", nil) }
+	// Other tests may leave slots held, so only changes are compared.
+	baseInFlight, baseQueued := inFlight(), queued()
+
+	l, err := NewMountLimiter(2, OverflowQueue)
+	if err != nil {
+		t.Fatalf("NewMountLimiter() got err = %v, want nil", err)
+	}
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire() got err = %v, want nil", err)
+		}
+		releases = append(releases, release)
+	}
+
+	// Three mounts wait for the two held slots.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, err := l.acquire(ctx); err == nil {
+				release()
+			}
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for queued()-baseQueued != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := inFlight() - baseInFlight; got != 2 {
+		t.Errorf("mount_in_flight changed by %v, want 2", got)
+	}
+	if got := queued() - baseQueued; got != 3 {
+		t.Errorf("mount_queue_depth changed by %v, want 3", got)
+	}
+
+	// Cancelled and served mounts leave the queue and release their slots.
+	cancel()
+	wg.Wait()
+	for _, release := range releases {
+		release()
+	}
+	if got := inFlight() - baseInFlight; got != 0 {
+		t.Errorf("mount_in_flight changed by %v after all mounts finished, want 0", got)
+	}
+	if got := queued() - baseQueued; got != 0 {
+		t.Errorf("mount_queue_depth changed by %v after all mounts finished, want 0", got)
+	}
+}
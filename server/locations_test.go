@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventUnknownLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		replicas []string
+		known    []string
+		wantCode codes.Code
+	}{
+		{
+			name:     "misspelled region",
+			resource: "projects/project/locations/us-centrall/secrets/test/versions/1",
+			known:    DefaultLocations,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "region outside configured set",
+			resource: "projects/project/locations/us-east1/secrets/test/versions/1",
+			known:    []string{"us-central1"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "misspelled replica location",
+			resource: "projects/project/locations/us-central1/secrets/test/versions/1",
+			replicas: []string{"us-east1", "europe-wset1"},
+			known:    DefaultLocations,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "known replica location",
+			resource: "projects/project/locations/us-central1/secrets/test/versions/1",
+			replicas: []string{"us-east1"},
+			known:    DefaultLocations,
+		},
+		{
+			name:     "unchecked",
+			resource: "projects/project/locations/us-centrall/secrets/test/versions/1",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := make(map[string]int)
+			var mu sync.Mutex
+			client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+			// The regional client is preset so the unchecked mount does not
+			// dial the real endpoint.
+			loc, _ := locationFromSecretResource(tc.resource)
+			regionalClients := map[string]*secretmanager.Client{loc: client}
+			for _, r := range tc.replicas {
+				regionalClients[r] = client
+			}
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: tc.resource, FileName: "good1.txt", ReplicaLocations: tc.replicas},
+				},
+				Permissions: 0640,
+				PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+			}
+
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{KnownLocations: tc.known})
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("handleMountEvent() got err = %v, want code %v", err, tc.wantCode)
+			}
+			if tc.wantCode != codes.OK && len(calls) != 0 {
+				t.Errorf("AccessSecretVersion() calls = %v, want none", calls)
+			}
+		})
+	}
+}
+
+func TestCheckLocation(t *testing.T) {
+	tests := []struct {
+		resource string
+		wantErr  bool
+	}{
+		{resource: "projects/project/locations/us-central1/secrets/test/versions/1"},
+		{resource: "projects/project/locations/europe-west4/secrets/test/versions/latest"},
+		{resource: "projects/project/secrets/test/versions/1"},
+		{resource: ""},
+		{resource: "projects/project/locations/us-central-1/secrets/test/versions/1", wantErr: true},
+		{resource: "projects/project/locations/mars-north1/secrets/test/versions/1", wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := checkLocation(tc.resource, DefaultLocations); (err != nil) != tc.wantErr {
+			t.Errorf("checkLocation(%q) got err = %v, want err = %v", tc.resource, err, tc.wantErr)
+		}
+	}
+}
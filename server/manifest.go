@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// manifestSignatureSuffix is appended to the manifest path for the file
+// holding its signature.
+const manifestSignatureSuffix = ".sig"
+
+// manifestSource is the secret version a mounted file was written from.
+type manifestSource struct {
+	resourceName string
+	version      string
+}
+
+// manifestEntry is the manifest entry of a single file. It never includes the
+// file contents.
+type manifestEntry struct {
+	Path         string `json:"path"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Version      string `json:"version,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+// mountManifest encodes the path and checksum of every file of the mount,
+// along with the secret version written to it when known.
+func mountManifest(files []*v1alpha1.File, sources map[string]manifestSource) ([]byte, error) {
+	entries := make([]manifestEntry, 0, len(files))
+	for _, f := range files {
+		sum := sha256.Sum256(f.GetContents())
+		src := sources[f.GetPath()]
+		entries = append(entries, manifestEntry{
+			Path:         f.GetPath(),
+			ResourceName: src.resourceName,
+			Version:      src.version,
+			SHA256:       hex.EncodeToString(sum[:]),
+		})
+	}
+	return json.Marshal(map[string][]manifestEntry{"files": entries})
+}
+
+// signManifest returns the base64 encoded Ed25519 signature of manifest.
+func signManifest(key ed25519.PrivateKey, manifest []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)))
+}
+
+// LoadManifestKey reads the PEM encoded PKCS #8 Ed25519 private key signing
+// mount manifests.
+func LoadManifestKey(path string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T, expected an Ed25519 private key", key)
+	}
+	return ed, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+)
+
+func TestHandleMountEventEmitManifest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    strings.Replace(req.Name, "latest", "3", 1),
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("s3cr3t-" + req.Name)},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/a/versions/latest", FileName: "a.txt"},
+			{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt"},
+		},
+		EmitManifest: "manifest.json",
+		Permissions:  0640,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	checksum := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	want := map[string][]manifestEntry{"files": {
+		{Path: "a.txt", ResourceName: "projects/project/secrets/a/versions/latest", Version: "projects/project/secrets/a/versions/3", SHA256: checksum("s3cr3t-projects/project/secrets/a/versions/latest")},
+		{Path: "b.txt", ResourceName: "projects/project/secrets/b/versions/1", Version: "projects/project/secrets/b/versions/1", SHA256: checksum("s3cr3t-projects/project/secrets/b/versions/1")},
+	}}
+
+	for _, key := range []ed25519.PrivateKey{nil, priv} {
+		got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ManifestKey: key})
+		if err != nil {
+			t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+		}
+		files := make(map[string][]byte)
+		for _, f := range got.GetFiles() {
+			files[f.GetPath()] = f.GetContents()
+			if f.GetMode() != int32(cfg.Permissions) {
+				t.Errorf("%s mode = %o, want the mount permissions %o", f.GetPath(), f.GetMode(), cfg.Permissions)
+			}
+		}
+		var manifest map[string][]manifestEntry
+		if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+			t.Fatalf("manifest.json is not valid JSON: %v", err)
+		}
+		if diff := cmp.Diff(want, manifest); diff != "" {
+			t.Errorf("manifest.json diff (-want +got):\n%s", diff)
+		}
+		if strings.Contains(string(files["manifest.json"]), "s3cr3t") {
+			t.Errorf("manifest.json includes secret payloads: %s", files["manifest.json"])
+		}
+		if len(got.GetObjectVersion()) != 2 {
+			t.Errorf("handleMountEvent() got %d object versions, want 2", len(got.GetObjectVersion()))
+		}
+
+		sig, signed := files["manifest.json.sig"]
+		if signed != (key != nil) {
+			t.Fatalf("manifest.json.sig present = %v, want %v", signed, key != nil)
+		}
+		if signed {
+			raw, err := base64.StdEncoding.DecodeString(string(sig))
+			if err != nil || !ed25519.Verify(pub, files["manifest.json"], raw) {
+				t.Errorf("manifest.json.sig does not verify the manifest")
+			}
+		}
+	}
+}
+
+func TestLoadManifestKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadManifestKey(path)
+	if err != nil {
+		t.Fatalf("LoadManifestKey() got err = %v, want nil", err)
+	}
+	if !got.Equal(priv) {
+		t.Errorf("LoadManifestKey() returned a different key")
+	}
+
+	if err := os.WriteFile(path, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadManifestKey(path); err == nil {
+		t.Errorf("LoadManifestKey() got err = nil for a file without a key, want error")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+)
+
+// fileMode returns the mode of the file of secret: its ModeString parsed as
+// octal, its Mode, or else perm. ModeString and Mode may both be set only
+// when they agree.
+func fileMode(secret *config.Secret, perm int32) (int32, error) {
+	if secret.ModeString == "" {
+		if secret.Mode != nil {
+			return *secret.Mode, nil
+		}
+		return perm, nil
+	}
+	m, err := strconv.ParseUint(secret.ModeString, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid modeString %q for secret %s: must be an octal mode between 0000 and 0777", secret.ModeString, secret.ResourceName)
+	}
+	mode := int32(m)
+	if secret.Mode != nil && *secret.Mode != mode {
+		return 0, fmt.Errorf("secret %s sets mode %#o and modeString %q which disagree", secret.ResourceName, *secret.Mode, secret.ModeString)
+	}
+	return mode, nil
+}
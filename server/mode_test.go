@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventModeString(t *testing.T) {
+	mode := func(m int32) *int32 { return &m }
+	tests := []struct {
+		name    string
+		secret  *config.Secret
+		want    int32
+		wantErr string
+	}{
+		{name: "default permissions", secret: &config.Secret{}, want: 0640},
+		{name: "numeric mode", secret: &config.Secret{Mode: mode(0600)}, want: 0600},
+		{name: "octal string", secret: &config.Secret{ModeString: "0400"}, want: 0400},
+		{name: "octal string without leading zero", secret: &config.Secret{ModeString: "440"}, want: 0440},
+		{name: "agreeing mode and string", secret: &config.Secret{Mode: mode(0400), ModeString: "0400"}, want: 0400},
+		{name: "not octal", secret: &config.Secret{ModeString: "0489"}, wantErr: "must be an octal mode"},
+		{name: "above 0777", secret: &config.Secret{ModeString: "01777"}, wantErr: "must be an octal mode"},
+		{name: "disagreeing mode and string", secret: &config.Secret{Mode: mode(0600), ModeString: "0400"}, wantErr: "disagree"},
+	}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.secret.ResourceName = "projects/project/secrets/test/versions/1"
+			tc.secret.FileName = "good1.txt"
+			cfg := &config.MountConfig{
+				Secrets:     []*config.Secret{tc.secret},
+				Permissions: 0640,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if tc.wantErr != "" {
+				if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("handleMountEvent() got err = %v, want InvalidArgument with %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if got.Files[0].Mode != tc.want {
+				t.Errorf("handleMountEvent() mode = %#o, want %#o", got.Files[0].Mode, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRecvMsgSizeCallOption returns the call option raising the gRPC receive
+// limit to size bytes, or nil to keep the gRPC default of 4MiB.
+func maxRecvMsgSizeCallOption(size int) gax.CallOption {
+	if size <= 0 {
+		return nil
+	}
+	return gax.WithGRPCOptions(grpc.MaxCallRecvMsgSize(size))
+}
+
+// messageTooLarge reports whether err is gRPC refusing a response larger than
+// the receive limit. gRPC reports it as ResourceExhausted, the same code as
+// exhausted quota.
+func messageTooLarge(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.ResourceExhausted && strings.Contains(s.Message(), "received message larger than max")
+}
+
+// messageTooLargeErr replaces the error of a response larger than the receive
+// limit with one that can not be mistaken for quota exhaustion.
+func messageTooLargeErr(name string, err error) error {
+	return status.Errorf(codes.FailedPrecondition, "secret %s exceeds the gRPC receive limit, raise it with -max-recv-msg-size: %v", name, status.Convert(err).Message())
+}
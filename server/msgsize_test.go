@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventMaxRecvMsgSize(t *testing.T) {
+	const secret = "projects/project/secrets/large/versions/1"
+	payload := bytes.Repeat([]byte("x"), 64<<10)
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: secret, FileName: "large.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	var calls atomic.Int32
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			calls.Add(1)
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: payload},
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name    string
+		opts    MountOptions
+		wantErr bool
+	}{
+		{name: "below limit", opts: MountOptions{MaxRecvMsgSize: 16 << 10}, wantErr: true},
+		{name: "below limit with retry policy", opts: MountOptions{MaxRecvMsgSize: 16 << 10, DefaultRetryPolicy: RetryPolicy{MaxAttempts: 3}}, wantErr: true},
+		{name: "raised limit", opts: MountOptions{MaxRecvMsgSize: 128 << 10}},
+		{name: "default limit", opts: MountOptions{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls.Store(0)
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, tc.opts)
+			if calls.Load() != 1 {
+				t.Errorf("AccessSecretVersion() calls = %d, want 1", calls.Load())
+			}
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+				}
+				if !bytes.Equal(got.GetFiles()[0].GetContents(), payload) {
+					t.Errorf("handleMountEvent() got %d bytes, want %d", len(got.GetFiles()[0].GetContents()), len(payload))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "exceeds the gRPC receive limit, raise it with -max-recv-msg-size") {
+				t.Errorf("handleMountEvent() got err = %v, want a receive limit error", err)
+			}
+		})
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "receive limit", err: status.Error(codes.ResourceExhausted, "grpc: received message larger than max (65546 vs. 16384)"), want: true},
+		{name: "quota", err: status.Error(codes.ResourceExhausted, "Quota exceeded for quota metric 'Access requests'")},
+		{name: "other code", err: status.Error(codes.Internal, "grpc: received message larger than max (65546 vs. 16384)")},
+		{name: "nil"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := messageTooLarge(tc.err); got != tc.want {
+				t.Errorf("messageTooLarge(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+			if got := retryable(tc.err, nil); tc.want && got {
+				t.Errorf("retryable(%v) = true, want false", tc.err)
+			}
+		})
+	}
+}
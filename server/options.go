@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// globalLocation is the key used for global (non-regional) secrets in
+// per-location settings.
+const globalLocation = "global"
+
+// MountOptions holds provider wide settings that apply to every mount event.
+// The zero value keeps the default behavior.
+type MountOptions struct {
+	// DefaultRetryPolicy applies to locations without an entry in
+	// RetryPolicies.
+	DefaultRetryPolicy RetryPolicy
+	// RetryPolicies overrides the retry policy per location. Global secrets
+	// use the "global" key. An entry replaces DefaultRetryPolicy entirely for
+	// that location; fields are not merged.
+	RetryPolicies map[string]RetryPolicy
+	// DefaultTimeout bounds the fetch of each secret, retries included, for
+	// locations without an entry in Timeouts. Fetches are only bounded by
+	// the client library per call timeout when 0.
+	DefaultTimeout time.Duration
+	// Timeouts overrides DefaultTimeout per location, e.g. longer for
+	// distant regions. Global secrets use the "global" key.
+	Timeouts map[string]time.Duration
+	// RetryMessages are error message substrings, e.g. of a transient
+	// backend failure, retried in addition to the retryable codes. Errors
+	// with a code that can not succeed on retry, e.g. PermissionDenied, are
+	// never retried.
+	RetryMessages []string
+	// CallBudget bounds the weighted cost of the Secret Manager calls of a
+	// mount. Listing versions weighs 5, other calls 1. Optional lookups, such
+	// as the metadata, provenance and replication files and the destruction
+	// warning, are skipped once it is spent while required calls always
+	// proceed. The budget is unlimited when 0.
+	CallBudget int
+	// MaxRetryDuration caps the time spent retrying across all the calls of
+	// a mount. Once it elapses failed calls return their error regardless of
+	// the remaining attempts. Retries are only bounded by their policy when
+	// 0.
+	MaxRetryDuration time.Duration
+	// DetectContentChanges compares each file in the response against the
+	// file already in the mount target and records whether it changed. The
+	// response itself is not affected.
+	DetectContentChanges bool
+	// ForbidLatest rejects mounts referencing a secret through the "latest"
+	// version alias.
+	ForbidLatest bool
+	// MaxListedVersions bounds how many versions are listed to find the
+	// previous versions of a secret. All versions are listed when 0.
+	MaxListedVersions int
+	// VersionsBestEffort writes the previous versions found within
+	// MaxListedVersions instead of failing the mount when some are missing.
+	VersionsBestEffort bool
+	// AllowedEncodings restricts the encodings secrets may use, both for
+	// decoding and encoding on write. All are allowed when empty.
+	AllowedEncodings []string
+	// AllowedTransforms restricts the transforms secrets may use. All are
+	// allowed when empty.
+	AllowedTransforms []string
+	// TimingManifest adds a file with the fetch latency, location and retries
+	// of each secret to the response for debugging.
+	TimingManifest bool
+	// ReportReplication logs the replication policy of every mounted secret.
+	ReportReplication bool
+	// DiagnoseAccessDenied logs a redacted summary of the IAM bindings of
+	// secrets whose access is denied. It requires
+	// secretmanager.secrets.getIamPolicy, without which only the lookup
+	// failure is logged.
+	DiagnoseAccessDenied bool
+	// GroupByLocation fetches the secrets of each location, global or a
+	// region, one after the other to reuse the endpoint's connection. The
+	// locations are still fetched concurrently.
+	GroupByLocation bool
+	// LogSuppressCodes demotes the log of optional secrets failing with one
+	// of these codes to a higher verbosity. The failures are still counted.
+	LogSuppressCodes map[codes.Code]bool
+	// DestroyWarningWindow logs a warning and counts mounted versions that
+	// are scheduled to be destroyed within the window. The mount still
+	// succeeds. Versions are not checked when 0.
+	DestroyWarningWindow time.Duration
+	// DefaultProject replaces the "-" project placeholder in resource names,
+	// e.g. projects/-/secrets/db-password/versions/1. Resources using the
+	// placeholder are rejected when empty.
+	DefaultProject string
+	// SameProject rejects mounts referencing secrets outside of this project,
+	// the project of the workload, except in AllowedProjects. Projects are
+	// compared by ID. Secrets of any project are allowed when empty.
+	SameProject string
+	// AllowedProjects are exempt from SameProject, e.g. a shared secrets
+	// project.
+	AllowedProjects []string
+	// KnownLocations rejects mounts of regional secrets in other locations
+	// before any call is made, e.g. for a misspelled region. Locations are
+	// not checked when nil.
+	KnownLocations []string
+	// Compression compresses Secret Manager requests and responses, one of
+	// CompressionNone or CompressionGzip. Nothing is compressed when empty.
+	Compression string
+	// MaxRecvMsgSize raises the gRPC receive limit of Secret Manager calls,
+	// in bytes, for secrets larger than the 4MiB default. Responses above
+	// the limit fail with FailedPrecondition rather than the
+	// ResourceExhausted reported by gRPC, and are not retried.
+	MaxRecvMsgSize int
+	// DedupObjectVersions lists a secret mounted to several files once in the
+	// ObjectVersion of the response instead of once per file.
+	DedupObjectVersions bool
+	// ErrorFormat is the format of the message of mount errors listing the
+	// failed secrets, one of ErrorFormatText or ErrorFormatJSON. Text is used
+	// when empty.
+	ErrorFormat string
+	// FileNameSanitization handles unsafe characters in file names derived
+	// from secret metadata, one of FileNameReject or FileNameReplace. They
+	// are rejected when empty.
+	FileNameSanitization string
+	// ResponseOrder is the order of the secrets in the mount response, one of
+	// OrderConfig, OrderPath or OrderResourceName. The configured order is
+	// kept when empty.
+	ResponseOrder string
+	// DetectVersionDivergence logs a warning and counts secrets fetched from
+	// several locations in one mount, e.g. regional replicas read through
+	// the latest alias, that resolved to different versions.
+	DetectVersionDivergence bool
+	// ManifestKey signs the manifest of mounts with EmitManifest set. The
+	// signature is written next to the manifest with a ".sig" suffix.
+	// Manifests are not signed when nil.
+	ManifestKey ed25519.PrivateKey
+	// CheckTargetWritable fails mounts whose target directory the provider
+	// can not create files in, before any secret is fetched.
+	CheckTargetWritable bool
+	// FailOnEmptyMount rejects mounts without secrets with InvalidArgument.
+	// They succeed with an empty response otherwise.
+	FailOnEmptyMount bool
+	// MaxSecretsPerMount rejects mounts with more secrets, before any API
+	// call is made. There is no limit when 0.
+	MaxSecretsPerMount int
+	// Concurrency adaptively bounds concurrent AccessSecretVersion calls
+	// across mounts. Calls are not bounded when nil.
+	Concurrency *AdaptiveLimiter
+	// ErrorRate records the outcome of every secret fetch to drive the
+	// readiness endpoint. Outcomes are not recorded when nil.
+	ErrorRate *ErrorRateTracker
+	// Cache caches secret payloads across mount events. Caching is disabled
+	// when nil.
+	Cache *SecretCache
+	// TokenRefreshWindow fetches a new token for the mount this long before
+	// the current one expires.
+	TokenRefreshWindow time.Duration
+	// RetryUnauthenticated refreshes the token of the mount once and retries
+	// secrets rejected with Unauthenticated, as when the token expired
+	// during the mount.
+	RetryUnauthenticated bool
+	// impersonate mints the credentials of the service accounts secrets
+	// impersonate. Such secrets fail when nil.
+	impersonate impersonateFunc
+	// provider is the name of the credential provider of the mount, reported
+	// with its identity.
+	provider string
+	// refreshCreds drops the token of the mount credentials. Unauthenticated
+	// secrets are not retried when nil.
+	refreshCreds func()
+}
+
+// retryPolicy returns the retry policy for the location of a secret. An empty
+// location refers to the global endpoint.
+func (o MountOptions) retryPolicy(loc string) RetryPolicy {
+	if loc == "" {
+		loc = globalLocation
+	}
+	if p, ok := o.RetryPolicies[loc]; ok {
+		return p
+	}
+	return o.DefaultRetryPolicy
+}
+
+// ParseList parses a comma separated list flag, e.g. of retryable messages or
+// allowed projects, ignoring empty entries.
+func ParseList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
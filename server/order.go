@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+)
+
+// Orderings of the secrets in a mount response. Both the files and the object
+// versions follow the same order, the files of a secret stay together.
+const (
+	// OrderConfig keeps the order of the secrets in the SecretProviderClass.
+	OrderConfig = "config-order"
+	// OrderPath sorts the secrets by the path they are written to.
+	OrderPath = "alphabetical-by-path"
+	// OrderResourceName sorts the secrets by their resource name.
+	OrderResourceName = "by-resource-name"
+)
+
+// secretOrder returns the indexes of secrets in the given order. Secrets with
+// equal keys keep their configured order.
+func secretOrder(secrets []*config.Secret, order string) []int {
+	idx := make([]int, len(secrets))
+	for i := range idx {
+		idx[i] = i
+	}
+	var key func(s *config.Secret) string
+	switch order {
+	case OrderPath:
+		key = (*config.Secret).PathString
+	case OrderResourceName:
+		key = func(s *config.Secret) string { return s.ResourceName }
+	default:
+		return idx
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return key(secrets[idx[a]]) < key(secrets[idx[b]])
+	})
+	return idx
+}
+
+// dependencyOrder reorders idx so every secret comes after the secrets it
+// depends on, referenced by file name or path. Otherwise the order of idx is
+// kept. Unknown references and cycles are errors.
+func dependencyOrder(secrets []*config.Secret, idx []int) ([]int, error) {
+	byName := make(map[string]int, len(secrets))
+	for i, s := range secrets {
+		if s.FileName != "" {
+			byName[s.FileName] = i
+		}
+		if p := s.PathString(); p != "" {
+			byName[path.Clean(p)] = i
+		}
+	}
+	deps := make([][]int, len(secrets))
+	for i, s := range secrets {
+		for _, name := range s.DependsOn {
+			j, ok := byName[path.Clean(name)]
+			if !ok {
+				return nil, fmt.Errorf("secret %s depends on %q, which is not a file of this mount", s.ResourceName, name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	out := make([]int, 0, len(idx))
+	done := make([]bool, len(secrets))
+	remaining := slices.Clone(idx)
+	for len(remaining) > 0 {
+		next := slices.IndexFunc(remaining, func(i int) bool {
+			return !slices.ContainsFunc(deps[i], func(j int) bool { return !done[j] })
+		})
+		if next < 0 {
+			names := make([]string, len(remaining))
+			for k, i := range remaining {
+				names[k] = secrets[i].ResourceName
+			}
+			return nil, fmt.Errorf("dependsOn forms a cycle, unable to order secrets %s", strings.Join(names, ", "))
+		}
+		done[remaining[next]] = true
+		out = append(out, remaining[next])
+		remaining = slices.Delete(remaining, next, next+1)
+	}
+	return out, nil
+}
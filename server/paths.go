@@ -0,0 +1,204 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// maxNameLength is the longest file name, in bytes, accepted by common
+	// Linux and Windows file systems.
+	maxNameLength = 255
+	// maxPathLength is PATH_MAX on Linux.
+	maxPathLength = 4096
+)
+
+// windowsIllegalChars can not appear in Windows file names.
+const windowsIllegalChars = `<>:"\|?*`
+
+// checkPaths rejects subpaths escaping the mount, file names the node can not
+// create and secrets or mount level files that would be written to the same
+// file once their subpath is applied. Collisions between secrets without a
+// subpath are left alone to keep existing configurations working, additional
+// paths and mount level files may never collide.
+func checkPaths(cfg *config.MountConfig) error {
+	windows := runtime.GOOS == "windows"
+	seen := make(map[string]string, len(cfg.Secrets))
+	legacy := make(map[string]bool)
+	for _, secret := range cfg.Secrets {
+		if secret.SubPath != "" && !filepath.IsLocal(secret.SubPath) {
+			return fmt.Errorf("subPath %q of secret %s must be a relative path within the mount", secret.SubPath, secret.ResourceName)
+		}
+		// Secrets combined into another file have no file of their own.
+		if secret.PathString() != "" && ownFile(cfg, secret) {
+			if err := checkFileName(secret.PathString(), windows); err != nil {
+				return fmt.Errorf("invalid file name %q for secret %s: %v", secret.PathString(), secret.ResourceName, err)
+			}
+			p := path.Clean(secret.PathString())
+			if other, ok := seen[p]; ok && (secret.SubPath != "" || !legacy[p]) {
+				return fmt.Errorf("%s and secret %s are both written to %s", other, secret.ResourceName, p)
+			}
+			seen[p] = "secret " + secret.ResourceName
+			legacy[p] = secret.SubPath == ""
+		}
+		for _, a := range secret.AdditionalPaths {
+			if err := checkFileName(a, windows); err != nil {
+				return fmt.Errorf("invalid additional path %q for secret %s: %v", a, secret.ResourceName, err)
+			}
+			a = path.Clean(a)
+			if other, ok := seen[a]; ok {
+				return fmt.Errorf("%s and secret %s are both written to %s", other, secret.ResourceName, a)
+			}
+			seen[a] = "secret " + secret.ResourceName
+		}
+	}
+	for _, f := range mountFiles(cfg) {
+		if err := checkFileName(f.path, windows); err != nil {
+			return fmt.Errorf("invalid file name %q for %s: %v", f.path, f.owner, err)
+		}
+		p := path.Clean(f.path)
+		if other, ok := seen[p]; ok {
+			return fmt.Errorf("%s and %s are both written to %s", other, f.owner, p)
+		}
+		seen[p] = f.owner
+	}
+	return nil
+}
+
+// ownFile reports whether secret is written to a file of its own rather than
+// combined into a mount level file.
+func ownFile(cfg *config.MountConfig, secret *config.Secret) bool {
+	if secret.JSONKey != "" || secret.EnvKey != "" {
+		return false
+	}
+	if pair := cfg.EmitTLSPair; pair != nil && (secret.ResourceName == pair.Cert || secret.ResourceName == pair.Key) {
+		return false
+	}
+	return true
+}
+
+// mountFile is a file written once per mount rather than per secret.
+type mountFile struct {
+	path  string
+	owner string
+}
+
+// mountFiles returns the mount level files configured by the attributes of
+// cfg.
+func mountFiles(cfg *config.MountConfig) []mountFile {
+	var files []mountFile
+	if cfg.CombineIntoJSON != "" {
+		files = append(files, mountFile{path: cfg.CombineIntoJSON, owner: "combineIntoJSON"})
+	}
+	if cfg.EmitEnvFile != "" {
+		files = append(files, mountFile{path: cfg.EmitEnvFile, owner: "emitEnvFile"})
+	}
+	if cfg.EmitTLSPair != nil {
+		files = append(files, mountFile{path: tlsCertPath, owner: "emitTLSPair"}, mountFile{path: tlsKeyPath, owner: "emitTLSPair"})
+	}
+	if cfg.EmitManifest != "" {
+		files = append(files, mountFile{path: cfg.EmitManifest, owner: "emitManifest"})
+	}
+	return files
+}
+
+// checkOutputs checks every file of a built response, including the files
+// derived from secrets such as previous versions, split parts, transform
+// outputs and the manifest signature, whose names are only known once the
+// secrets are fetched. A path may only repeat for secrets without a subpath
+// written to the same file, as accepted by checkPaths.
+func checkOutputs(cfg *config.MountConfig, files []*v1alpha1.File) error {
+	windows := runtime.GOOS == "windows"
+	legacy := make(map[string]int)
+	for _, secret := range cfg.Secrets {
+		if secret.SubPath == "" && secret.PathString() != "" && ownFile(cfg, secret) {
+			legacy[path.Clean(secret.PathString())]++
+		}
+	}
+	seen := make(map[string]int, len(files))
+	for _, f := range files {
+		if err := checkFileName(f.GetPath(), windows); err != nil {
+			return fmt.Errorf("invalid file name %q: %v", f.GetPath(), err)
+		}
+		p := path.Clean(f.GetPath())
+		seen[p]++
+		if n := seen[p]; n > 1 && n > legacy[p] {
+			return fmt.Errorf("more than one file is written to %s", p)
+		}
+	}
+	return nil
+}
+
+// checkFileName rejects destination paths that are empty, reserved, escape
+// the mount, contain control characters or exceed file system limits. The
+// Windows rules on characters and device names are only applied to Windows
+// nodes.
+func checkFileName(name string, windows bool) error {
+	if len(name) > maxPathLength {
+		return fmt.Errorf("longer than %d bytes", maxPathLength)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("contains control character %U", r)
+		}
+	}
+	if path.IsAbs(name) {
+		return fmt.Errorf("must be a relative path")
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return fmt.Errorf("does not name a file")
+	}
+	for _, elem := range strings.Split(clean, "/") {
+		if elem == ".." {
+			return fmt.Errorf("must stay within the mount")
+		}
+		if len(elem) > maxNameLength {
+			return fmt.Errorf("%q is longer than %d bytes", elem, maxNameLength)
+		}
+		if windows {
+			if err := checkWindowsName(elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkWindowsName rejects a path element Windows can not create.
+func checkWindowsName(elem string) error {
+	if i := strings.IndexAny(elem, windowsIllegalChars); i >= 0 {
+		return fmt.Errorf("%q contains %q, which is not allowed on Windows", elem, elem[i])
+	}
+	if strings.HasSuffix(elem, ".") || strings.HasSuffix(elem, " ") {
+		return fmt.Errorf("%q ends with a dot or space, which is not allowed on Windows", elem)
+	}
+	base, _, _ := strings.Cut(elem, ".")
+	switch strings.ToUpper(base) {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		return fmt.Errorf("%q is a reserved device name on Windows", elem)
+	}
+	return nil
+}
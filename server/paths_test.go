@@ -0,0 +1,304 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestCheckPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []*config.Secret
+		mount   *config.MountConfig
+		wantErr bool
+	}{
+		{
+			name: "same file name in different subpaths",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", SubPath: "app"},
+				{ResourceName: "b", FileName: "key.txt", SubPath: "sidecar"},
+			},
+		},
+		{
+			name: "collision within subpath",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", SubPath: "app"},
+				{ResourceName: "b", Path: "app/key.txt"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "collision after cleaning",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", SubPath: "app/"},
+				{ResourceName: "b", FileName: "key.txt", SubPath: "./app"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "collision without subpaths",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt"},
+				{ResourceName: "b", FileName: "key.txt"},
+			},
+		},
+		{
+			name: "traversal via subpath",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", SubPath: "../other"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "additional paths",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", AdditionalPaths: []string{"copy/key.txt"}},
+				{ResourceName: "b", FileName: "other.txt"},
+			},
+		},
+		{
+			name: "additional path colliding with later secret",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", AdditionalPaths: []string{"other.txt"}},
+				{ResourceName: "b", FileName: "other.txt"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "additional path colliding with earlier secret",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt"},
+				{ResourceName: "b", FileName: "other.txt", AdditionalPaths: []string{"./key.txt"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "additional path colliding with own file",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", AdditionalPaths: []string{"key.txt"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "additional path traversal",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", AdditionalPaths: []string{"../key.txt"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "reserved file name",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: ".."},
+			},
+			wantErr: true,
+		},
+		{
+			name: "secret colliding with combineIntoJSON",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "all.json"},
+				{ResourceName: "b", JSONKey: "b"},
+			},
+			mount:   &config.MountConfig{CombineIntoJSON: "all.json"},
+			wantErr: true,
+		},
+		{
+			name: "additional path colliding with emitEnvFile",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "a.txt", AdditionalPaths: []string{"app.env"}},
+			},
+			mount:   &config.MountConfig{EmitEnvFile: "app.env"},
+			wantErr: true,
+		},
+		{
+			name: "emitManifest colliding with emitEnvFile",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "a.txt"},
+			},
+			mount:   &config.MountConfig{EmitEnvFile: "out", EmitManifest: "./out"},
+			wantErr: true,
+		},
+		{
+			name: "secret colliding with the TLS pair",
+			secrets: []*config.Secret{
+				{ResourceName: "cert", FileName: "cert.pem"},
+				{ResourceName: "key", FileName: "key.pem"},
+				{ResourceName: "other", FileName: "tls.key"},
+			},
+			mount:   &config.MountConfig{EmitTLSPair: &config.TLSPair{Cert: "cert", Key: "key"}},
+			wantErr: true,
+		},
+		{
+			name: "TLS pair secrets have no file of their own",
+			secrets: []*config.Secret{
+				{ResourceName: "cert", FileName: "tls.crt"},
+				{ResourceName: "key", FileName: "tls.key"},
+			},
+			mount: &config.MountConfig{EmitTLSPair: &config.TLSPair{Cert: "cert", Key: "key"}},
+		},
+		{
+			name: "invalid emitManifest",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "a.txt"},
+			},
+			mount:   &config.MountConfig{EmitManifest: "../manifest.json"},
+			wantErr: true,
+		},
+		{
+			name: "absolute subpath",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt", SubPath: "/etc"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.mount
+			if cfg == nil {
+				cfg = &config.MountConfig{}
+			}
+			cfg.Secrets = tc.secrets
+			err := checkPaths(cfg)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("checkPaths() got err = %v, want err = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	files := func(paths ...string) []*v1alpha1.File {
+		var out []*v1alpha1.File
+		for _, p := range paths {
+			out = append(out, &v1alpha1.File{Path: p})
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		secrets []*config.Secret
+		files   []*v1alpha1.File
+		wantErr bool
+	}{
+		{
+			name:    "distinct files",
+			secrets: []*config.Secret{{ResourceName: "a", FileName: "a"}},
+			files:   files("a", "a.previous.1", "a.metadata.json", timingManifestPath),
+		},
+		{
+			name: "secrets without subpath sharing a file",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "key.txt"},
+				{ResourceName: "b", FileName: "key.txt"},
+			},
+			files: files("key.txt", "key.txt"),
+		},
+		{
+			name: "split part colliding with a secret",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "a", SplitDelimiter: ","},
+				{ResourceName: "b", FileName: "a.1"},
+			},
+			files:   files("a.0", "a.1", "a.1"),
+			wantErr: true,
+		},
+		{
+			name: "previous version colliding with a secret",
+			secrets: []*config.Secret{
+				{ResourceName: "a", FileName: "a"},
+				{ResourceName: "b", FileName: "a.previous.1"},
+			},
+			files:   files("a", "a.previous.1", "a.previous.1"),
+			wantErr: true,
+		},
+		{
+			name:    "manifest signature colliding with a secret",
+			secrets: []*config.Secret{{ResourceName: "a", FileName: "manifest.json.sig"}},
+			files:   files("manifest.json.sig", "manifest.json", "manifest.json.sig"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid transform output",
+			secrets: []*config.Secret{{ResourceName: "a", FileName: "bundle.p12"}},
+			files:   files("bundle.p12/../../key.pem"),
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkOutputs(&config.MountConfig{Secrets: tc.secrets}, tc.files)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("checkOutputs() got err = %v, want err = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckFileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		windows bool
+		wantErr bool
+	}{
+		{name: "plain", file: "key.txt"},
+		{name: "nested", file: "app/key.txt"},
+		{name: "redundant dot", file: "./key.txt"},
+		{name: "colon on linux", file: "host:port"},
+		{name: "device name on linux", file: "CON"},
+		{name: "longest element", file: strings.Repeat("a", maxNameLength)},
+		{name: "empty", file: "", wantErr: true},
+		{name: "dot", file: ".", wantErr: true},
+		{name: "dot dot", file: "..", wantErr: true},
+		{name: "trailing slash dot", file: "app/.", wantErr: false},
+		{name: "only slashes", file: "./", wantErr: true},
+		{name: "traversal", file: "../key.txt", wantErr: true},
+		{name: "nested traversal", file: "app/../../key.txt", wantErr: true},
+		{name: "absolute", file: "/etc/passwd", wantErr: true},
+		{name: "null byte", file: "key\x00.txt", wantErr: true},
+		{name: "newline", file: "key\n.txt", wantErr: true},
+		{name: "tab", file: "key\t.txt", wantErr: true},
+		{name: "escape", file: "key\x1b[31m", wantErr: true},
+		{name: "delete", file: "key\x7f", wantErr: true},
+		{name: "element too long", file: strings.Repeat("a", maxNameLength+1), wantErr: true},
+		{name: "path too long", file: strings.Repeat("a/", maxPathLength/2+1), wantErr: true},
+		{name: "windows plain", file: "app/key.txt", windows: true},
+		{name: "windows colon", file: "host:port", windows: true, wantErr: true},
+		{name: "windows backslash", file: `app\key`, windows: true, wantErr: true},
+		{name: "windows wildcard", file: "key*", windows: true, wantErr: true},
+		{name: "windows quote", file: `"key"`, windows: true, wantErr: true},
+		{name: "windows pipe", file: "a|b", windows: true, wantErr: true},
+		{name: "windows trailing dot", file: "key.", windows: true, wantErr: true},
+		{name: "windows trailing space", file: "key ", windows: true, wantErr: true},
+		{name: "windows device", file: "CON", windows: true, wantErr: true},
+		{name: "windows device with extension", file: "app/nul.txt", windows: true, wantErr: true},
+		{name: "windows numbered device", file: "Com1", windows: true, wantErr: true},
+		{name: "windows device prefix", file: "console", windows: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkFileName(tc.file, tc.windows)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("checkFileName(%q) got err = %v, want err = %v", tc.file, err, tc.wantErr)
+			}
+		})
+	}
+}
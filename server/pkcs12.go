@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// pkcs12Extract splits a password protected PKCS#12 bundle into PEM files
+// named after the secret's path without its extension: "<name>.key" holds
+// the private key, "<name>.crt" the leaf certificate and "<name>.ca.crt" the
+// remaining certificates of the chain, if any.
+func pkcs12Extract(in transformInput) ([]transformedFile, error) {
+	blocks, err := pkcs12.ToPEM(in.contents, string(in.password))
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, errors.New("incorrect PKCS#12 password")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#12 bundle: %v", err)
+	}
+
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "PRIVATE KEY":
+			if key != nil {
+				return nil, errors.New("PKCS#12 bundle contains more than one private key")
+			}
+			// ToPEM labels keys as PKCS#8 but encodes them as PKCS#1 or SEC 1.
+			if key, err = parsePKCS12Key(block.Bytes); err != nil {
+				return nil, err
+			}
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate in PKCS#12 bundle: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if key == nil {
+		return nil, errors.New("PKCS#12 bundle contains no private key")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %v", err)
+	}
+
+	var leaf []byte
+	var chain bytes.Buffer
+	for _, cert := range certs {
+		block := &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+		if leaf == nil && publicKeyMatches(cert, key) {
+			leaf = pem.EncodeToMemory(block)
+			continue
+		}
+		if err := pem.Encode(&chain, block); err != nil {
+			return nil, err
+		}
+	}
+	if leaf == nil {
+		return nil, errors.New("PKCS#12 bundle contains no certificate for its private key")
+	}
+
+	base := strings.TrimSuffix(in.path, path.Ext(in.path))
+	out := []transformedFile{
+		{path: base + ".key", contents: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})},
+		{path: base + ".crt", contents: leaf},
+	}
+	if chain.Len() > 0 {
+		out = append(out, transformedFile{path: base + ".ca.crt", contents: chain.Bytes()})
+	}
+	return out, nil
+}
+
+func parsePKCS12Key(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key in PKCS#12 bundle")
+}
+
+func publicKeyMatches(cert *x509.Certificate, key crypto.Signer) bool {
+	pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(key.Public())
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+)
+
+// testdata/bundle.p12 holds a key, its leaf certificate "leaf.example.com"
+// and the issuing "Test CA", protected with the password "changeit".
+const bundlePassword = "changeit"
+
+func readBundle(t *testing.T) []byte {
+	t.Helper()
+	b, err := os.ReadFile("testdata/bundle.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPKCS12Extract(t *testing.T) {
+	files, err := transform("pkcs12-extract", transformInput{path: "tls/bundle.p12", contents: readBundle(t), password: []byte(bundlePassword)})
+	if err != nil {
+		t.Fatalf("transform() got err = %v, want nil", err)
+	}
+
+	got := make(map[string][]byte)
+	for _, f := range files {
+		got[f.path] = f.contents
+	}
+	if len(got) != 3 || got["tls/bundle.key"] == nil || got["tls/bundle.crt"] == nil || got["tls/bundle.ca.crt"] == nil {
+		t.Fatalf("transform() got files %v, want tls/bundle.key, tls/bundle.crt and tls/bundle.ca.crt", files)
+	}
+
+	if _, err := tls.X509KeyPair(got["tls/bundle.crt"], got["tls/bundle.key"]); err != nil {
+		t.Errorf("extracted key and certificate do not match: %v", err)
+	}
+	if cn := certCommonName(t, got["tls/bundle.crt"]); cn != "leaf.example.com" {
+		t.Errorf("leaf certificate CN = %q, want leaf.example.com", cn)
+	}
+	if cn := certCommonName(t, got["tls/bundle.ca.crt"]); cn != "Test CA" {
+		t.Errorf("CA certificate CN = %q, want Test CA", cn)
+	}
+}
+
+func TestPKCS12ExtractErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents []byte
+		password string
+		want     string
+	}{
+		{
+			name:     "wrong password",
+			contents: readBundle(t),
+			password: "wrong",
+			want:     "incorrect PKCS#12 password",
+		},
+		{
+			name:     "not a bundle",
+			contents: []byte("not a pkcs12 bundle"),
+			password: bundlePassword,
+			want:     "failed to parse PKCS#12 bundle",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := transform("pkcs12-extract", transformInput{path: "bundle.p12", contents: tc.contents, password: []byte(tc.password)})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("transform() got err = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventPKCS12PasswordSecret(t *testing.T) {
+	bundle := readBundle(t)
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			data := bundle
+			if req.Name == "projects/project/secrets/password/versions/1" {
+				data = []byte(bundlePassword)
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: data},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:            "projects/project/secrets/bundle/versions/1",
+				FileName:                "tls.p12",
+				Transform:               "pkcs12-extract",
+				TransformPasswordSecret: "projects/project/secrets/password/versions/1",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	var paths []string
+	for _, f := range got.Files {
+		paths = append(paths, f.Path)
+	}
+	if strings.Join(paths, ",") != "tls.key,tls.crt,tls.ca.crt" {
+		t.Errorf("handleMountEvent() wrote %v, want tls.key, tls.crt and tls.ca.crt", paths)
+	}
+}
+
+func certCommonName(t *testing.T, b []byte) string {
+	t.Helper()
+	block, _ := pem.Decode(b)
+	if block == nil {
+		t.Fatalf("no PEM block in %q", b)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// PodMetadataSource looks up the metadata of a pod. It is satisfied by
+// *auth.Client.
+type PodMetadataSource interface {
+	PodMetadata(ctx context.Context, namespace, name string) (*metav1.ObjectMeta, error)
+}
+
+// lookupPod fills the annotations and terminating state of the mounting pod
+// when the mount or the server needs them. A failed lookup only fails mounts
+// that depend on it, the terminating check is an optimization.
+func (s *Server) lookupPod(ctx context.Context, cfg *config.MountConfig) error {
+	if cfg.GateAnnotation == "" && !s.SkipTerminatingPods {
+		return nil
+	}
+	if s.Pods == nil {
+		if cfg.GateAnnotation != "" {
+			return status.Error(codes.FailedPrecondition, "gateAnnotation requires pod lookups, which are not configured")
+		}
+		return nil
+	}
+	meta, err := s.Pods.PodMetadata(ctx, cfg.PodInfo.Namespace, cfg.PodInfo.Name)
+	if err != nil {
+		if cfg.GateAnnotation != "" {
+			return status.Error(codes.Unavailable, fmt.Sprintf("unable to look up pod: %v", err))
+		}
+		klog.V(3).InfoS("unable to check whether the pod is terminating", "err", err, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		return nil
+	}
+	cfg.PodInfo.Annotations = meta.Annotations
+	cfg.PodInfo.Terminating = s.SkipTerminatingPods && meta.DeletionTimestamp != nil
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHandleMountEventTerminatingPod(t *testing.T) {
+	calls := make(map[string]int)
+	var mu sync.Mutex
+	client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt"},
+		},
+		Permissions: 0640,
+		PodInfo: &config.PodInfo{
+			Namespace:   "default",
+			Name:        "test-pod",
+			Terminating: true,
+		},
+	}
+
+	_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("handleMountEvent() got err = %v, want code %v", err, codes.FailedPrecondition)
+	}
+	if len(calls) != 0 {
+		t.Errorf("AccessSecretVersion() calls = %v, want none", calls)
+	}
+}
+
+func TestLookupPodTerminating(t *testing.T) {
+	deleted := metav1.Now()
+
+	tests := []struct {
+		name            string
+		skip            bool
+		gate            string
+		source          PodMetadataSource
+		wantTerminating bool
+		wantCode        codes.Code
+	}{
+		{
+			name:            "terminating pod",
+			skip:            true,
+			source:          fakePods{meta: &metav1.ObjectMeta{DeletionTimestamp: &deleted}},
+			wantTerminating: true,
+		},
+		{
+			name:   "running pod",
+			skip:   true,
+			source: fakePods{meta: &metav1.ObjectMeta{}},
+		},
+		{
+			name:   "check disabled",
+			gate:   "rollout.example.com/secrets",
+			source: fakePods{meta: &metav1.ObjectMeta{DeletionTimestamp: &deleted}},
+		},
+		{
+			name:   "lookup failure ignored",
+			skip:   true,
+			source: fakePods{err: errors.New("forbidden")},
+		},
+		{
+			name: "not configured",
+			skip: true,
+		},
+		{
+			name:     "lookup failure with gate",
+			skip:     true,
+			gate:     "rollout.example.com/secrets",
+			source:   fakePods{err: errors.New("forbidden")},
+			wantCode: codes.Unavailable,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{Pods: tc.source, SkipTerminatingPods: tc.skip}
+			cfg := &config.MountConfig{
+				GateAnnotation: tc.gate,
+				PodInfo:        &config.PodInfo{Namespace: "default", Name: "test-pod"},
+			}
+			err := s.lookupPod(context.Background(), cfg)
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("lookupPod() got err = %v, want code %v", err, tc.wantCode)
+			}
+			if cfg.PodInfo.Terminating != tc.wantTerminating {
+				t.Errorf("lookupPod() Terminating = %v, want %v", cfg.PodInfo.Terminating, tc.wantTerminating)
+			}
+		})
+	}
+}
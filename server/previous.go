@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// maxListPageSize is the largest page requested from ListSecretVersions.
+const maxListPageSize = 100
+
+// previousSuffix names the files of the previous versions of a secret,
+// followed by their position starting at 1 for the newest.
+const previousSuffix = ".previous."
+
+// previousVersions returns the names of up to n enabled versions created
+// before current and after createdAfter when set, newest first. At most limit
+// versions are listed, all when limit is 0. Finding fewer than n within the limit fails with
+// FailedPrecondition unless bestEffort is set, running out of versions does
+// not.
+func previousVersions(ctx context.Context, client *secretmanager.Client, current string, n, limit int, createdAfter time.Time, bestEffort bool, callOpts []gax.CallOption) ([]string, error) {
+	i := strings.LastIndex(current, "/versions/")
+	if i < 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to determine the version number of %s", current)
+	}
+	currentNum, err := strconv.ParseUint(current[i+len("/versions/"):], 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to determine the version number of %s", current)
+	}
+	pageSize := maxListPageSize
+	if limit > 0 && limit < pageSize {
+		pageSize = limit
+	}
+
+	// The filter narrows the listing server side, the versions are checked
+	// again below.
+	filter := "state:ENABLED"
+	if !createdAfter.IsZero() {
+		filter += " AND create_time>" + createdAfter.UTC().Format(time.RFC3339)
+	}
+
+	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_list_secret_versions_requests")
+	// Versions are listed newest first.
+	it := client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent:   current[:i],
+		PageSize: int32(pageSize), // #nosec G115 pageSize is at most maxListPageSize
+		Filter:   filter,
+	}, callOpts...)
+	var out []string
+	listed := 0
+	exhausted := false
+	for len(out) < n && (limit <= 0 || listed < limit) {
+		v, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			exhausted = true
+			break
+		}
+		if err != nil {
+			if e, ok := status.FromError(err); ok {
+				smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+			}
+			return nil, err
+		}
+		listed++
+		num, err := strconv.ParseUint(v.GetName()[strings.LastIndex(v.GetName(), "/")+1:], 10, 64)
+		if err != nil || num >= currentNum || v.GetState() != secretmanagerpb.SecretVersion_ENABLED {
+			continue
+		}
+		if !createdAfter.IsZero() && !v.GetCreateTime().AsTime().After(createdAfter) {
+			continue
+		}
+		out = append(out, v.GetName())
+	}
+	smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+
+	if len(out) < n && !exhausted {
+		msg := fmt.Sprintf("found %d of %d previous versions of %s within the first %d listed versions, raise -max-listed-versions", len(out), n, current, listed)
+		if !bestEffort {
+			return nil, status.Error(codes.FailedPrecondition, msg)
+		}
+		klog.InfoS("WARNING: "+msg, "resource_name", current)
+	}
+	return out, nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// pagedVersions serves versions 1 to count of secret newest first, in pages
+// of the requested size. Versions divisible by disabledEvery are disabled.
+// served counts the versions returned.
+func pagedVersions(secret string, count, disabledEvery int, served *int, mu *sync.Mutex) func(context.Context, *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	return func(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+		offset, _ := strconv.Atoi(req.PageToken)
+		resp := &secretmanagerpb.ListSecretVersionsResponse{}
+		for n := count - offset; n > 0 && len(resp.Versions) < int(req.PageSize); n-- {
+			state := secretmanagerpb.SecretVersion_ENABLED
+			if disabledEvery > 0 && n%disabledEvery == 0 {
+				state = secretmanagerpb.SecretVersion_DISABLED
+			}
+			resp.Versions = append(resp.Versions, &secretmanagerpb.SecretVersion{Name: fmt.Sprintf("%s/versions/%d", secret, n), State: state})
+		}
+		if next := offset + len(resp.Versions); next < count {
+			resp.NextPageToken = strconv.Itoa(next)
+		}
+		mu.Lock()
+		*served += len(resp.Versions)
+		mu.Unlock()
+		return resp, nil
+	}
+}
+
+func TestHandleMountEventPreviousVersions(t *testing.T) {
+	const secret = "projects/project/secrets/signing-key"
+
+	tests := []struct {
+		name          string
+		previous      int
+		disabledEvery int
+		opts          MountOptions
+		want          []string
+		wantErr       bool
+		wantMaxServed int
+	}{
+		{
+			name:          "within bound",
+			previous:      3,
+			opts:          MountOptions{MaxListedVersions: 10},
+			want:          []string{"key", "key.previous.1", "key.previous.2", "key.previous.3"},
+			wantMaxServed: 10,
+		},
+		{
+			name:          "disabled versions skipped",
+			previous:      2,
+			disabledEvery: 2,
+			opts:          MountOptions{MaxListedVersions: 10},
+			want:          []string{"key", "key.previous.1", "key.previous.2"},
+			wantMaxServed: 10,
+		},
+		{
+			name:          "beyond bound",
+			previous:      5,
+			disabledEvery: 2,
+			opts:          MountOptions{MaxListedVersions: 6},
+			wantErr:       true,
+			wantMaxServed: 6,
+		},
+		{
+			name:          "beyond bound best effort",
+			previous:      5,
+			disabledEvery: 2,
+			opts:          MountOptions{MaxListedVersions: 6, VersionsBestEffort: true},
+			want:          []string{"key", "key.previous.1", "key.previous.2", "key.previous.3"},
+			wantMaxServed: 6,
+		},
+		{
+			name:          "more than available",
+			previous:      2000,
+			want:          nil,
+			wantMaxServed: 1000,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			served := 0
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte(req.Name[strings.LastIndex(req.Name, "/")+1:])},
+					}, nil
+				},
+				listFn: pagedVersions(secret, 1000, tc.disabledEvery, &served, &mu),
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: secret + "/versions/1000", FileName: "key", PreviousVersions: tc.previous},
+				},
+				Permissions: 0640,
+				PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, tc.opts)
+			if served > tc.wantMaxServed {
+				t.Errorf("ListSecretVersions() served %d versions, want at most %d", served, tc.wantMaxServed)
+			}
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("handleMountEvent() got err = %v, want err = %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if tc.want == nil {
+				// All 999 previous versions are written.
+				if n := len(got.GetFiles()); n != 1000 {
+					t.Errorf("handleMountEvent() got %d files, want 1000", n)
+				}
+				return
+			}
+			var paths []string
+			for _, f := range got.GetFiles() {
+				paths = append(paths, f.GetPath())
+			}
+			if diff := cmp.Diff(tc.want, paths); diff != "" {
+				t.Errorf("handleMountEvent() paths diff (-want +got):\n%s", diff)
+			}
+			// The newest previous version comes first.
+			if tc.disabledEvery == 0 && string(got.GetFiles()[1].GetContents()) != "999" {
+				t.Errorf("handleMountEvent() got %s contents %q, want 999", got.GetFiles()[1].GetPath(), got.GetFiles()[1].GetContents())
+			}
+		})
+	}
+}
+
+func TestHandleMountEventPreviousVersionsCreatedAfter(t *testing.T) {
+	const secret = "projects/project/secrets/signing-key"
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var mu sync.Mutex
+	var filters []string
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(req.Name[strings.LastIndex(req.Name, "/")+1:])},
+			}, nil
+		},
+		// Serves versions 1 to 10 newest first, two per page, ignoring the
+		// filter. Version n is created n days after base, 6 and 8 are
+		// disabled.
+		listFn: func(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+			mu.Lock()
+			filters = append(filters, req.Filter)
+			mu.Unlock()
+			offset, _ := strconv.Atoi(req.PageToken)
+			resp := &secretmanagerpb.ListSecretVersionsResponse{}
+			for n := 10 - offset; n > 0 && len(resp.Versions) < 2; n-- {
+				state := secretmanagerpb.SecretVersion_ENABLED
+				if n == 6 || n == 8 {
+					state = secretmanagerpb.SecretVersion_DISABLED
+				}
+				resp.Versions = append(resp.Versions, &secretmanagerpb.SecretVersion{
+					Name:       fmt.Sprintf("%s/versions/%d", secret, n),
+					State:      state,
+					CreateTime: timestamppb.New(base.AddDate(0, 0, n)),
+				})
+			}
+			if next := offset + len(resp.Versions); next < 10 {
+				resp.NextPageToken = strconv.Itoa(next)
+			}
+			return resp, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: secret + "/versions/10", FileName: "key", PreviousVersions: 5, PreviousVersionsCreatedAfter: base.AddDate(0, 0, 5).Format(time.RFC3339)},
+		},
+		Permissions: 0640,
+		PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	var contents []string
+	for _, f := range got.GetFiles()[1:] {
+		contents = append(contents, string(f.GetContents()))
+	}
+	if diff := cmp.Diff([]string{"9", "7"}, contents); diff != "" {
+		t.Errorf("handleMountEvent() previous versions diff (-want +got):\n%s", diff)
+	}
+	if len(filters) != 5 {
+		t.Errorf("ListSecretVersions() called %d times, want every one of the 5 pages", len(filters))
+	}
+	if want := "state:ENABLED AND create_time>2024-01-06T00:00:00Z"; len(filters) == 0 || filters[0] != want {
+		t.Errorf("ListSecretVersions() filters = %q, want %q", filters, want)
+	}
+}
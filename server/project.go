@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// projectPlaceholder stands for the default project in resource names, e.g.
+// projects/-/secrets/db-password/versions/1.
+const projectPlaceholder = "projects/-/"
+
+// ProjectIDSource looks up the project the provider runs in. It is satisfied
+// by *metadata.Client.
+type ProjectIDSource interface {
+	ProjectIDWithContext(ctx context.Context) (string, error)
+}
+
+// DetectDefaultProject returns the project reported by src. It returns an
+// empty string, leaving the default project unset, when the project can not
+// be determined such as when running outside of GCE.
+func DetectDefaultProject(ctx context.Context, src ProjectIDSource) string {
+	project, err := src.ProjectIDWithContext(ctx)
+	if err != nil {
+		klog.InfoS("unable to detect the default project, resource names must include the project", "err", err)
+		return ""
+	}
+	return project
+}
+
+// resolveProject replaces the project placeholder in resource with project.
+// Resources naming their project are returned unchanged.
+func resolveProject(resource, project string) (string, error) {
+	if !strings.HasPrefix(resource, projectPlaceholder) {
+		return resource, nil
+	}
+	if project == "" {
+		return "", fmt.Errorf("resource %s uses the default project but no default project is configured", resource)
+	}
+	return fallbackResource(resource, project), nil
+}
+
+// checkSameProject rejects resource when it is not in project or one of the
+// allowed projects. Projects are compared by ID, resource names using the
+// project number are rejected.
+func checkSameProject(resource, project string, allowed []string) error {
+	r, err := parseResourceName(resource)
+	if err != nil {
+		return err
+	}
+	if r.project == project || slices.Contains(allowed, r.project) {
+		return nil
+	}
+	return status.Errorf(codes.FailedPrecondition, "secret %s is in project %s but the workload runs in project %s, cross-project secrets are rejected by -enforce-same-project unless listed in -allowed-projects", resource, r.project, project)
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeProjectSource is a ProjectIDSource returning a fixed project or error.
+type fakeProjectSource struct {
+	project string
+	err     error
+}
+
+func (f fakeProjectSource) ProjectIDWithContext(context.Context) (string, error) {
+	return f.project, f.err
+}
+
+func TestDetectDefaultProject(t *testing.T) {
+	if got := DetectDefaultProject(context.Background(), fakeProjectSource{project: "my-project"}); got != "my-project" {
+		t.Errorf("DetectDefaultProject() = %q, want %q", got, "my-project")
+	}
+	// Outside of GCE the metadata server can not be reached.
+	offGCE := fakeProjectSource{err: errors.New("metadata: GCE metadata \"project/project-id\" not defined")}
+	if got := DetectDefaultProject(context.Background(), offGCE); got != "" {
+		t.Errorf("DetectDefaultProject() = %q, want it unset", got)
+	}
+}
+
+func TestHandleMountEventDefaultProject(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		},
+	})
+	newCfg := func() *config.MountConfig {
+		return &config.MountConfig{
+			Secrets: []*config.Secret{
+				{ResourceName: "projects/-/secrets/test/versions/1", FileName: "default.txt"},
+				{ResourceName: "projects/other/secrets/test/versions/1", FileName: "other.txt"},
+			},
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+	}
+
+	project := DetectDefaultProject(context.Background(), fakeProjectSource{project: "detected"})
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), newCfg(), make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{DefaultProject: project})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if got := got.ObjectVersion[0].Version; got != "projects/detected/secrets/test/versions/1" {
+		t.Errorf("ObjectVersion[0] = %s, want the default project", got)
+	}
+	if got := got.ObjectVersion[1].Version; got != "projects/other/secrets/test/versions/1" {
+		t.Errorf("ObjectVersion[1] = %s, want it unchanged", got)
+	}
+
+	_, err = handleMountEvent(context.Background(), client, NewFakeCreds(), newCfg(), make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("handleMountEvent() got err = %v, want InvalidArgument without a default project", err)
+	}
+}
+
+func TestHandleMountEventSameProject(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name      string
+		resource  string
+		fallbacks []string
+		opts      MountOptions
+		wantCode  codes.Code
+	}{
+		{name: "same project", resource: "projects/workload/secrets/test/versions/1", opts: MountOptions{SameProject: "workload"}},
+		{name: "same project regional", resource: "projects/workload/locations/us-central1/secrets/test/versions/1", opts: MountOptions{SameProject: "workload"}},
+		{name: "cross project", resource: "projects/other/secrets/test/versions/1", opts: MountOptions{SameProject: "workload"}, wantCode: codes.FailedPrecondition},
+		{name: "cross project allowed", resource: "projects/shared/secrets/test/versions/1", opts: MountOptions{SameProject: "workload", AllowedProjects: []string{"shared"}}},
+		{name: "placeholder resolves to the workload", resource: "projects/-/secrets/test/versions/1", opts: MountOptions{SameProject: "workload", DefaultProject: "workload"}},
+		{name: "not enforced", resource: "projects/other/secrets/test/versions/1"},
+		{name: "cross project fallback", resource: "projects/workload/secrets/test/versions/1", fallbacks: []string{"other"}, opts: MountOptions{SameProject: "workload"}, wantCode: codes.FailedPrecondition},
+		{name: "cross project fallback allowed", resource: "projects/workload/secrets/test/versions/1", fallbacks: []string{"shared"}, opts: MountOptions{SameProject: "workload", AllowedProjects: []string{"shared"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: tc.resource, FileName: "good1.txt", FallbackProjects: tc.fallbacks},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			regionalClients := map[string]*secretmanager.Client{"us-central1": client}
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, tc.opts)
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("handleMountEvent() got err = %v, want code %v", err, tc.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/googleapis/gax-go/v2"
+)
+
+// provenanceSuffix is appended to the path of a secret to name its
+// provenance file.
+const provenanceSuffix = ".provenance.json"
+
+// secretProvenance is written next to a secret when Secret.Provenance is set.
+// Like the metadata file it is not listed in ObjectVersion, so it does not
+// take part in rotation comparisons.
+type secretProvenance struct {
+	// Name is the resolved secret version.
+	Name string `json:"name"`
+	// CreateTime is when the version was created, in RFC 3339 format.
+	CreateTime string `json:"createTime,omitempty"`
+	// Labels are the labels of the secret.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Replication is "automatic", "user-managed" or "regional".
+	Replication string `json:"replication,omitempty"`
+	// Error is set instead of the other fields when the provenance could not
+	// be looked up. The secret itself is still mounted.
+	Error string `json:"error,omitempty"`
+}
+
+// fetchProvenance looks up the provenance of the accessed version. loc is the
+// location of regional secrets.
+func fetchProvenance(ctx context.Context, client *secretmanager.Client, versions *versionFetcher, version, loc string, callOpts []gax.CallOption) (*secretProvenance, error) {
+	v, err := versions.get(ctx, client, version, callOpts)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := getSecret(ctx, client, version, callOpts)
+	if err != nil {
+		return nil, err
+	}
+	p := &secretProvenance{Name: version, Labels: secret.GetLabels()}
+	if t := v.GetCreateTime(); t != nil {
+		p.CreateTime = t.AsTime().Format(time.RFC3339)
+	}
+	if loc != "" {
+		p.Replication = "regional"
+	} else {
+		p.Replication = replicationOf(secret).Type
+	}
+	return p, nil
+}
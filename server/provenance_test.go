@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestHandleMountEventProvenance(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	getSecretErr := error(nil)
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    "projects/project/secrets/test/versions/3",
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			return &secretmanagerpb.SecretVersion{Name: req.Name, CreateTime: timestamppb.New(created)}, nil
+		},
+		getSecretFn: func(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+			if getSecretErr != nil {
+				return nil, getSecretErr
+			}
+			return &secretmanagerpb.Secret{
+				Name:   req.Name,
+				Labels: map[string]string{"team": "payments"},
+				Replication: &secretmanagerpb.Replication{
+					Replication: &secretmanagerpb.Replication_UserManaged_{UserManaged: &secretmanagerpb.Replication_UserManaged{
+						Replicas: []*secretmanagerpb.Replication_UserManaged_Replica{{Location: "us-east1"}},
+					}},
+				},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/latest", FileName: "good1.txt", Provenance: true},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if len(got.Files) != 2 || got.Files[1].Path != "good1.txt"+provenanceSuffix {
+		t.Fatalf("handleMountEvent() files = %v, want the secret and its provenance file", got.Files)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(got.Files[1].Contents, &fields); err != nil {
+		t.Fatalf("provenance is not JSON: %v", err)
+	}
+	want := map[string]any{
+		"name":        "projects/project/secrets/test/versions/3",
+		"createTime":  "2024-03-01T12:00:00Z",
+		"labels":      map[string]any{"team": "payments"},
+		"replication": "user-managed",
+	}
+	if diff := cmp.Diff(want, fields); diff != "" {
+		t.Errorf("provenance mismatch (-want +got):\n%s", diff)
+	}
+	if strings.Contains(string(got.Files[1].Contents), "My Secret") {
+		t.Errorf("provenance %s contains the payload", got.Files[1].Contents)
+	}
+	if len(got.ObjectVersion) != 1 || got.ObjectVersion[0].Id != cfg.Secrets[0].ResourceName {
+		t.Errorf("ObjectVersion = %v, want only the secret", got.ObjectVersion)
+	}
+
+	// A failed lookup is recorded in the file and the metric, the secret is
+	// still mounted.
+	getSecretErr = status.Error(codes.PermissionDenied, "no secrets.get")
+	before := metricValue(t, "secret_provenance_failure_count", map[string]string{"code": "PermissionDenied"})
+	got, err = handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	var failed secretProvenance
+	if err := json.Unmarshal(got.Files[1].Contents, &failed); err != nil {
+		t.Fatalf("provenance is not JSON: %v", err)
+	}
+	if !strings.Contains(failed.Error, "no secrets.get") || failed.Labels != nil {
+		t.Errorf("provenance = %+v, want only the lookup error", failed)
+	}
+	if d := metricValue(t, "secret_provenance_failure_count", map[string]string{"code": "PermissionDenied"}) - before; d != 1 {
+		t.Errorf("secret_provenance_failure_count increased by %v, want 1", d)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshingTokenSource reuses the token of a mount until window before it
+// expires, so that long mounts do not run into its expiry. refresh drops the
+// token after Secret Manager rejected it. The token sources of the credential
+// providers are static or only replace expired tokens, so each new token
+// comes from a source built again by newSource.
+type refreshingTokenSource struct {
+	newSource func() (oauth2.TokenSource, error)
+	window    time.Duration
+
+	mu sync.Mutex
+	// src serves the first token, later tokens use a new source.
+	src oauth2.TokenSource
+	tok *oauth2.Token
+}
+
+func newRefreshingTokenSource(src oauth2.TokenSource, newSource func() (oauth2.TokenSource, error), window time.Duration) *refreshingTokenSource {
+	return &refreshingTokenSource{src: src, newSource: newSource, window: window}
+}
+
+// Token implements oauth2.TokenSource.
+func (r *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tok != nil && (r.tok.Expiry.IsZero() || time.Until(r.tok.Expiry) > r.window) {
+		return r.tok, nil
+	}
+	src := r.src
+	if src == nil {
+		var err error
+		if src, err = r.newSource(); err != nil {
+			return nil, err
+		}
+	}
+	tok, err := src.Token()
+	if err != nil {
+		return nil, err
+	}
+	r.src = nil
+	r.tok = tok
+	return tok, nil
+}
+
+// refresh drops the current token.
+func (r *refreshingTokenSource) refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tok = nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// staticSources builds static token sources like those of the credential
+// providers, each with a new token numbered from 1.
+type staticSources struct {
+	mu     sync.Mutex
+	n      int
+	expiry time.Duration
+}
+
+func (s *staticSources) newSource() (oauth2.TokenSource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: fmt.Sprintf("token-%d", s.n), TokenType: "Bearer", Expiry: time.Now().Add(s.expiry)}), nil
+}
+
+// refreshingSource returns a refreshingTokenSource over sources.
+func refreshingSource(t *testing.T, sources *staticSources, window time.Duration) *refreshingTokenSource {
+	t.Helper()
+	src, err := sources.newSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRefreshingTokenSource(src, sources.newSource, window)
+}
+
+// tokenCreds sends the tokens of a token source without requiring transport
+// security, for use with the mock server.
+type tokenCreds struct {
+	ts oauth2.TokenSource
+}
+
+func (c tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	tok, err := c.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": tok.Type() + " " + tok.AccessToken}, nil
+}
+
+func (c tokenCreds) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestRefreshingTokenSource(t *testing.T) {
+	rts := refreshingSource(t, &staticSources{expiry: time.Hour}, time.Minute)
+	for i := 0; i < 2; i++ {
+		tok, err := rts.Token()
+		if err != nil {
+			t.Fatalf("Token() got err = %v, want nil", err)
+		}
+		if tok.AccessToken != "token-1" {
+			t.Errorf("Token() = %q, want the first token reused", tok.AccessToken)
+		}
+	}
+	rts.refresh()
+	if tok, _ := rts.Token(); tok.AccessToken != "token-2" {
+		t.Errorf("Token() after refresh = %q, want %q", tok.AccessToken, "token-2")
+	}
+
+	// Tokens expiring within the window are replaced before use.
+	rts = refreshingSource(t, &staticSources{expiry: 30 * time.Second}, time.Minute)
+	rts.Token()
+	if tok, _ := rts.Token(); tok.AccessToken != "token-2" {
+		t.Errorf("Token() near expiry = %q, want %q", tok.AccessToken, "token-2")
+	}
+
+	// A failure to build a new source is returned to the caller.
+	rts = newRefreshingTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token-1"}), func() (oauth2.TokenSource, error) {
+		return nil, fmt.Errorf("no credentials")
+	}, time.Minute)
+	rts.Token()
+	rts.refresh()
+	if _, err := rts.Token(); err == nil {
+		t.Errorf("Token() got err = nil, want the source error")
+	}
+}
+
+func TestHandleMountEventRetryUnauthenticated(t *testing.T) {
+	var mu sync.Mutex
+	used := false
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			// The first token expires after its first call.
+			if auth := md.Get("authorization"); len(auth) == 1 && auth[0] == "Bearer token-1" {
+				if used {
+					return nil, status.Error(codes.Unauthenticated, "token expired")
+				}
+				used = true
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	newCfg := func() *config.MountConfig {
+		return &config.MountConfig{
+			Secrets: []*config.Secret{
+				{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt"},
+				{ResourceName: "projects/project/secrets/test/versions/2", FileName: "good2.txt"},
+			},
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+	}
+
+	rts := refreshingSource(t, &staticSources{expiry: time.Hour}, time.Minute)
+	opts := MountOptions{RetryUnauthenticated: true, refreshCreds: rts.refresh}
+	got, err := handleMountEvent(context.Background(), client, tokenCreds{rts}, newCfg(), make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	for _, f := range got.Files {
+		if !bytes.Equal(f.Contents, []byte("My Secret")) {
+			t.Errorf("%s contents = %q, want %q", f.Path, f.Contents, "My Secret")
+		}
+	}
+
+	// Without the retry the expired token fails the mount.
+	mu.Lock()
+	used = false
+	mu.Unlock()
+	rts = refreshingSource(t, &staticSources{expiry: time.Hour}, time.Minute)
+	opts = MountOptions{refreshCreds: rts.refresh}
+	if _, err := handleMountEvent(context.Background(), client, tokenCreds{rts}, newCfg(), make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err == nil {
+		t.Errorf("handleMountEvent() got err = nil, want the Unauthenticated failure")
+	}
+}
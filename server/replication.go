@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/status"
+)
+
+// replicationSuffix is appended to the path of a secret to name its
+// replication file.
+const replicationSuffix = ".replication.json"
+
+// secretReplication describes where a secret is stored.
+type secretReplication struct {
+	// Type is "automatic", "user-managed" or "regional".
+	Type string `json:"type"`
+	// Locations lists the replica locations. It is empty for automatic
+	// replication where Google chooses the locations.
+	Locations []string `json:"locations,omitempty"`
+}
+
+// fetchReplication looks up the replication policy of the secret owning the
+// version. loc is the location of regional secrets, which are not replicated.
+func fetchReplication(ctx context.Context, client *secretmanager.Client, version, loc string, callOpts []gax.CallOption) (*secretReplication, error) {
+	if loc != "" {
+		return &secretReplication{Type: "regional", Locations: []string{loc}}, nil
+	}
+	secret, err := getSecret(ctx, client, version, callOpts)
+	if err != nil {
+		return nil, err
+	}
+	return replicationOf(secret), nil
+}
+
+// replicationOf returns the replication policy of a global secret.
+func replicationOf(secret *secretmanagerpb.Secret) *secretReplication {
+	if um := secret.GetReplication().GetUserManaged(); um != nil {
+		r := &secretReplication{Type: "user-managed"}
+		for _, replica := range um.GetReplicas() {
+			r.Locations = append(r.Locations, replica.GetLocation())
+		}
+		return r
+	}
+	return &secretReplication{Type: "automatic"}
+}
+
+// getSecret looks up the secret owning the version.
+func getSecret(ctx context.Context, client *secretmanager.Client, version string, callOpts []gax.CallOption) (*secretmanagerpb.Secret, error) {
+	name, _, _ := strings.Cut(version, "/versions/")
+
+	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_get_secret_requests")
+	secret, err := client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: name}, callOpts...)
+	if err != nil {
+		if e, ok := status.FromError(err); ok {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+		}
+		return nil, err
+	}
+	smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+	return secret, nil
+}
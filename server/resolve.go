@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// versionAlias reports whether the version of resource is an alias, such as
+// latest, rather than a version number.
+func versionAlias(resource string) bool {
+	i := strings.LastIndex(resource, "/versions/")
+	if i < 0 {
+		return false
+	}
+	_, err := strconv.ParseUint(resource[i+len("/versions/"):], 10, 64)
+	return err != nil
+}
+
+// resolveVersion returns the name of the version the alias resource points
+// to, e.g. projects/p/secrets/s/versions/7 for projects/p/secrets/s/versions/latest.
+func resolveVersion(ctx context.Context, client *secretmanager.Client, resource string, callOpts []gax.CallOption) (string, error) {
+	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_get_secret_version_requests")
+	version, err := client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{Name: resource}, callOpts...)
+	if err != nil {
+		if e, ok := status.FromError(err); ok {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+		}
+		return "", err
+	}
+	smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+	return version.GetName(), nil
+}
+
+// checkMinVersion fails with FailedPrecondition when the version number of
+// the accessed version name is below min.
+func checkMinVersion(name string, min int) error {
+	i := strings.LastIndex(name, "/versions/")
+	if i < 0 {
+		return status.Errorf(codes.FailedPrecondition, "unable to determine the version number of %s", name)
+	}
+	v, err := strconv.ParseUint(name[i+len("/versions/"):], 10, 64)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to determine the version number of %s", name)
+	}
+	if v < uint64(min) {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("accessed version %s is below the minimum version %d", name, min))
+	}
+	return nil
+}
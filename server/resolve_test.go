@@ -0,0 +1,99 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+)
+
+func TestVersionAlias(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     bool
+	}{
+		{resource: "projects/p/secrets/s/versions/latest", want: true},
+		{resource: "projects/p/locations/l/secrets/s/versions/prod", want: true},
+		{resource: "projects/p/secrets/s/versions/12", want: false},
+		{resource: "projects/p/secrets/s", want: false},
+	}
+	for _, tc := range tests {
+		if got := versionAlias(tc.resource); got != tc.want {
+			t.Errorf("versionAlias(%q) = %v, want %v", tc.resource, got, tc.want)
+		}
+	}
+}
+
+func TestHandleMountEventMinVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		minVersion int
+		wantErr    bool
+	}{
+		{name: "no floor", minVersion: 0},
+		{name: "above floor", minVersion: 5},
+		{name: "at floor", minVersion: 7},
+		{name: "below floor", minVersion: 8, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// latest is served by a replica still on version 7.
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    "projects/project/secrets/test/versions/7",
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: "projects/project/secrets/test/versions/latest", FileName: "good1.txt", MinVersion: tc.minVersion},
+				},
+				Permissions: 0640,
+				PodInfo:     &config.PodInfo{Namespace: "default", Name: "test-pod"},
+			}
+
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("handleMountEvent() got err = %v, want err = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMinVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     int
+		wantErr bool
+	}{
+		{name: "projects/p/secrets/s/versions/3", min: 3},
+		{name: "projects/p/locations/l/secrets/s/versions/10", min: 9},
+		{name: "projects/p/secrets/s/versions/2", min: 3, wantErr: true},
+		{name: "projects/p/secrets/s/versions/latest", min: 1, wantErr: true},
+		{name: "projects/p/secrets/s", min: 1, wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := checkMinVersion(tc.name, tc.min); (err != nil) != tc.wantErr {
+			t.Errorf("checkMinVersion(%q, %d) got err = %v, want err = %v", tc.name, tc.min, err, tc.wantErr)
+		}
+	}
+}
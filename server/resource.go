@@ -0,0 +1,50 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"regexp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	globalSecretRegexp   = regexp.MustCompile(globalSecretRegex)
+	regionalSecretRegexp = regexp.MustCompile(regionalSecretRegex)
+)
+
+// resourceName is a parsed secret version resource name.
+type resourceName struct {
+	project string
+	// location is empty for global secrets.
+	location string
+	secret   string
+	version  string
+}
+
+// parseResourceName parses a secret version resource name in the format
+// projects/*/secrets/*/versions/* or
+// projects/*/locations/*/secrets/*/versions/*. Other input fails with an
+// InvalidArgument error naming the resource.
+func parseResourceName(resource string) (resourceName, error) {
+	if m := globalSecretRegexp.FindStringSubmatch(resource); m != nil {
+		return resourceName{project: m[1], secret: m[2], version: m[3]}, nil
+	}
+	if m := regionalSecretRegexp.FindStringSubmatch(resource); m != nil {
+		return resourceName{project: m[1], location: m[2], secret: m[3], version: m[4]}, nil
+	}
+	return resourceName{}, status.Errorf(codes.InvalidArgument, "Invalid secret resource name: %s", resource)
+}
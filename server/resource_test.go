@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseResourceName(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    resourceName
+		wantErr bool
+	}{
+		{
+			in:   "projects/project/secrets/test/versions/1",
+			want: resourceName{project: "project", secret: "test", version: "1"},
+		},
+		{
+			in:   "projects/project/locations/us-central1/secrets/test/versions/latest",
+			want: resourceName{project: "project", location: "us-central1", secret: "test", version: "latest"},
+		},
+		{in: "projects/project/locations/split/location/secrets/test/versions/latest", wantErr: true},
+		{in: "projects/project/secrets/test", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parseResourceName(tc.in)
+		if tc.wantErr {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("parseResourceName(%q) got err = %v, want InvalidArgument", tc.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseResourceName(%q) got err = %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseResourceName(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func FuzzParseResourceName(f *testing.F) {
+	for _, seed := range []string{
+		"projects/project/secrets/test/versions/1",
+		"projects/project/locations/us-central1/secrets/test/versions/latest",
+		"projects/project/locations/very_very_very_very_very_very_very_very_long_location/secrets/test/versions/latest",
+		"projects/project/locations/split/location/secrets/test/versions/latest",
+		"projects//secrets//versions/",
+		"projects/プロジェクト/secrets/秘密/versions/1",
+		"projects/p/secrets/s/versions/1/",
+		"/projects/p/secrets/s/versions/1\x00",
+		strings.Repeat("projects/", 1000) + "p/secrets/s/versions/1",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		got, err := parseResourceName(in)
+		if err != nil {
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "Invalid secret resource name") {
+				t.Errorf("parseResourceName(%q) got err = %v, want a descriptive InvalidArgument error", in, err)
+			}
+			return
+		}
+		for _, part := range []string{got.project, got.secret, got.version} {
+			if part == "" || strings.Contains(part, "/") {
+				t.Errorf("parseResourceName(%q) = %+v, want non-empty segments without slashes", in, got)
+			}
+		}
+		if strings.Contains(got.location, "/") {
+			t.Errorf("parseResourceName(%q) location = %q, want no slashes", in, got.location)
+		}
+		if !strings.HasSuffix(in, "/versions/"+got.version) {
+			t.Errorf("parseResourceName(%q) version = %q, want the trailing segment", in, got.version)
+		}
+	})
+}
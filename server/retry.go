@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryableCodes are the status codes on which AccessSecretVersion calls are
+// retried. These match the defaults of the secretmanager client library.
+var retryableCodes = []codes.Code{
+	codes.Unavailable,
+	codes.ResourceExhausted,
+}
+
+// maxRetryBackoff caps the pause between attempts. It matches the maximum
+// used by the secretmanager client library for AccessSecretVersion so that a
+// large MaxAttempts cannot stall a mount on a single pause.
+const maxRetryBackoff = 60 * time.Second
+
+// RetryPolicy controls how failed AccessSecretVersion calls are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one. A
+	// value of 0 keeps the secretmanager client library defaults.
+	MaxAttempts int
+	// Backoff is the initial pause between attempts. It doubles after each
+	// retry up to maxRetryBackoff.
+	Backoff time.Duration
+}
+
+// retryRules are the mount wide settings applied by every retryer of a
+// mount.
+type retryRules struct {
+	// messages are retried regardless of their code, see retryable.
+	messages []string
+	// deadline stops retrying when the next attempt would start after it.
+	// There is no deadline when zero.
+	deadline time.Time
+}
+
+// retry reports whether err is retried after pause.
+func (r retryRules) retry(err error, pause time.Duration) bool {
+	if !retryable(err, r.messages) {
+		return false
+	}
+	return r.deadline.IsZero() || !time.Now().Add(pause).After(r.deadline)
+}
+
+// callOption returns the gax call option applying the policy, or nil if the
+// client library defaults should be used. If retries is not nil it is
+// incremented on every retry.
+func (p RetryPolicy) callOption(retries *int, rules retryRules) gax.CallOption {
+	if p.MaxAttempts <= 0 {
+		return nil
+	}
+	return gax.WithRetry(func() gax.Retryer {
+		return &attemptRetryer{
+			retries:     retries,
+			maxAttempts: p.MaxAttempts,
+			rules:       rules,
+			backoff: gax.Backoff{
+				Initial:    p.Backoff,
+				Max:        maxRetryBackoff,
+				Multiplier: 2,
+			},
+		}
+	})
+}
+
+// attemptRetryer is a gax.Retryer that stops after a fixed number of attempts.
+type attemptRetryer struct {
+	retries     *int
+	maxAttempts int
+	attempts    int
+	backoff     gax.Backoff
+	rules       retryRules
+}
+
+// Retry implements gax.Retryer.
+func (r *attemptRetryer) Retry(err error) (time.Duration, bool) {
+	r.attempts++
+	if r.attempts >= r.maxAttempts {
+		return 0, false
+	}
+	pause := r.backoff.Pause()
+	if !r.rules.retry(err, pause) {
+		return 0, false
+	}
+	if r.retries != nil {
+		*r.retries++
+	}
+	return pause, true
+}
+
+// fatalCodes are never retried, even when the error message matches a
+// retryable message: the request itself is wrong and fails the same way every
+// time.
+var fatalCodes = []codes.Code{
+	codes.InvalidArgument,
+	codes.NotFound,
+	codes.PermissionDenied,
+	codes.Unauthenticated,
+	codes.FailedPrecondition,
+}
+
+// retryable reports whether err has one of retryableCodes or, unless its code
+// is one of fatalCodes, contains one of messages. Responses larger than the
+// receive limit are not retried, they fail the same way every time.
+func retryable(err error, messages []string) bool {
+	s, ok := status.FromError(err)
+	if !ok || messageTooLarge(err) || slices.Contains(fatalCodes, s.Code()) {
+		return false
+	}
+	if slices.Contains(retryableCodes, s.Code()) {
+		return true
+	}
+	for _, m := range messages {
+		if strings.Contains(s.Message(), m) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultRetryOption returns the call option used without a RetryPolicy. It
+// matches the secretmanager client library retry for AccessSecretVersion
+// except that it applies rules.
+func defaultRetryOption(rules retryRules) gax.CallOption {
+	return gax.WithRetry(func() gax.Retryer {
+		return &defaultRetryer{
+			rules: rules,
+			backoff: gax.Backoff{
+				Initial:    2 * time.Second,
+				Max:        maxRetryBackoff,
+				Multiplier: 2,
+			},
+		}
+	})
+}
+
+// defaultRetryer is the gax.Retryer of defaultRetryOption.
+type defaultRetryer struct {
+	backoff gax.Backoff
+	rules   retryRules
+}
+
+// Retry implements gax.Retryer.
+func (r *defaultRetryer) Retry(err error) (time.Duration, bool) {
+	pause := r.backoff.Pause()
+	return pause, r.rules.retry(err, pause)
+}
+
+// ParseRetryPolicies parses per-location retry policies in the form
+// "us-central1=5:200ms,global=3:1s" where each value is the maximum number of
+// attempts and the initial backoff.
+func ParseRetryPolicies(s string) (map[string]RetryPolicy, error) {
+	out := make(map[string]RetryPolicy)
+	if s == "" {
+		return out, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		loc, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || loc == "" {
+			return nil, fmt.Errorf("invalid retry policy %q: expected location=attempts:backoff", entry)
+		}
+		attempts, backoff, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid retry policy %q: expected location=attempts:backoff", entry)
+		}
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid retry policy %q: attempts must be a positive integer", entry)
+		}
+		d, err := time.ParseDuration(backoff)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid retry policy %q: invalid backoff", entry)
+		}
+		out[loc] = RetryPolicy{MaxAttempts: n, Backoff: d}
+	}
+	return out, nil
+}
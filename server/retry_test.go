@@ -0,0 +1,162 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseRetryPolicies(t *testing.T) {
+	got, err := ParseRetryPolicies("us-central1=5:200ms, global=2:1s")
+	if err != nil {
+		t.Fatalf("ParseRetryPolicies() got err = %v, want nil", err)
+	}
+	want := map[string]RetryPolicy{
+		"us-central1": {MaxAttempts: 5, Backoff: 200 * time.Millisecond},
+		"global":      {MaxAttempts: 2, Backoff: time.Second},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseRetryPolicies() returned diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseRetryPoliciesErrors(t *testing.T) {
+	for _, in := range []string{
+		"us-central1",
+		"=3:1s",
+		"us-central1=3",
+		"us-central1=0:1s",
+		"us-central1=x:1s",
+		"us-central1=3:forever",
+	} {
+		if _, err := ParseRetryPolicies(in); err == nil {
+			t.Errorf("ParseRetryPolicies(%q) got err = nil, want error", in)
+		}
+	}
+}
+
+func TestHandleMountEventRetryMessages(t *testing.T) {
+	const secret = "projects/project/secrets/test/versions/1"
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int32
+		wantErr   bool
+	}{
+		{name: "matching message", err: status.Error(codes.Internal, "backend transiently overloaded"), wantCalls: 2},
+		{name: "other message", err: status.Error(codes.Internal, "backend broken"), wantCalls: 1, wantErr: true},
+		{name: "fatal code", err: status.Error(codes.PermissionDenied, "backend transiently overloaded"), wantCalls: 1, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					if calls.Add(1) == 1 {
+						return nil, tc.err
+					}
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: secret, FileName: "good1.txt"},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			opts := MountOptions{
+				DefaultRetryPolicy: RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+				RetryMessages:      ParseList(" transiently overloaded ,"),
+			}
+
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("handleMountEvent() got err = %v, want error %v", err, tc.wantErr)
+			}
+			if got := calls.Load(); got != tc.wantCalls {
+				t.Errorf("AccessSecretVersion() calls = %d, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventMaxRetryDuration(t *testing.T) {
+	const secret = "projects/project/secrets/test/versions/1"
+	const ceiling = 200 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+	}{
+		{name: "retry policy", policy: RetryPolicy{MaxAttempts: 1000, Backoff: 10 * time.Millisecond}},
+		// The client library backoff starts above the ceiling.
+		{name: "library defaults"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					calls.Add(1)
+					return nil, status.Error(codes.Unavailable, "try again")
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: secret, FileName: "good1.txt"},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			opts := MountOptions{DefaultRetryPolicy: tc.policy, MaxRetryDuration: ceiling}
+
+			start := time.Now()
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+			elapsed := time.Since(start)
+			if status.Code(err) != codes.Internal || !strings.Contains(err.Error(), "try again") {
+				t.Errorf("handleMountEvent() got err = %v, want the last failure", err)
+			}
+			if elapsed > ceiling+time.Second {
+				t.Errorf("handleMountEvent() returned after %v, want near the %v ceiling", elapsed, ceiling)
+			}
+			if tc.policy.MaxAttempts > 0 && calls.Load() < 2 {
+				t.Errorf("AccessSecretVersion() calls = %d, want retries until the ceiling", calls.Load())
+			}
+		})
+	}
+}
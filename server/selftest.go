@@ -0,0 +1,60 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/credentials"
+)
+
+// SelfTest accesses each of the resources through the same path used for
+// mount events and writes a PASS or FAIL line per resource to w. Payloads are
+// discarded. It returns an error if any resource could not be accessed.
+func SelfTest(ctx context.Context, client *secretmanager.Client, creds credentials.PerRPCCredentials, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption, opts MountOptions, resources []string, w io.Writer) error {
+	if len(resources) == 0 {
+		return fmt.Errorf("no resources to self test")
+	}
+
+	failed := 0
+	for _, resource := range resources {
+		target := globalLocation
+		if loc, err := locationFromSecretResource(resource); err == nil && loc != "" {
+			target = loc
+		}
+
+		cfg := &config.MountConfig{
+			Secrets:         []*config.Secret{{ResourceName: resource, FileName: "selftest"}},
+			PodInfo:         &config.PodInfo{},
+			AuthProviderADC: true,
+		}
+		if _, err := handleMountEvent(ctx, client, creds, cfg, regionalClients, smOpts, opts); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s %s: %v\n", target, resource, err)
+			continue
+		}
+		fmt.Fprintf(w, "PASS %s %s\n", target, resource)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("self test failed for %d of %d resources", failed, len(resources))
+	}
+	return nil
+}
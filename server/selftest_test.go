@@ -0,0 +1,85 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSelfTest(t *testing.T) {
+	const globalSecret = "projects/project/secrets/test/versions/latest"
+	const regionalSecret = "projects/project/locations/us-central1/secrets/test/versions/latest"
+
+	ok := func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		return &secretmanagerpb.AccessSecretVersionResponse{
+			Name:    req.Name,
+			Payload: &secretmanagerpb.SecretPayload{Data: []byte("top secret")},
+		}, nil
+	}
+	denied := func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+
+	tests := []struct {
+		name       string
+		regionalFn func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error)
+		wantErr    bool
+		wantOut    []string
+	}{
+		{
+			name:       "pass",
+			regionalFn: ok,
+			wantOut:    []string{"PASS global " + globalSecret, "PASS us-central1 " + regionalSecret},
+		},
+		{
+			name:       "regional failure",
+			regionalFn: denied,
+			wantErr:    true,
+			wantOut:    []string{"PASS global " + globalSecret, "FAIL us-central1 " + regionalSecret},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{accessFn: ok})
+			regionalClients := map[string]*secretmanager.Client{
+				"us-central1": mock(t, &mockSecretServer{accessFn: tt.regionalFn}),
+			}
+
+			var out bytes.Buffer
+			err := SelfTest(context.Background(), client, NewFakeCreds(), regionalClients, []option.ClientOption{}, MountOptions{}, []string{globalSecret, regionalSecret}, &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SelfTest() got err = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, line := range tt.wantOut {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("SelfTest() output = %q, want line %q", out.String(), line)
+				}
+			}
+			if strings.Contains(out.String(), "top secret") {
+				t.Errorf("SelfTest() output leaked payload: %q", out.String())
+			}
+		})
+	}
+}
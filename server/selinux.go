@@ -0,0 +1,34 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "errors"
+
+// errSELinuxUnsupported is returned when SELinux labels can not be set on the
+// node, e.g. SELinux is disabled or the platform is not Linux.
+var errSELinuxUnsupported = errors.New("SELinux labels are not supported on this node")
+
+// selinuxFS is where an SELinux enabled kernel mounts selinuxfs.
+var selinuxFS = "/sys/fs/selinux"
+
+// applySELinuxContext labels path with the SELinux context label.
+//
+// The driver, not the provider, writes the secret files once the mount
+// response is returned, so the label is applied to the mount directory and
+// files created in it inherit the directory context under the default
+// policy. It returns errSELinuxUnsupported when SELinux is not available.
+func applySELinuxContext(path, label string) error {
+	return setSELinuxLabel(path, label)
+}
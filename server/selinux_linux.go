@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSELinuxLabel sets the security.selinux extended attribute of path.
+func setSELinuxLabel(path, label string) error {
+	if _, err := os.Stat(filepath.Join(selinuxFS, "enforce")); err != nil {
+		return errSELinuxUnsupported
+	}
+	err := unix.Lsetxattr(path, "security.selinux", []byte(label), 0)
+	if errors.Is(err, unix.ENOTSUP) {
+		return errSELinuxUnsupported
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+)
+
+// withoutSELinux makes the node look like SELinux is disabled.
+func withoutSELinux(t *testing.T) {
+	orig := selinuxFS
+	selinuxFS = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { selinuxFS = orig })
+}
+
+func TestApplySELinuxContextUnsupported(t *testing.T) {
+	withoutSELinux(t)
+	if err := applySELinuxContext(t.TempDir(), "system_u:object_r:container_file_t:s0"); !errors.Is(err, errSELinuxUnsupported) {
+		t.Errorf("applySELinuxContext() got err = %v, want %v", err, errSELinuxUnsupported)
+	}
+}
+
+func TestHandleMountEventSELinuxUnsupported(t *testing.T) {
+	withoutSELinux(t)
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt"},
+		},
+		TargetPath:     t.TempDir(),
+		SELinuxContext: "system_u:object_r:container_file_t:s0",
+		Permissions:    777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	before := metricValue(t, "selinux_label_count", map[string]string{"result": "unsupported"})
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want the mount to succeed", err)
+	}
+	if len(got.Files) != 1 {
+		t.Errorf("handleMountEvent() got %d files, want 1", len(got.Files))
+	}
+	if got := metricValue(t, "selinux_label_count", map[string]string{"result": "unsupported"}) - before; got != 1 {
+		t.Errorf("selinux_label_count{result=unsupported} increased by %v, want 1", got)
+	}
+}
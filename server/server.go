@@ -17,13 +17,17 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"os"
-	"regexp"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/auth"
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
@@ -32,6 +36,7 @@ import (
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
@@ -50,12 +55,32 @@ type Server struct {
 	SecretClient          *secretmanager.Client
 	RegionalSecretClients map[string]*secretmanager.Client
 	SmOpts                []option.ClientOption
+	MountOptions          MountOptions
+	// MountLimiter caps concurrent mount events. No limit applies when nil.
+	MountLimiter *MountLimiter
+	// CredentialProviders authenticate mounts, the first one applying to a
+	// mount is used. The built-in providers of AuthClient are used when nil.
+	CredentialProviders []auth.CredentialProvider
+	// Pods looks up the mounting pod for mounts with a gate annotation, which
+	// fail when nil, and for SkipTerminatingPods.
+	Pods PodMetadataSource
+	// SkipTerminatingPods fails the mounts of pods being deleted before any
+	// secret is fetched.
+	SkipTerminatingPods bool
 }
 
 var _ v1alpha1.CSIDriverProviderServer = &Server{}
 
 // Mount implements provider csi-provider method
 func (s *Server) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+	if s.MountLimiter != nil {
+		release, err := s.MountLimiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
 	p, err := strconv.ParseUint(req.GetPermission(), 10, 32)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to parse permissions: %s", req.GetPermission()))
@@ -74,7 +99,21 @@ func (s *Server) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alph
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	ts, err := s.AuthClient.TokenSource(ctx, cfg)
+	if err := s.lookupPod(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	providers := s.CredentialProviders
+	if providers == nil {
+		providers = s.AuthClient.Providers()
+	}
+	provider, err := auth.SelectProvider(providers, cfg)
+	if err != nil {
+		klog.ErrorS(err, "unable to obtain auth for mount", "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("unable to obtain auth for mount: %v", err))
+	}
+	klog.V(5).InfoS("selected credential provider", "provider", provider.Name(), "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+	ts, err := provider.TokenSource(ctx, cfg)
 	if err != nil {
 		klog.ErrorS(err, "unable to obtain auth for mount", "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
 		return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("unable to obtain auth for mount: %v", err))
@@ -83,11 +122,18 @@ func (s *Server) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alph
 	// Build a grpc credentials.PerRPCCredentials using
 	// the grpc google.golang.org/grpc/credentials/oauth package, not to be
 	// confused with the oauth2.TokenSource that it wraps.
-	gts := oauth.TokenSource{TokenSource: ts}
+	rts := newRefreshingTokenSource(ts, func() (oauth2.TokenSource, error) {
+		return provider.TokenSource(ctx, cfg)
+	}, s.MountOptions.TokenRefreshWindow)
+	gts := oauth.TokenSource{TokenSource: rts}
+	opts := s.MountOptions
+	opts.impersonate = impersonator(ctx, rts)
+	opts.refreshCreds = rts.refresh
+	opts.provider = provider.Name()
 
 	// Fetch the secrets from the secretmanager API based on the
 	// SecretProviderClass configuration.
-	return handleMountEvent(ctx, s.SecretClient, gts, cfg, s.RegionalSecretClients, s.SmOpts)
+	return handleMountEvent(ctx, s.SecretClient, gts, cfg, s.RegionalSecretClients, s.SmOpts, opts)
 }
 
 // Version implements provider csi-provider method
@@ -101,64 +147,46 @@ func (s *Server) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1
 
 // handleMountEvent fetches the secrets from the secretmanager API and
 // include them in the MountResponse based on the SecretProviderClass
-// configuration.
-func handleMountEvent(ctx context.Context, client *secretmanager.Client, creds credentials.PerRPCCredentials, cfg *config.MountConfig, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption) (*v1alpha1.MountResponse, error) {
-	results := make([]*secretmanagerpb.AccessSecretVersionResponse, len(cfg.Secrets))
-	errs := make([]error, len(cfg.Secrets))
+// configuration. The mount is validated, its secrets are fetched, then
+// transformed and written to the response.
+func handleMountEvent(ctx context.Context, client *secretmanager.Client, creds credentials.PerRPCCredentials, cfg *config.MountConfig, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption, opts MountOptions) (_ *v1alpha1.MountResponse, err error) {
+	defer func() { csrmetrics.RecordMount(cfg.Labels, err == nil) }()
+	// Mounts failing before their secrets are recorded count once.
+	recorded := false
+	defer func() {
+		if err != nil && !recorded {
+			opts.ErrorRate.record(err)
+		}
+	}()
 
-	// need to build a per-rpc call option based of the tokensource
-	callAuth := gax.WithGRPCOptions(grpc.PerRPCCredentials(creds))
+	if resp, err := validateMount(cfg, opts); resp != nil || err != nil {
+		return resp, err
+	}
 
-	// In parallel fetch all secrets needed for the mount
-	wg := sync.WaitGroup{}
-	for i, secret := range cfg.Secrets {
-		loc, err := locationFromSecretResource(secret.ResourceName)
-		if err != nil {
-			errs[i] = err
-			continue
-		}
+	budget := newCallBudget(opts.CallBudget)
+	lookupOpts := []gax.CallOption{gax.WithGRPCOptions(grpc.PerRPCCredentials(creds))}
+	if err := deriveFileNames(ctx, cfg.Secrets, opts.FileNameSanitization, client, regionalClients, smOpts, budget, lookupOpts); err != nil {
+		return nil, err
+	}
 
-		if len(loc) > locationLengthLimit {
-			errs[i] = fmt.Errorf("invalid location string, please check the location")
-			continue
-		}
-		var secretClient *secretmanager.Client
-		if loc == "" {
-			secretClient = client
-		} else {
-			if _, ok := regionalClients[loc]; !ok {
-				ep := option.WithEndpoint(fmt.Sprintf("secretmanager.%s.rep.googleapis.com:443", loc))
-				regionalClient, err := secretmanager.NewClient(ctx, append(smOpts, ep)...)
-				if err != nil {
-					errs[i] = err
-					continue
-				}
-				regionalClients[loc] = regionalClient
-			}
-			secretClient = regionalClients[loc]
-		}
-		wg.Add(1)
-		i, secret := i, secret
-		go func() {
-			defer wg.Done()
-			req := &secretmanagerpb.AccessSecretVersionRequest{
-				Name: secret.ResourceName,
-			}
-			smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_access_secret_version_requests")
+	if err := checkPaths(cfg); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
-			resp, err := secretClient.AccessSecretVersion(ctx, req, callAuth)
-			if err != nil {
-				if e, ok := status.FromError(err); ok {
-					smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
-				}
-			} else {
-				smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
-			}
-			results[i] = resp
-			errs[i] = err
-		}()
+	order, err := dependencyOrder(cfg.Secrets, secretOrder(cfg.Secrets, opts.ResponseOrder))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	wg.Wait()
+
+	fetched := newFetchedSecrets(len(cfg.Secrets))
+	defer fetched.release(opts.Cache)
+	fetchSecrets(ctx, client, creds, cfg, regionalClients, smOpts, opts, budget, fetched)
+
+	fetched.skipOptional(cfg, opts)
+	for _, err := range fetched.errs {
+		opts.ErrorRate.record(err)
+	}
+	recorded = true
 
 	// If any access failed, return a grpc status error that includes each
 	// individual status error in the Details field.
@@ -169,57 +197,927 @@ func handleMountEvent(ctx context.Context, client *secretmanager.Client, creds c
 	// By erroring out on any failures we prevent partial rotations (i.e. the
 	// username file was updated to a new value but the corresponding password
 	// field was not).
-	if err := buildErr(errs); err != nil {
+	names := make([]string, len(cfg.Secrets))
+	for i, secret := range cfg.Secrets {
+		names[i] = secret.ResourceName
+	}
+	if err := buildErr(fetched.errs, names, opts.ErrorFormat); err != nil {
+		return nil, err
+	}
+
+	if opts.DetectVersionDivergence {
+		for _, d := range divergentVersions(cfg.Secrets, fetched.results) {
+			csrmetrics.RecordVersionDivergence()
+			klog.InfoS("WARNING: secret resolved to different versions across locations", "secret", d.secret, "versions", d.versions, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		}
+	}
+
+	out, err := writeResponse(cfg, opts, order, fetched)
+	if err != nil {
 		return nil, err
 	}
 
-	out := &v1alpha1.MountResponse{}
+	// Labeling is best effort, nodes without SELinux still get their secrets.
+	if cfg.SELinuxContext != "" {
+		err := applySELinuxContext(cfg.TargetPath, cfg.SELinuxContext)
+		switch {
+		case err == nil:
+			csrmetrics.RecordSELinuxLabel(csrmetrics.SELinuxApplied)
+		case errors.Is(err, errSELinuxUnsupported):
+			csrmetrics.RecordSELinuxLabel(csrmetrics.SELinuxUnsupported)
+			klog.InfoS("WARNING: unable to apply SELinux context", "err", err, "context", cfg.SELinuxContext, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		default:
+			csrmetrics.RecordSELinuxLabel(csrmetrics.SELinuxFailed)
+			klog.ErrorS(err, "failed to apply SELinux context", "context", cfg.SELinuxContext, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		}
+	}
+
+	return out, nil
+}
+
+// validateMount checks the mount and its secrets before anything is fetched.
+// Secret resource names are resolved against the default project. Mounts
+// answered without fetching secrets, such as mounts without secrets or gated
+// pods, get their response from it.
+func validateMount(cfg *config.MountConfig, opts MountOptions) (*v1alpha1.MountResponse, error) {
+	if cfg.PodInfo.Terminating {
+		klog.InfoS("skipping mount of terminating pod", "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		return nil, status.Error(codes.FailedPrecondition, "pod is terminating, its secrets were not fetched")
+	}
+
+	// Some orchestration briefly produces mounts without secrets, they get an
+	// empty response unless the operator asks for them to fail.
+	if len(cfg.Secrets) == 0 {
+		if opts.FailOnEmptyMount {
+			return nil, status.Error(codes.InvalidArgument, "mount requests no secrets")
+		}
+		klog.V(3).InfoS("mount requests no secrets", "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		return &v1alpha1.MountResponse{}, nil
+	}
+
+	if opts.CheckTargetWritable && cfg.TargetPath != "" {
+		if err := checkTargetWritable(cfg.TargetPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.MaxSecretsPerMount > 0 && len(cfg.Secrets) > opts.MaxSecretsPerMount {
+		return nil, status.Errorf(codes.InvalidArgument, "mount requests %d secrets which exceeds the limit of %d secrets per mount", len(cfg.Secrets), opts.MaxSecretsPerMount)
+	}
+
+	authMode, principal := cfg.Identity()
+	klog.V(3).InfoS("mount identity", "auth", authMode, "principal", principal, "provider", opts.provider, "impersonated", impersonatedAccounts(cfg.Secrets), "labels", cfg.Labels, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+
+	if opts.ForbidLatest {
+		for _, secret := range cfg.Secrets {
+			if strings.HasSuffix(secret.ResourceName, "/versions/latest") {
+				return nil, status.Errorf(codes.FailedPrecondition, "secret %s uses the latest version alias which is forbidden by policy, pin a numeric version instead", secret.ResourceName)
+			}
+		}
+	}
+
+	if err := checkAllowlists(cfg.Secrets, opts); err != nil {
+		return nil, err
+	}
+
+	var err error
+	for _, secret := range cfg.Secrets {
+		if _, err := fileMode(secret, 0); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if secret.ResourceName, err = resolveProject(secret.ResourceName, opts.DefaultProject); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if secret.TransformPasswordSecret, err = resolveProject(secret.TransformPasswordSecret, opts.DefaultProject); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if opts.KnownLocations != nil {
+			if err := checkLocation(secret.ResourceName, opts.KnownLocations); err != nil {
+				return nil, err
+			}
+			if err := checkLocation(secret.TransformPasswordSecret, opts.KnownLocations); err != nil {
+				return nil, err
+			}
+			if err := checkReplicaLocations(secret, opts.KnownLocations); err != nil {
+				return nil, err
+			}
+		}
+		if opts.SameProject != "" {
+			if err := checkSameProject(secret.ResourceName, opts.SameProject, opts.AllowedProjects); err != nil {
+				return nil, err
+			}
+			if secret.TransformPasswordSecret != "" {
+				if err := checkSameProject(secret.TransformPasswordSecret, opts.SameProject, opts.AllowedProjects); err != nil {
+					return nil, err
+				}
+			}
+			for _, p := range secret.FallbackProjects {
+				if err := checkSameProject(fallbackResource(secret.ResourceName, p), opts.SameProject, opts.AllowedProjects); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if cfg.GateAnnotation != "" && !gateOpen(cfg) {
+		if err := checkPaths(cfg); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		klog.InfoS("pod lacks the gate annotation, writing placeholders instead of secrets", "annotation", cfg.GateAnnotation, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		return placeholderResponse(cfg)
+	}
+
+	return nil, nil
+}
+
+// fetchedSecrets holds what was fetched for each secret of a mount, indexed
+// like MountConfig.Secrets.
+type fetchedSecrets struct {
+	results     []*secretmanagerpb.AccessSecretVersionResponse
+	errs        []error
+	metadata    []*secretMetadata
+	timings     []secretTiming
+	replication []*secretReplication
+	provenance  []*secretProvenance
+	passwords   [][]byte
+	previous    [][][]byte
+	// held are the cache keys the mount references while it runs.
+	held []string
+}
+
+func newFetchedSecrets(n int) *fetchedSecrets {
+	return &fetchedSecrets{
+		results:     make([]*secretmanagerpb.AccessSecretVersionResponse, n),
+		errs:        make([]error, n),
+		metadata:    make([]*secretMetadata, n),
+		timings:     make([]secretTiming, n),
+		replication: make([]*secretReplication, n),
+		provenance:  make([]*secretProvenance, n),
+		passwords:   make([][]byte, n),
+		previous:    make([][][]byte, n),
+		held:        make([]string, n),
+	}
+}
+
+// release drops the cache references held by the mount.
+func (f *fetchedSecrets) release(cache *SecretCache) {
+	for _, key := range f.held {
+		if key != "" {
+			cache.release(key)
+		}
+	}
+}
+
+// skipOptional clears the failures of optional secrets. Both outcomes are
+// counted so operators can tell which secrets should be marked optional.
+func (f *fetchedSecrets) skipOptional(cfg *config.MountConfig, opts MountOptions) {
+	for i, secret := range cfg.Secrets {
+		if f.errs[i] == nil {
+			continue
+		}
+		code := status.Code(f.errs[i])
+		if secret.Optional {
+			csrmetrics.RecordSecretFailure(csrmetrics.SecretOptional, code.String())
+			// Expected failures, such as NotFound for secrets that only
+			// exist in some environments, can be demoted to keep the logs
+			// readable. Required secrets are always logged.
+			level := klog.Level(0)
+			if opts.LogSuppressCodes[code] {
+				level = suppressedLogLevel
+			}
+			klog.V(level).InfoS("skipping optional secret", "resource_name", secret.ResourceName, "err", f.errs[i], "labels", cfg.Labels, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+			f.errs[i] = nil
+			f.results[i] = nil
+			continue
+		}
+		csrmetrics.RecordSecretFailure(csrmetrics.SecretRequired, code.String())
+	}
+}
+
+// secretFetch is a secret of a mount along with the clients and call options
+// used to fetch it.
+type secretFetch struct {
+	i      int
+	secret *config.Secret
+	loc    string
+	client *secretmanager.Client
+	// passwordClient is nil unless the secret has a TransformPasswordSecret.
+	passwordClient *secretmanager.Client
+	replicas       []replica
+	policy         RetryPolicy
+	callOpts       []gax.CallOption
+}
+
+// mountFetcher fetches the secrets of a mount into fetched.
+type mountFetcher struct {
+	cfg      *config.MountConfig
+	opts     MountOptions
+	rules    retryRules
+	budget   *callBudget
+	versions *versionFetcher
+	fetched  *fetchedSecrets
+}
+
+// fetchSecrets fetches all secrets needed for the mount in parallel, or in
+// parallel per location when grouping is enabled. Failures are stored per
+// secret in fetched.
+func fetchSecrets(ctx context.Context, client *secretmanager.Client, creds credentials.PerRPCCredentials, cfg *config.MountConfig, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption, opts MountOptions, budget *callBudget, fetched *fetchedSecrets) {
+	rules := retryRules{messages: opts.RetryMessages}
+	if opts.MaxRetryDuration > 0 {
+		rules.deadline = time.Now().Add(opts.MaxRetryDuration)
+	}
+
+	// Per-rpc call options are built from the tokensource of the mount, or
+	// of the service account a secret impersonates.
+	ids := &identities{mount: creds, impersonate: opts.impersonate}
+	var baseOpts []gax.CallOption
+	if compress := compressionCallOption(opts.Compression); compress != nil {
+		baseOpts = append(baseOpts, compress)
+	}
+	if recv := maxRecvMsgSizeCallOption(opts.MaxRecvMsgSize); recv != nil {
+		baseOpts = append(baseOpts, recv)
+	}
 
-	// Add secrets to response.
-	ovs := make([]*v1alpha1.ObjectVersion, len(cfg.Secrets))
+	m := &mountFetcher{cfg: cfg, opts: opts, rules: rules, budget: budget, versions: newVersionFetcher(), fetched: fetched}
+	fetches := make(map[string][]func())
+	var locs []string
 	for i, secret := range cfg.Secrets {
-		if cfg.Permissions > math.MaxInt32 {
-			return nil, fmt.Errorf("invalid file permission %d", cfg.Permissions)
+		secretClient, loc, err := secretClientFor(ctx, secret.ResourceName, client, regionalClients, smOpts)
+		if err != nil {
+			fetched.errs[i] = err
+			continue
+		}
+		s := secretFetch{i: i, secret: secret, loc: loc, client: secretClient}
+		if secret.TransformPasswordSecret != "" {
+			s.passwordClient, _, err = secretClientFor(ctx, secret.TransformPasswordSecret, client, regionalClients, smOpts)
+			if err != nil {
+				fetched.errs[i] = err
+				continue
+			}
+		}
+		if len(secret.ReplicaLocations) > 0 {
+			s.replicas, err = replicasFor(ctx, secret, client, regionalClients, smOpts)
+			if err != nil {
+				fetched.errs[i] = err
+				continue
+			}
+		}
+		secretCreds, err := ids.get(secret.ImpersonateServiceAccount)
+		if err != nil {
+			fetched.errs[i] = err
+			continue
+		}
+		s.callOpts = append([]gax.CallOption{gax.WithGRPCOptions(grpc.PerRPCCredentials(secretCreds))}, baseOpts...)
+		s.policy = opts.retryPolicy(loc)
+		if retry := s.policy.callOption(&fetched.timings[i].retries, rules); retry != nil {
+			s.callOpts = append(s.callOpts, retry)
+		} else {
+			s.callOpts = append(s.callOpts, defaultRetryOption(rules))
+		}
+		fetched.timings[i].location = loc
+		fetched.timings[i].countsRetries = s.policy.MaxAttempts > 0 || secret.ResolveAttempts > 0 || secret.PayloadAttempts > 0
+		if _, ok := fetches[loc]; !ok {
+			locs = append(locs, loc)
+		}
+		fetches[loc] = append(fetches[loc], func() { m.fetch(ctx, s) })
+	}
+	runFetches(locs, fetches, opts.GroupByLocation)
+}
+
+// fetch fetches the payload of a secret followed by the related versions and
+// lookups it asks for.
+func (m *mountFetcher) fetch(ctx context.Context, s secretFetch) {
+	f, i, secret := m.fetched, s.i, s.secret
+	start := time.Now()
+	defer func() { f.timings[i].latency = time.Since(start) }()
+	if timeout := m.opts.timeout(s.loc); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	accessOpts := s.callOpts
+	if secret.PayloadAttempts > 0 {
+		accessOpts = append(slices.Clip(s.callOpts), RetryPolicy{MaxAttempts: secret.PayloadAttempts, Backoff: s.policy.Backoff}.callOption(&f.timings[i].retries, m.rules))
+	}
+
+	resp, err := m.payload(ctx, s, accessOpts)
+	if err != nil {
+		f.errs[i] = err
+		return
+	}
+	if secret.MinVersion > 0 {
+		if err := checkMinVersion(resp.GetName(), secret.MinVersion); err != nil {
+			f.errs[i] = err
+			return
+		}
+	}
+	f.results[i] = resp
+
+	if err := m.password(ctx, s, accessOpts); err != nil {
+		f.errs[i] = err
+		return
+	}
+	if err := m.previousVersions(ctx, s, resp); err != nil {
+		f.errs[i] = err
+		return
+	}
+	if err := m.lookupVersion(ctx, s, resp); err != nil {
+		f.errs[i] = err
+		return
+	}
+	m.lookupProvenance(ctx, s, resp)
+	m.lookupReplication(ctx, s, resp)
+}
+
+// payload accesses the secret version of s, or serves it from the cache.
+// Concurrent mounts missing the cache for the same secret share one fetch.
+func (m *mountFetcher) payload(ctx context.Context, s secretFetch, accessOpts []gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	cfg, opts, secret := m.cfg, m.opts, s.secret
+	timing := &m.fetched.timings[s.i]
+	var ttl time.Duration
+	if opts.Cache != nil {
+		ttl = opts.Cache.ttlFor(secret)
+	}
+	useCache := ttl > 0
+	key := cacheKey(cfg, secret.ResourceName)
+	if secret.ImpersonateServiceAccount != "" {
+		key += "|" + secret.ImpersonateServiceAccount
+	}
+	if useCache && opts.Cache.acquire(key) {
+		m.fetched.held[s.i] = key
+	}
+	if useCache && !cfg.RequireFresh {
+		resp, ok := opts.Cache.get(key)
+		if !ok {
+			// Wait for a concurrent mount fetching the same secret and use
+			// its entry, or fetch it if that failed.
+			wait, done := opts.Cache.startFetch(key)
+			if wait != nil {
+				select {
+				case <-wait:
+				case <-ctx.Done():
+				}
+				resp, ok = opts.Cache.get(key)
+			} else {
+				defer done()
+			}
+		}
+		if ok {
+			timing.cached = true
+			klog.V(5).InfoS("serving secret from cache", "resource_name", secret.ResourceName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+			return resp, nil
+		}
+	}
+
+	name := secret.ResourceName
+	if secret.ResolveAttempts > 0 && versionAlias(name) {
+		resolveOpts := append(slices.Clip(s.callOpts), RetryPolicy{MaxAttempts: secret.ResolveAttempts, Backoff: s.policy.Backoff}.callOption(&timing.retries, m.rules))
+		m.budget.spend(getVersionCost)
+		resolved, err := resolveVersion(ctx, s.client, name, resolveOpts)
+		if err != nil {
+			return nil, err
+		}
+		name = resolved
+	}
+	m.budget.spend(accessCost)
+	resp, err := accessSecretVersion(ctx, s.client, name, opts.Concurrency, accessOpts)
+	if status.Code(err) == codes.Unauthenticated && opts.RetryUnauthenticated && opts.refreshCreds != nil && secret.ImpersonateServiceAccount == "" {
+		klog.InfoS("refreshing mount credentials after an unauthenticated call", "resource_name", secret.ResourceName, "err", err, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		opts.refreshCreds()
+		m.budget.spend(accessCost)
+		resp, err = accessSecretVersion(ctx, s.client, name, opts.Concurrency, accessOpts)
+	}
+	if err != nil && len(secret.FallbackProjects) > 0 {
+		resp, err = accessFallbacks(ctx, s.client, secret, err, opts.Concurrency, accessOpts)
+	}
+	if err != nil && len(s.replicas) > 0 {
+		resp, err = accessReplicas(ctx, secret, s.replicas, err, opts.Concurrency, accessOpts)
+	}
+	stale := false
+	if err != nil && useCache && !cfg.RequireFresh && retryable(err, opts.RetryMessages) {
+		if cached, age, ok := opts.Cache.stale(key); ok {
+			csrmetrics.RecordStaleServed()
+			klog.InfoS("WARNING: serving cached secret after failing to fetch it", "resource_name", secret.ResourceName, "err", err, "expired_for", age, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+			resp, err, stale = cached, nil, true
+			timing.cached = true
+		}
+	}
+	if opts.DiagnoseAccessDenied && status.Code(err) == codes.PermissionDenied {
+		logIAMPolicySummary(ctx, s.client, name, s.callOpts, klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if useCache && !stale {
+		opts.Cache.put(key, resp, ttl)
+	}
+	return resp, nil
+}
+
+// password fetches the TransformPasswordSecret of s, if any.
+func (m *mountFetcher) password(ctx context.Context, s secretFetch, accessOpts []gax.CallOption) error {
+	if s.passwordClient == nil {
+		return nil
+	}
+	m.budget.spend(accessCost)
+	pw, err := accessSecretVersion(ctx, s.passwordClient, s.secret.TransformPasswordSecret, m.opts.Concurrency, accessOpts)
+	if err != nil {
+		return err
+	}
+	m.fetched.passwords[s.i] = pw.GetPayload().GetData()
+	return nil
+}
+
+// previousVersions fetches the versions preceding resp that s asks for.
+func (m *mountFetcher) previousVersions(ctx context.Context, s secretFetch, resp *secretmanagerpb.AccessSecretVersionResponse) error {
+	secret := s.secret
+	if secret.PreviousVersions <= 0 {
+		return nil
+	}
+	var createdAfter time.Time
+	if secret.PreviousVersionsCreatedAfter != "" {
+		t, err := time.Parse(time.RFC3339, secret.PreviousVersionsCreatedAfter)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid previousVersionsCreatedAfter for secret %s: %v", secret.ResourceName, err)
+		}
+		createdAfter = t
+	}
+	m.budget.spend(listCost)
+	names, err := previousVersions(ctx, s.client, resp.GetName(), secret.PreviousVersions, m.opts.MaxListedVersions, createdAfter, m.opts.VersionsBestEffort, s.callOpts)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		m.budget.spend(accessCost)
+		prev, err := accessSecretVersion(ctx, s.client, name, m.opts.Concurrency, s.callOpts)
+		if err != nil {
+			return err
+		}
+		m.fetched.previous[s.i] = append(m.fetched.previous[s.i], prev.GetPayload().GetData())
+	}
+	return nil
+}
+
+// lookupVersion looks up the exact version that was accessed so the checks
+// match the payload even for aliases. The lookup is optional unless a KMS key
+// is required, as are the provenance and replication lookups, so they are
+// skipped once the call budget of the mount runs out.
+func (m *mountFetcher) lookupVersion(ctx context.Context, s secretFetch, resp *secretmanagerpb.AccessSecretVersionResponse) error {
+	cfg, opts, secret := m.cfg, m.opts, s.secret
+	lookup := secret.RequireKMSKey != ""
+	if lookup {
+		m.budget.spend(getVersionCost)
+	} else if secret.Metadata || opts.DestroyWarningWindow > 0 {
+		if lookup = m.budget.take(getVersionCost); !lookup {
+			logBudgetExhausted("version", secret, cfg)
 		}
-		// #nosec G115 Checking limit
-		mode := int32(cfg.Permissions)
-		if secret.Mode != nil {
-			mode = *secret.Mode
+	}
+	if !lookup {
+		return nil
+	}
+	version, err := m.versions.get(ctx, s.client, resp.GetName(), s.callOpts)
+	if err != nil {
+		if secret.Metadata || secret.RequireKMSKey != "" {
+			return err
+		}
+		// The destruction warning alone never fails the mount.
+		klog.ErrorS(err, "failed to get secret version", "resource_name", secret.ResourceName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+	}
+	if opts.DestroyWarningWindow > 0 {
+		if at, ok := destroyWithin(version, opts.DestroyWarningWindow, time.Now()); ok {
+			csrmetrics.RecordScheduledDestroyWarning()
+			klog.InfoS("WARNING: mounted secret version is scheduled for destruction", "resource_name", secret.ResourceName, "version", resp.GetName(), "scheduled_destroy_time", at, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		}
+	}
+	if secret.RequireKMSKey != "" {
+		if err := checkKMSKey(version, secret.RequireKMSKey); err != nil {
+			return status.Errorf(codes.FailedPrecondition, "secret %s: %v", secret.ResourceName, err)
+		}
+	}
+	if secret.Metadata {
+		m.fetched.metadata[s.i] = &secretMetadata{Name: resp.GetName(), Etag: version.GetEtag()}
+	}
+	return nil
+}
+
+// lookupProvenance looks up the provenance of resp when s asks for it.
+// Provenance failures are written to the provenance file and counted apart
+// from secret failures, the payload is still mounted.
+func (m *mountFetcher) lookupProvenance(ctx context.Context, s secretFetch, resp *secretmanagerpb.AccessSecretVersionResponse) {
+	cfg, secret := m.cfg, s.secret
+	if !secret.Provenance {
+		return
+	}
+	if !m.budget.take(getVersionCost + getSecretCost) {
+		logBudgetExhausted("provenance", secret, cfg)
+		return
+	}
+	p, err := fetchProvenance(ctx, s.client, m.versions, resp.GetName(), s.loc, s.callOpts)
+	if err != nil {
+		csrmetrics.RecordProvenanceFailure(status.Code(err).String())
+		klog.ErrorS(err, "failed to get secret provenance", "resource_name", secret.ResourceName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		p = &secretProvenance{Name: resp.GetName(), Error: err.Error()}
+	}
+	m.fetched.provenance[s.i] = p
+}
+
+// lookupReplication looks up the replication of the secret of resp when it
+// is reported. Replication is reported for observability only, failing to
+// look it up never fails the mount.
+func (m *mountFetcher) lookupReplication(ctx context.Context, s secretFetch, resp *secretmanagerpb.AccessSecretVersionResponse) {
+	cfg, secret := m.cfg, s.secret
+	if !m.opts.ReportReplication && !secret.ReplicationFile {
+		return
+	}
+	if !m.budget.take(getSecretCost) {
+		logBudgetExhausted("replication", secret, cfg)
+		return
+	}
+	r, err := fetchReplication(ctx, s.client, resp.GetName(), s.loc, s.callOpts)
+	if err != nil {
+		klog.ErrorS(err, "failed to get secret replication", "resource_name", secret.ResourceName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+		return
+	}
+	klog.InfoS("secret replication", "resource_name", secret.ResourceName, "replication", r.Type, "locations", r.Locations, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+	m.fetched.replication[s.i] = r
+}
+
+// transformSecret turns the payload of a secret into the files it is written
+// as. The payload is decoded and cleaned up, then transformed or split, and
+// every resulting file is validated and encoded.
+func transformSecret(cfg *config.MountConfig, secret *config.Secret, contents, password []byte) ([]transformedFile, error) {
+	// Only attempt decoding if encoding is specified
+	if secret.Encoding != "" {
+		decodedContent, err := secret.DecodeContent(contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode secret %s: %v", secret.ResourceName, err)
+		}
+		contents = decodedContent
+	}
+
+	if secret.SourceCharset != "" {
+		transcoded, err := secret.TranscodeContent(contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transcode secret %s: %v", secret.ResourceName, err)
+		}
+		contents = transcoded
+	}
+
+	if secret.Encoding == "" && (secret.StripBOM || cfg.StripBOM) {
+		contents = stripBOM(contents)
+	}
+
+	if secret.TrimSpace && secret.Encoding == "" {
+		contents = trimSpace(contents)
+	}
+
+	if len(secret.ExtractEnvKeys) > 0 {
+		extracted, err := extractEnvKeys(secret, contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract env keys from secret %s: %v", secret.ResourceName, err)
+		}
+		contents = extracted
+	}
+
+	if secret.NormalizeJSON {
+		normalized, err := normalizeJSON(contents, secret.PrettyJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize secret %s: %v", secret.ResourceName, err)
+		}
+		contents = normalized
+	}
+
+	files := []transformedFile{{path: secret.PathString(), contents: contents}}
+	if secret.Transform != "" {
+		if password == nil && secret.TransformPassword != "" {
+			password = []byte(secret.TransformPassword)
+		}
+		transformed, err := transform(secret.Transform, transformInput{path: secret.PathString(), contents: contents, password: password, format: secret.FingerprintFormat})
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform secret %s: %v", secret.ResourceName, err)
+		}
+		files = transformed
+	}
+	if secret.SplitDelimiter != "" {
+		files = splitFiles(secret.PathString(), contents, secret.SplitDelimiter, secret.SplitSkipEmpty, secret.TrailingSeparator)
+	}
+
+	for k, f := range files {
+		if secret.ValidateRegex != "" {
+			if err := validateContent(secret.ValidateRegex, f.contents); err != nil {
+				return nil, fmt.Errorf("failed to validate secret %s: %v", secret.ResourceName, err)
+			}
+		}
+
+		if secret.EncodeOnWrite != "" {
+			encoded, err := secret.EncodeContent(f.contents)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode secret %s: %v", secret.ResourceName, err)
+			}
+			files[k].contents = encoded
+		}
+	}
+	return files, nil
+}
+
+// mountMode returns the permissions of the mount as a file mode.
+func mountMode(cfg *config.MountConfig) (int32, error) {
+	if cfg.Permissions > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid file permission %d", cfg.Permissions)
+	}
+	// #nosec G115 Checking limit
+	return int32(cfg.Permissions), nil
+}
+
+// responseWriter adds the files of a mount to its response. Contents of the
+// mount-level files, such as the env file, are gathered while secrets are
+// added and written once all secrets are.
+type responseWriter struct {
+	cfg  *config.MountConfig
+	opts MountOptions
+	out  *v1alpha1.MountResponse
+	// auth and principal are the identity of the mount, for logging.
+	auth, principal string
+
+	combined        map[string]string
+	env             []envEntry
+	tlsCert, tlsKey []byte
+	sources         map[string]manifestSource
+	seenIDs         map[string]bool
+}
+
+// writeResponse transforms the fetched secrets of the mount and writes them,
+// in response order, followed by the mount-level files to the response.
+func writeResponse(cfg *config.MountConfig, opts MountOptions, order []int, fetched *fetchedSecrets) (*v1alpha1.MountResponse, error) {
+	w := &responseWriter{
+		cfg:      cfg,
+		opts:     opts,
+		out:      &v1alpha1.MountResponse{ObjectVersion: make([]*v1alpha1.ObjectVersion, 0, len(cfg.Secrets))},
+		combined: make(map[string]string),
+		sources:  make(map[string]manifestSource),
+		seenIDs:  make(map[string]bool),
+	}
+	w.auth, w.principal = cfg.Identity()
+
+	for _, i := range order {
+		secret := cfg.Secrets[i]
+		if fetched.results[i] == nil {
+			// skipped optional secret
+			continue
+		}
+
+		perm, err := mountMode(cfg)
+		if err != nil {
+			return nil, err
 		}
+		mode, err := fileMode(secret, perm)
+		if err != nil {
+			return nil, err
+		}
+		files, err := transformSecret(cfg, secret, fetched.results[i].Payload.Data, fetched.passwords[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := w.addSecret(i, mode, files, fetched); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.addMountFiles(fetched); err != nil {
+		return nil, err
+	}
+
+	if err := checkOutputs(cfg, w.out.Files); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return w.out, nil
+}
 
-		result := results[i]
-		contents := result.Payload.Data
+// addSecret adds the transformed files of the i-th secret of the mount and
+// the files written next to it.
+func (w *responseWriter) addSecret(i int, mode int32, files []transformedFile, fetched *fetchedSecrets) error {
+	cfg, opts := w.cfg, w.opts
+	secret, result := cfg.Secrets[i], fetched.results[i]
+	for _, f := range files {
+		if secret.JSONKey != "" {
+			w.combined[secret.JSONKey] = combinedValue(f.contents)
+			continue
+		}
+		if secret.EnvKey != "" {
+			w.env = append(w.env, envEntry{key: secret.EnvKey, value: f.contents})
+			continue
+		}
+		if pair := cfg.EmitTLSPair; pair != nil && (secret.ResourceName == pair.Cert || secret.ResourceName == pair.Key) {
+			if secret.ResourceName == pair.Cert {
+				w.tlsCert = append(w.tlsCert, f.contents...)
+			} else {
+				w.tlsKey = append(w.tlsKey, f.contents...)
+			}
+			continue
+		}
 
-		// Only attempt decoding if encoding is specified
-		if secret.Encoding != "" {
-			decodedContent, err := secret.DecodeContent(contents)
+		if opts.DetectContentChanges && cfg.TargetPath != "" && filepath.IsLocal(f.path) {
+			changed, err := contentChanged(filepath.Join(cfg.TargetPath, f.path), f.contents)
 			if err != nil {
-				return nil, fmt.Errorf("failed to decode secret %s: %v", secret.ResourceName, err)
+				klog.V(3).InfoS("unable to compare secret with existing file", "err", err, "file_name", f.path, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+			} else {
+				csrmetrics.RecordContentCompare(changed)
+				klog.V(3).InfoS("compared secret with existing file", "file_name", f.path, "changed", changed, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
 			}
-			contents = decodedContent
 		}
 
-		out.Files = append(out.Files, &v1alpha1.File{
-			Path:     secret.PathString(),
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     f.path,
+			Mode:     mode,
+			Contents: f.contents,
+		})
+		w.sources[f.path] = manifestSource{resourceName: secret.ResourceName, version: result.GetName()}
+		if f.path != secret.PathString() {
+			continue
+		}
+		for _, p := range secret.AdditionalPaths {
+			w.out.Files = append(w.out.Files, &v1alpha1.File{
+				Path:     p,
+				Mode:     mode,
+				Contents: f.contents,
+			})
+			w.sources[p] = manifestSource{resourceName: secret.ResourceName, version: result.GetName()}
+		}
+	}
+	for k, contents := range fetched.previous[i] {
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     fmt.Sprintf("%s%s%d", secret.PathString(), previousSuffix, k+1),
 			Mode:     mode,
 			Contents: contents,
 		})
-		klog.V(5).InfoS("added secret to response", "resource_name", secret.ResourceName, "file_name", secret.FileName, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
+	}
+	// The metadata file is not listed in ObjectVersion so it does not take
+	// part in rotation comparisons.
+	if fetched.metadata[i] != nil {
+		b, err := json.Marshal(fetched.metadata[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata for secret %s: %v", secret.ResourceName, err)
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     secret.PathString() + metadataSuffix,
+			Mode:     mode,
+			Contents: b,
+		})
+	}
+	if fetched.provenance[i] != nil {
+		b, err := json.Marshal(fetched.provenance[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode provenance for secret %s: %v", secret.ResourceName, err)
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     secret.PathString() + provenanceSuffix,
+			Mode:     mode,
+			Contents: b,
+		})
+	}
+	if secret.ReplicationFile && fetched.replication[i] != nil {
+		b, err := json.Marshal(fetched.replication[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode replication for secret %s: %v", secret.ResourceName, err)
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     secret.PathString() + replicationSuffix,
+			Mode:     mode,
+			Contents: b,
+		})
+	}
+	secretAuth, secretPrincipal := w.auth, w.principal
+	if secret.ImpersonateServiceAccount != "" {
+		secretAuth, secretPrincipal = "impersonation", secret.ImpersonateServiceAccount
+	}
+	klog.V(5).InfoS("added secret to response", "resource_name", secret.ResourceName, "file_name", secret.FileName, "auth", secretAuth, "principal", secretPrincipal, "labels", cfg.Labels, "pod", klog.ObjectRef{Namespace: cfg.PodInfo.Namespace, Name: cfg.PodInfo.Name})
 
-		ovs[i] = &v1alpha1.ObjectVersion{
-			Id:      secret.ResourceName,
-			Version: result.GetName(),
+	if opts.DedupObjectVersions {
+		if w.seenIDs[secret.ResourceName] {
+			return nil
 		}
+		w.seenIDs[secret.ResourceName] = true
 	}
-	out.ObjectVersion = ovs
+	w.out.ObjectVersion = append(w.out.ObjectVersion, &v1alpha1.ObjectVersion{
+		Id:      secret.ResourceName,
+		Version: result.GetName(),
+	})
+	return nil
+}
 
-	return out, nil
+// addMountFiles adds the files built from all secrets of the mount.
+func (w *responseWriter) addMountFiles(fetched *fetchedSecrets) error {
+	cfg, opts := w.cfg, w.opts
+	if cfg.CombineIntoJSON != "" {
+		mode, err := mountMode(cfg)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(w.combined)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %v", cfg.CombineIntoJSON, err)
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     cfg.CombineIntoJSON,
+			Mode:     mode,
+			Contents: b,
+		})
+	}
+
+	if cfg.EmitEnvFile != "" {
+		mode, err := mountMode(cfg)
+		if err != nil {
+			return err
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     cfg.EmitEnvFile,
+			Mode:     mode,
+			Contents: envFile(w.env),
+		})
+	}
+
+	if pair := cfg.EmitTLSPair; pair != nil {
+		if w.tlsCert == nil || w.tlsKey == nil {
+			return fmt.Errorf("failed to build TLS pair: secrets %s and %s must both be mounted", pair.Cert, pair.Key)
+		}
+		crt, key, err := tlsPair(w.tlsCert, w.tlsKey)
+		if err != nil {
+			return fmt.Errorf("failed to build TLS pair from secrets %s and %s: %v", pair.Cert, pair.Key, err)
+		}
+		mode, err := mountMode(cfg)
+		if err != nil {
+			return err
+		}
+		w.out.Files = append(w.out.Files,
+			&v1alpha1.File{Path: tlsCertPath, Mode: mode, Contents: crt},
+			&v1alpha1.File{Path: tlsKeyPath, Mode: mode, Contents: key},
+		)
+	}
+
+	// The manifest is not listed in ObjectVersion so it does not take part in
+	// rotation comparisons.
+	if opts.TimingManifest {
+		mode, err := mountMode(cfg)
+		if err != nil {
+			return err
+		}
+		b, err := timingManifest(cfg.Secrets, fetched.results, fetched.timings)
+		if err != nil {
+			return fmt.Errorf("failed to encode timing manifest: %v", err)
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     timingManifestPath,
+			Mode:     mode,
+			Contents: b,
+		})
+	}
+
+	// The manifest and its signature are not listed in ObjectVersion so they
+	// do not take part in rotation comparisons.
+	if cfg.EmitManifest != "" {
+		mode, err := mountMode(cfg)
+		if err != nil {
+			return err
+		}
+		b, err := mountManifest(w.out.Files, w.sources)
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %v", err)
+		}
+		w.out.Files = append(w.out.Files, &v1alpha1.File{
+			Path:     cfg.EmitManifest,
+			Mode:     mode,
+			Contents: b,
+		})
+		if opts.ManifestKey != nil {
+			w.out.Files = append(w.out.Files, &v1alpha1.File{
+				Path:     cfg.EmitManifest + manifestSignatureSuffix,
+				Mode:     mode,
+				Contents: signManifest(opts.ManifestKey, b),
+			})
+		}
+	}
+	return nil
+}
+
+// metadataSuffix is appended to the path of a secret to name its metadata
+// file.
+const metadataSuffix = ".metadata.json"
+
+// secretMetadata is written next to a secret when Secret.Metadata is set.
+type secretMetadata struct {
+	// Name is the resolved secret version, e.g.
+	// projects/*/secrets/*/versions/1.
+	Name string `json:"name"`
+	// Etag is the etag of the secret version.
+	Etag string `json:"etag"`
 }
 
 // buildErr consolidates many errors into a single Status protobuf error message
 // with each individual error included into the status Details any proto. The
-// consolidated proto is converted to a general error.
-func buildErr(errs []error) error {
+// consolidated proto is converted to a general error. The message lists the
+// failures in the given format, one of ErrorFormatText or ErrorFormatJSON,
+// with names holding the resource name of the secret of each error.
+func buildErr(errs []error, names []string, format string) error {
 	msgs := make([]string, 0, len(errs))
 	hasErr := false
 	s := &spb.Status{
@@ -241,19 +1139,100 @@ func buildErr(errs []error) error {
 		return nil
 	}
 	s.Message = strings.Join(msgs, ",")
+	if format == ErrorFormatJSON {
+		s.Message = jsonFailures(names, errs)
+	}
 	return status.FromProto(s).Err()
 }
 
+// runFetches runs the fetches of every location and waits for them. Each
+// fetch runs concurrently unless grouped, in which case the fetches of a
+// location run one after the other so they share a connection, while the
+// locations still run concurrently.
+func runFetches(locs []string, fetches map[string][]func(), grouped bool) {
+	wg := sync.WaitGroup{}
+	for _, loc := range locs {
+		if grouped {
+			wg.Add(1)
+			go func(group []func()) {
+				defer wg.Done()
+				for _, fetch := range group {
+					fetch()
+				}
+			}(fetches[loc])
+			continue
+		}
+		for _, fetch := range fetches[loc] {
+			wg.Add(1)
+			go func(fetch func()) {
+				defer wg.Done()
+				fetch()
+			}(fetch)
+		}
+	}
+	wg.Wait()
+}
+
+// accessSecretVersion accesses the named secret version, holding a slot of
+// limiter, when set, for the duration of the call.
+func accessSecretVersion(ctx context.Context, client *secretmanager.Client, name string, limiter *AdaptiveLimiter, callOpts []gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	req := &secretmanagerpb.AccessSecretVersionRequest{
+		Name: name,
+	}
+	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_access_secret_version_requests")
+
+	if limiter != nil {
+		if err := limiter.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.AccessSecretVersion(ctx, req, callOpts...)
+	if messageTooLarge(err) {
+		err = messageTooLargeErr(name, err)
+	}
+	if limiter != nil {
+		limiter.release(err)
+	}
+	if err != nil {
+		if e, ok := status.FromError(err); ok {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+		}
+		return nil, err
+	}
+	smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+	return resp, nil
+}
+
+// secretClientFor returns the Secret Manager client serving the location of
+// the resource along with the location itself. Clients for regional endpoints
+// are created on first use and cached in regionalClients.
+func secretClientFor(ctx context.Context, resource string, client *secretmanager.Client, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption) (*secretmanager.Client, string, error) {
+	loc, err := locationFromSecretResource(resource)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(loc) > locationLengthLimit {
+		return nil, "", fmt.Errorf("invalid location string, please check the location")
+	}
+	if loc == "" {
+		return client, loc, nil
+	}
+	if _, ok := regionalClients[loc]; !ok {
+		regionalClient, err := newRegionalClient(ctx, loc, smOpts)
+		if err != nil {
+			return nil, "", err
+		}
+		regionalClients[loc] = regionalClient
+	}
+	return regionalClients[loc], loc, nil
+}
+
 // locationFromSecretResource returns location from the secret resource if the resource is in format "projects/<project_id>/locations/<location_id>/..."
 // returns "" for global secret resource.
 func locationFromSecretResource(resource string) (string, error) {
-	globalSecretRegexp := regexp.MustCompile(globalSecretRegex)
-	if m := globalSecretRegexp.FindStringSubmatch(resource); m != nil {
-		return "", nil
-	}
-	regionalSecretRegexp := regexp.MustCompile(regionalSecretRegex)
-	if m := regionalSecretRegexp.FindStringSubmatch(resource); m != nil {
-		return m[2], nil
+	r, err := parseResourceName(resource)
+	if err != nil {
+		return "", err
 	}
-	return "", status.Errorf(codes.InvalidArgument, "Invalid secret resource name: %s", resource)
+	return r.location, nil
 }
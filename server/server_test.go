@@ -15,13 +15,20 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"flag"
+	"fmt"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -29,8 +36,11 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 )
@@ -95,7 +105,7 @@ func TestHandleMountEvent(t *testing.T) {
 
 	regionalClients := make(map[string]*secretmanager.Client)
 
-	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{})
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
 	if err != nil {
 		t.Errorf("handleMountEvent() got err = %v, want err = nil", err)
 	}
@@ -104,6 +114,69 @@ func TestHandleMountEvent(t *testing.T) {
 	}
 }
 
+func TestHandleMountEventDedupObjectVersions(t *testing.T) {
+	const shared = "projects/project/secrets/test/versions/latest"
+	const other = "projects/project/secrets/other/versions/1"
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: shared, FileName: "good1.txt"},
+			{ResourceName: other, FileName: "other.txt"},
+			{ResourceName: shared, FileName: "good2.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    strings.Replace(req.Name, "latest", "2", 1),
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name  string
+		dedup bool
+		want  []*v1alpha1.ObjectVersion
+	}{
+		{
+			name: "one per file",
+			want: []*v1alpha1.ObjectVersion{
+				{Id: shared, Version: "projects/project/secrets/test/versions/2"},
+				{Id: other, Version: other},
+				{Id: shared, Version: "projects/project/secrets/test/versions/2"},
+			},
+		},
+		{
+			name:  "one per id",
+			dedup: true,
+			want: []*v1alpha1.ObjectVersion{
+				{Id: shared, Version: "projects/project/secrets/test/versions/2"},
+				{Id: other, Version: other},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{DedupObjectVersions: tc.dedup})
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if diff := cmp.Diff(tc.want, got.GetObjectVersion(), protocmp.Transform()); diff != "" {
+				t.Errorf("handleMountEvent() object versions diff (-want +got):\n%s", diff)
+			}
+			if len(got.GetFiles()) != 3 {
+				t.Errorf("handleMountEvent() got %d files, want 3", len(got.GetFiles()))
+			}
+		})
+	}
+}
+
 func TestHandleMountEventSMError(t *testing.T) {
 	cfg := &config.MountConfig{
 		Secrets: []*config.Secret{
@@ -126,7 +199,7 @@ func TestHandleMountEventSMError(t *testing.T) {
 	})
 
 	regionalClients := make(map[string]*secretmanager.Client)
-	_, got := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{})
+	_, got := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
 	if !strings.Contains(got.Error(), "FailedPrecondition") {
 		t.Errorf("handleMountEvent() got err = %v, want err = nil", got)
 	}
@@ -154,7 +227,7 @@ func TestHandleMountEventsInvalidLocations(t *testing.T) {
 	client := mock(t, &mockSecretServer{})
 
 	regionalClients := make(map[string]*secretmanager.Client)
-	_, got := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{})
+	_, got := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
 	if !strings.Contains(got.Error(), "invalid location") {
 		t.Errorf("handleMountEvent() got err = %v, want err = nil", got)
 	}
@@ -208,7 +281,7 @@ func TestHandleMountEventSMMultipleErrors(t *testing.T) {
 
 	regionalClients := make(map[string]*secretmanager.Client)
 
-	_, got := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{})
+	_, got := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
 	if !strings.Contains(got.Error(), "FailedPrecondition") {
 		t.Errorf("handleMountEvent() got err = %v, want err = nil", got)
 	}
@@ -292,7 +365,7 @@ func TestHandleMountEventForRegionalSecret(t *testing.T) {
 
 	regionalClients["us-central1"] = regionalClient
 
-	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{})
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
 	if err != nil {
 		t.Errorf("handleMountEvent() got err = %v, want err = nil", err)
 	}
@@ -394,7 +467,7 @@ func TestHandleMountEventWithEncoding(t *testing.T) {
 			})
 
 			regionalClients := make(map[string]*secretmanager.Client)
-			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), tt.cfg, regionalClients, []option.ClientOption{})
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), tt.cfg, regionalClients, []option.ClientOption{}, MountOptions{})
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("handleMountEvent() error = %v, wantErr %v", err, tt.wantErr)
@@ -407,6 +480,284 @@ func TestHandleMountEventWithEncoding(t *testing.T) {
 	}
 }
 
+func TestHandleMountEventStripBOM(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   *config.Secret
+		mountBOM bool
+		payload  []byte
+		want     []byte
+	}{
+		{
+			name:    "utf-8 bom",
+			secret:  &config.Secret{StripBOM: true},
+			payload: []byte("\xEF\xBB\xBFkey=value"),
+			want:    []byte("key=value"),
+		},
+		{
+			name:    "utf-16 big endian bom",
+			secret:  &config.Secret{StripBOM: true},
+			payload: []byte("\xFE\xFF\x00k\x00e\x00y"),
+			want:    []byte("\x00k\x00e\x00y"),
+		},
+		{
+			name:    "utf-16 little endian bom",
+			secret:  &config.Secret{StripBOM: true},
+			payload: []byte("\xFF\xFEk\x00e\x00y\x00"),
+			want:    []byte("k\x00e\x00y\x00"),
+		},
+		{
+			name:    "no bom",
+			secret:  &config.Secret{StripBOM: true},
+			payload: []byte("key=value"),
+			want:    []byte("key=value"),
+		},
+		{
+			name:     "mount default",
+			secret:   &config.Secret{},
+			mountBOM: true,
+			payload:  []byte("\xEF\xBB\xBFkey=value"),
+			want:     []byte("key=value"),
+		},
+		{
+			name:    "disabled",
+			secret:  &config.Secret{},
+			payload: []byte("\xEF\xBB\xBFkey=value"),
+			want:    []byte("\xEF\xBB\xBFkey=value"),
+		},
+		{
+			name:    "encoded secret untouched",
+			secret:  &config.Secret{StripBOM: true, Encoding: "base64"},
+			payload: []byte("77u/AAE="), // base64 of "\xEF\xBB\xBF\x00\x01"
+			want:    []byte("\xEF\xBB\xBF\x00\x01"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.secret.ResourceName = "projects/project/secrets/test/versions/1"
+			tt.secret.FileName = "bom.txt"
+			cfg := &config.MountConfig{
+				Secrets:     []*config.Secret{tt.secret},
+				Permissions: 777,
+				StripBOM:    tt.mountBOM,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name: "projects/project/secrets/test/versions/1",
+						Payload: &secretmanagerpb.SecretPayload{
+							Data: tt.payload,
+						},
+					}, nil
+				},
+			})
+
+			regionalClients := make(map[string]*secretmanager.Client)
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want err = nil", err)
+			}
+			if !bytes.Equal(got.Files[0].Contents, tt.want) {
+				t.Errorf("handleMountEvent() got contents = %q, want %q", got.Files[0].Contents, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventRegionRetryPolicy(t *testing.T) {
+	const regionalSecret = "projects/project/locations/us-central1/secrets/test/versions/1"
+	const globalSecret = "projects/project/secrets/test/versions/1"
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: regionalSecret,
+				FileName:     "regional.txt",
+			},
+			{
+				ResourceName: globalSecret,
+				FileName:     "global.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	// Both endpoints fail twice before succeeding.
+	flaky := func(calls *atomic.Int32, name string) func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		return func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if calls.Add(1) <= 2 {
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name: name,
+				Payload: &secretmanagerpb.SecretPayload{
+					Data: []byte("My Secret"),
+				},
+			}, nil
+		}
+	}
+
+	var globalCalls, regionalCalls atomic.Int32
+	client := mock(t, &mockSecretServer{accessFn: flaky(&globalCalls, globalSecret)})
+	regionalClients := map[string]*secretmanager.Client{
+		"us-central1": mock(t, &mockSecretServer{accessFn: flaky(&regionalCalls, regionalSecret)}),
+	}
+
+	opts := MountOptions{
+		DefaultRetryPolicy: RetryPolicy{MaxAttempts: 1},
+		RetryPolicies: map[string]RetryPolicy{
+			"us-central1": {MaxAttempts: 3, Backoff: time.Millisecond},
+		},
+	}
+
+	_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, opts)
+	if err == nil || !strings.Contains(err.Error(), "try again") {
+		t.Errorf("handleMountEvent() got err = %v, want Unavailable error from global secret", err)
+	}
+	if got := regionalCalls.Load(); got != 3 {
+		t.Errorf("regional AccessSecretVersion calls = %d, want 3", got)
+	}
+	if got := globalCalls.Load(); got != 1 {
+		t.Errorf("global AccessSecretVersion calls = %d, want 1", got)
+	}
+}
+
+func TestHandleMountEventOptionalSecrets(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/present/versions/1",
+				FileName:     "present.txt",
+			},
+			{
+				ResourceName: "projects/project/secrets/missing/versions/1",
+				FileName:     "missing.txt",
+				Optional:     true,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			switch req.Name {
+			case "projects/project/secrets/present/versions/1":
+				return &secretmanagerpb.AccessSecretVersionResponse{
+					Name:    req.Name,
+					Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+				}, nil
+			case "projects/project/secrets/missing/versions/1":
+				return nil, status.Error(codes.NotFound, "not found")
+			default:
+				return nil, status.Error(codes.PermissionDenied, "denied")
+			}
+		},
+	})
+
+	optionalBefore := metricValue(t, "secret_access_failure_count", map[string]string{"requirement": "optional", "code": "NotFound"})
+	requiredBefore := metricValue(t, "secret_access_failure_count", map[string]string{"requirement": "required", "code": "PermissionDenied"})
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{
+				Id:      "projects/project/secrets/present/versions/1",
+				Version: "projects/project/secrets/present/versions/1",
+			},
+		},
+		Files: []*v1alpha1.File{
+			{
+				Path:     "present.txt",
+				Mode:     777,
+				Contents: []byte("My Secret"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+	if got := metricValue(t, "secret_access_failure_count", map[string]string{"requirement": "optional", "code": "NotFound"}) - optionalBefore; got != 1 {
+		t.Errorf("optional NotFound failures = %v, want 1", got)
+	}
+
+	// A required secret failing is counted separately.
+	cfg.Secrets = append(cfg.Secrets, &config.Secret{
+		ResourceName: "projects/project/secrets/denied/versions/1",
+		FileName:     "denied.txt",
+	})
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{}); err == nil {
+		t.Errorf("handleMountEvent() got err = nil, want error for required secret")
+	}
+	if got := metricValue(t, "secret_access_failure_count", map[string]string{"requirement": "required", "code": "PermissionDenied"}) - requiredBefore; got != 1 {
+		t.Errorf("required PermissionDenied failures = %v, want 1", got)
+	}
+}
+
+// captureLogs redirects klog output at verbosity v to the returned buffer for
+// the duration of the test.
+func captureLogs(t *testing.T, v int) *bytes.Buffer {
+	t.Helper()
+	fs := &flag.FlagSet{}
+	klog.InitFlags(fs)
+	fs.Parse([]string{"-v", fmt.Sprint(v)})
+	t.Cleanup(func() { fs.Parse([]string{"-v", "0"}) })
+
+	klog.LogToStderr(false) // required to make SetOutput work
+	b := new(bytes.Buffer)
+	klog.SetOutput(b)
+	t.Cleanup(func() { klog.LogToStderr(true) })
+	return b
+}
+
+// metricValue returns the current value of the counter or gauge with the
+// given name and labels from the default prometheus registry.
+func metricValue(t testing.TB, name string, labels map[string]string) float64 {
+	t.Helper()
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			got := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				got[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue metrics
+				}
+			}
+			if m.GetCounter() != nil {
+				return m.GetCounter().GetValue()
+			}
+			return m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
 // mock builds a secretmanager.Client talking to a real in-memory secretmanager
 // GRPC server of the *mockSecretServer.
 func mock(t testing.TB, m *mockSecretServer) *secretmanager.Client {
@@ -446,38 +797,1377 @@ func mock(t testing.TB, m *mockSecretServer) *secretmanager.Client {
 	return client
 }
 
-// mockSecretServer matches the secremanagerpb.SecretManagerServiceServer
-// interface and allows the AccessSecretVersion implementation to be stubbed
-// with the accessFn function.
-type mockSecretServer struct {
-	secretmanagerpb.UnimplementedSecretManagerServiceServer
-	accessFn func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error)
-}
-
-func (s *mockSecretServer) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
-	if s.accessFn == nil {
-		return nil, status.Error(codes.Unimplemented, "mock does not implement accessFn")
+func TestHandleMountEventMetadata(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/test/versions/latest",
+				FileName:     "good1.txt",
+				Metadata:     true,
+			},
+			{
+				ResourceName: "projects/project/secrets/other/versions/1",
+				FileName:     "good2.txt",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
 	}
-	return s.accessFn(ctx, req)
-}
 
-// fakeCreds will adhere to the credentials.PerRPCCredentials interface to add
-// empty credentials on a per-rpc basis.
-type fakeCreds struct{}
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			name := strings.Replace(req.Name, "latest", "3", 1)
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			if req.Name != "projects/project/secrets/test/versions/3" {
+				return nil, status.Errorf(codes.NotFound, "unexpected version %s", req.Name)
+			}
+			return &secretmanagerpb.SecretVersion{Name: req.Name, Etag: `"16f4cd3a1b0c1"`}, nil
+		},
+	})
 
-func NewFakeCreds() fakeCreds {
-	return fakeCreds{}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{
+				Id:      "projects/project/secrets/test/versions/latest",
+				Version: "projects/project/secrets/test/versions/3",
+			},
+			{
+				Id:      "projects/project/secrets/other/versions/1",
+				Version: "projects/project/secrets/other/versions/1",
+			},
+		},
+		Files: []*v1alpha1.File{
+			{
+				Path:     "good1.txt",
+				Mode:     777,
+				Contents: []byte("My Secret"),
+			},
+			{
+				Path:     "good1.txt.metadata.json",
+				Mode:     777,
+				Contents: []byte(`{"name":"projects/project/secrets/test/versions/3","etag":"\"16f4cd3a1b0c1\""}`),
+			},
+			{
+				Path:     "good2.txt",
+				Mode:     777,
+				Contents: []byte("My Secret"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
 }
 
-// GetRequestMetadata gets the request metadata as a map from a TokenSource.
-func (f fakeCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
-	return map[string]string{
-		"authorization": "fake",
-	}, nil
-}
+func TestHandleMountEventForbidLatest(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
 
-// RequireTransportSecurity indicates whether the credentials requires transport security.
-// Since these are fake credentials for use with mock local server this is set to false.
-func (f fakeCreds) RequireTransportSecurity() bool {
+	tests := []struct {
+		name     string
+		resource string
+		wantCode codes.Code
+	}{
+		{
+			name:     "latest alias",
+			resource: "projects/project/secrets/test/versions/latest",
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "regional latest alias",
+			resource: "projects/project/locations/us-central1/secrets/test/versions/latest",
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "pinned version",
+			resource: "projects/project/secrets/test/versions/3",
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: tc.resource, FileName: "good1.txt"},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ForbidLatest: true})
+			if got := status.Code(err); got != tc.wantCode {
+				t.Errorf("handleMountEvent() got code = %v, want %v (err = %v)", got, tc.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventValidateRegex(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("key-1234")},
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{name: "match", pattern: `^key-[0-9]+$`},
+		{name: "mismatch", pattern: `^id-[0-9]+$`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{
+						ResourceName:  "projects/project/secrets/test/versions/1",
+						FileName:      "good1.txt",
+						ValidateRegex: tc.pattern,
+					},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("handleMountEvent() got err = %v, want err = %v", err, tc.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "projects/project/secrets/test/versions/1") {
+				t.Errorf("handleMountEvent() error %q does not name the secret", err)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventSubPath(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/app/versions/1",
+				FileName:     "key.txt",
+				SubPath:      "app",
+			},
+			{
+				ResourceName: "projects/project/secrets/sidecar/versions/1",
+				FileName:     "key.txt",
+				SubPath:      "sidecar",
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	var paths []string
+	for _, f := range got.Files {
+		paths = append(paths, f.Path)
+	}
+	if diff := cmp.Diff([]string{"app/key.txt", "sidecar/key.txt"}, paths); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected paths (-want +got):\n%s", diff)
+	}
+
+	cfg.Secrets[1].SubPath = "../sidecar"
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("handleMountEvent() with traversal subPath got err = %v, want InvalidArgument", err)
+	}
+}
+
+func TestHandleMountEventReplication(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+		getSecretFn: func(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+			if req.Name != "projects/project/secrets/test" {
+				return nil, status.Errorf(codes.NotFound, "unexpected secret %s", req.Name)
+			}
+			return &secretmanagerpb.Secret{
+				Name: req.Name,
+				Replication: &secretmanagerpb.Replication{
+					Replication: &secretmanagerpb.Replication_UserManaged_{
+						UserManaged: &secretmanagerpb.Replication_UserManaged{
+							Replicas: []*secretmanagerpb.Replication_UserManaged_Replica{
+								{Location: "europe-west1"},
+								{Location: "europe-west4"},
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:    "projects/project/secrets/test/versions/1",
+				FileName:        "good1.txt",
+				ReplicationFile: true,
+			},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ReportReplication: true})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{
+				Id:      "projects/project/secrets/test/versions/1",
+				Version: "projects/project/secrets/test/versions/1",
+			},
+		},
+		Files: []*v1alpha1.File{
+			{
+				Path:     "good1.txt",
+				Mode:     777,
+				Contents: []byte("My Secret"),
+			},
+			{
+				Path:     "good1.txt.replication.json",
+				Mode:     777,
+				Contents: []byte(`{"type":"user-managed","locations":["europe-west1","europe-west4"]}`),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() returned unexpected response (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleMountEventMaxSecretsPerMount(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt"},
+			{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	opts := MountOptions{MaxSecretsPerMount: 2}
+
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Errorf("handleMountEvent() at the limit got err = %v, want nil", err)
+	}
+
+	cfg.Secrets = append(cfg.Secrets, &config.Secret{ResourceName: "projects/project/secrets/c/versions/1", FileName: "c.txt"})
+	mu.Lock()
+	clear(calls)
+	mu.Unlock()
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("handleMountEvent() over the limit got err = %v, want InvalidArgument", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("handleMountEvent() over the limit made API calls %v, want none", calls)
+	}
+}
+
+func TestHandleMountEventRequireKMSKey(t *testing.T) {
+	const key = "projects/project/locations/us-central1/keyRings/ring/cryptoKeys/key"
+
+	tests := []struct {
+		name     string
+		keys     []string
+		wantCode codes.Code
+	}{
+		{
+			name:     "match",
+			keys:     []string{key + "/cryptoKeyVersions/1", key + "/cryptoKeyVersions/2"},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "one replica with another key",
+			keys:     []string{key + "/cryptoKeyVersions/1", "projects/project/locations/us-east1/keyRings/ring/cryptoKeys/other/cryptoKeyVersions/1"},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "google-managed encryption",
+			wantCode: codes.FailedPrecondition,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+					}, nil
+				},
+				getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+					um := &secretmanagerpb.ReplicationStatus_UserManagedStatus{}
+					for _, k := range tc.keys {
+						um.Replicas = append(um.Replicas, &secretmanagerpb.ReplicationStatus_UserManagedStatus_ReplicaStatus{
+							CustomerManagedEncryption: &secretmanagerpb.CustomerManagedEncryptionStatus{KmsKeyVersionName: k},
+						})
+					}
+					return &secretmanagerpb.SecretVersion{
+						Name: req.Name,
+						ReplicationStatus: &secretmanagerpb.ReplicationStatus{
+							ReplicationStatus: &secretmanagerpb.ReplicationStatus_UserManaged{UserManaged: um},
+						},
+					}, nil
+				},
+			})
+
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{
+						ResourceName:  "projects/project/secrets/test/versions/1",
+						FileName:      "good1.txt",
+						RequireKMSKey: key,
+					},
+				},
+				Permissions: 777,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+			_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if tc.wantCode == codes.OK {
+				if err != nil {
+					t.Errorf("handleMountEvent() got err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantCode.String()) || !strings.Contains(err.Error(), key) {
+				t.Errorf("handleMountEvent() got err = %v, want %v naming the required key", err, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventTrimSpace(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			data := []byte(" \ttoken\n")
+			if strings.Contains(req.Name, "encoded") {
+				// base64 of " \x00\n"
+				data = []byte("IAAK")
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: data},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/text/versions/1", FileName: "text.txt", TrimSpace: true},
+			{ResourceName: "projects/project/secrets/encoded/versions/1", FileName: "binary.bin", TrimSpace: true, Encoding: "base64"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if !bytes.Equal(got.Files[0].Contents, []byte("token")) {
+		t.Errorf("text contents = %q, want %q", got.Files[0].Contents, "token")
+	}
+	if !bytes.Equal(got.Files[1].Contents, []byte(" \x00\n")) {
+		t.Errorf("binary contents = %q, want them unchanged", got.Files[1].Contents)
+	}
+}
+
+func TestHandleMountEventFallbackProjects(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if !strings.HasPrefix(req.Name, "projects/dr/") {
+				return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("from-dr")},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/primary/secrets/test/versions/2", FileName: "good1.txt", FallbackProjects: []string{"standby", "dr"}},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if !bytes.Equal(got.Files[0].Contents, []byte("from-dr")) {
+		t.Errorf("contents = %q, want %q", got.Files[0].Contents, "from-dr")
+	}
+	if got.ObjectVersion[0].Version != "projects/dr/secrets/test/versions/2" {
+		t.Errorf("ObjectVersion = %q, want the fallback version", got.ObjectVersion[0].Version)
+	}
+
+	cfg.Secrets[0].FallbackProjects = []string{"standby"}
+	_, err = handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err == nil {
+		t.Fatalf("handleMountEvent() got err = nil, want an error")
+	}
+	for _, want := range []string{"projects/primary/secrets/test/versions/2", "projects/standby/secrets/test/versions/2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("handleMountEvent() got err = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestHandleMountEventFallbackPayloadAttempts(t *testing.T) {
+	var mu sync.Mutex
+	fallbackCalls := 0
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if !strings.HasPrefix(req.Name, "projects/dr/") {
+				return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			fallbackCalls++
+			if fallbackCalls == 1 {
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("from-dr")},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/primary/secrets/test/versions/2", FileName: "good1.txt", FallbackProjects: []string{"dr"}, PayloadAttempts: 2},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	// The fallback is only retried with the payloadAttempts of the secret.
+	opts := MountOptions{DefaultRetryPolicy: RetryPolicy{MaxAttempts: 1}}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if !bytes.Equal(got.Files[0].Contents, []byte("from-dr")) {
+		t.Errorf("contents = %q, want %q", got.Files[0].Contents, "from-dr")
+	}
+	if fallbackCalls != 2 {
+		t.Errorf("fallback calls = %d, want 2", fallbackCalls)
+	}
+}
+
+func TestHandleMountEventReplicaLocations(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if !strings.Contains(req.Name, "/locations/europe-west1/") {
+				return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("from-replica")},
+			}, nil
+		},
+	})
+	regionalClients := map[string]*secretmanager.Client{"us-central1": client, "us-east1": client, "europe-west1": client}
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/locations/us-central1/secrets/test/versions/2", FileName: "good1.txt", ReplicaLocations: []string{"us-east1", "europe-west1"}},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if !bytes.Equal(got.Files[0].Contents, []byte("from-replica")) {
+		t.Errorf("contents = %q, want %q", got.Files[0].Contents, "from-replica")
+	}
+	if got.ObjectVersion[0].Version != "projects/project/locations/europe-west1/secrets/test/versions/2" {
+		t.Errorf("ObjectVersion = %q, want the replica version", got.ObjectVersion[0].Version)
+	}
+
+	cfg.Secrets[0].ReplicaLocations = []string{"us-east1"}
+	_, err = handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
+	if err == nil {
+		t.Fatalf("handleMountEvent() got err = nil, want an error")
+	}
+	for _, want := range []string{"projects/project/locations/us-central1/secrets/test/versions/2", "projects/project/locations/us-east1/secrets/test/versions/2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("handleMountEvent() got err = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestHandleMountEventGroupByLocation(t *testing.T) {
+	// serve records the secrets accessed through a client and the highest
+	// number of concurrent calls it saw.
+	serve := func(mu *sync.Mutex, names *[]string, inFlight, maxInFlight *atomic.Int32) func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		return func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			*names = append(*names, req.Name)
+			mu.Unlock()
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(req.Name)},
+			}, nil
+		}
+	}
+
+	var mu sync.Mutex
+	var globalNames, regionalNames []string
+	var globalInFlight, globalMax, regionalInFlight, regionalMax atomic.Int32
+	client := mock(t, &mockSecretServer{accessFn: serve(&mu, &globalNames, &globalInFlight, &globalMax)})
+	regionalClients := map[string]*secretmanager.Client{
+		"us-central1": mock(t, &mockSecretServer{accessFn: serve(&mu, &regionalNames, &regionalInFlight, &regionalMax)}),
+	}
+
+	resources := []string{
+		"projects/project/secrets/a/versions/1",
+		"projects/project/locations/us-central1/secrets/b/versions/1",
+		"projects/project/secrets/c/versions/1",
+		"projects/project/locations/us-central1/secrets/d/versions/1",
+		"projects/project/secrets/e/versions/1",
+	}
+	cfg := &config.MountConfig{
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	for i, r := range resources {
+		cfg.Secrets = append(cfg.Secrets, &config.Secret{ResourceName: r, FileName: fmt.Sprintf("file%d.txt", i)})
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{GroupByLocation: true})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	for i, r := range resources {
+		if string(got.Files[i].Contents) != r || got.ObjectVersion[i].Id != r {
+			t.Errorf("file %d = %q (%s), want %q", i, got.Files[i].Contents, got.ObjectVersion[i].Id, r)
+		}
+	}
+	for _, name := range globalNames {
+		if strings.Contains(name, "/locations/") {
+			t.Errorf("global client accessed %s", name)
+		}
+	}
+	for _, name := range regionalNames {
+		if !strings.Contains(name, "/locations/us-central1/") {
+			t.Errorf("regional client accessed %s", name)
+		}
+	}
+	if len(globalNames) != 3 || len(regionalNames) != 2 {
+		t.Errorf("got %d global and %d regional calls, want 3 and 2", len(globalNames), len(regionalNames))
+	}
+	if globalMax.Load() != 1 || regionalMax.Load() != 1 {
+		t.Errorf("max concurrent calls = %d global, %d regional, want 1 each", globalMax.Load(), regionalMax.Load())
+	}
+}
+
+func TestHandleMountEventLogSuppressCodes(t *testing.T) {
+	b := captureLogs(t, 2)
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			if strings.Contains(req.Name, "denied") {
+				return nil, status.Error(codes.PermissionDenied, "denied")
+			}
+			return nil, status.Error(codes.NotFound, "not found")
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/missing/versions/1", FileName: "missing.txt", Optional: true},
+			{ResourceName: "projects/project/secrets/denied/versions/1", FileName: "denied.txt", Optional: true},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	before := metricValue(t, "secret_access_failure_count", map[string]string{"requirement": "optional", "code": "NotFound"})
+
+	opts := MountOptions{LogSuppressCodes: map[codes.Code]bool{codes.NotFound: true}}
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	klog.Flush()
+
+	if strings.Contains(b.String(), "secrets/missing") {
+		t.Errorf("suppressed NotFound was logged at -v=2:\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), "secrets/denied") {
+		t.Errorf("PermissionDenied was not logged:\n%s", b.String())
+	}
+	if got := metricValue(t, "secret_access_failure_count", map[string]string{"requirement": "optional", "code": "NotFound"}); got != before+1 {
+		t.Errorf("secret_access_failure_count = %v, want %v", got, before+1)
+	}
+}
+
+func TestHandleMountEventSourceCharset(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("p\xe4ssw\xf6rd")},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/legacy/versions/1", FileName: "legacy.txt", SourceCharset: "ISO-8859-1"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if want := "pässwörd"; string(got.Files[0].Contents) != want {
+		t.Errorf("contents = %q, want %q", got.Files[0].Contents, want)
+	}
+}
+
+func TestHandleMountEventLabels(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+		Labels: map[string]string{"team": "labels-test", "pod-hash": "5d8f7c"},
+	}
+
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{}); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if got := metricValue(t, "mount_event_count", map[string]string{"team": "labels-test", "result": "ok"}); got != 1 {
+		t.Errorf("mount_event_count{team=labels-test} = %v, want 1", got)
+	}
+	if got := metricValue(t, "mount_event_count", map[string]string{"pod-hash": "5d8f7c"}); got != 0 {
+		t.Errorf("mount_event_count{pod-hash=5d8f7c} = %v, want the label to be dropped", got)
+	}
+}
+
+func TestHandleMountEventDestroyWarning(t *testing.T) {
+	b := captureLogs(t, 0)
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		},
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			version := &secretmanagerpb.SecretVersion{Name: req.Name}
+			switch {
+			case strings.Contains(req.Name, "expiring"):
+				version.ScheduledDestroyTime = timestamppb.New(time.Now().Add(time.Hour))
+			case strings.Contains(req.Name, "later"):
+				version.ScheduledDestroyTime = timestamppb.New(time.Now().Add(30 * 24 * time.Hour))
+			}
+			return version, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/expiring/versions/1", FileName: "expiring.txt"},
+			{ResourceName: "projects/project/secrets/later/versions/1", FileName: "later.txt"},
+			{ResourceName: "projects/project/secrets/kept/versions/1", FileName: "kept.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	before := metricValue(t, "secret_scheduled_destroy_warning_count", nil)
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{DestroyWarningWindow: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if len(got.Files) != 3 {
+		t.Errorf("handleMountEvent() got %d files, want 3", len(got.Files))
+	}
+	klog.Flush()
+
+	if !strings.Contains(b.String(), "scheduled for destruction") || !strings.Contains(b.String(), "secrets/expiring/versions/1") {
+		t.Errorf("no warning logged for the expiring version:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "secrets/later/versions/1") {
+		t.Errorf("warning logged for a version outside the window:\n%s", b.String())
+	}
+	if got := metricValue(t, "secret_scheduled_destroy_warning_count", nil) - before; got != 1 {
+		t.Errorf("secret_scheduled_destroy_warning_count increased by %v, want 1", got)
+	}
+}
+
+func TestHandleMountEventResponseOrder(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte(req.Name)},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/b/versions/1", FileName: "z.txt"},
+			{ResourceName: "projects/project/secrets/c/versions/1", FileName: "a.txt"},
+			{ResourceName: "projects/project/secrets/a/versions/1", FileName: "m.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{order: "", want: []string{"z.txt", "a.txt", "m.txt"}},
+		{order: OrderConfig, want: []string{"z.txt", "a.txt", "m.txt"}},
+		{order: OrderPath, want: []string{"a.txt", "m.txt", "z.txt"}},
+		{order: OrderResourceName, want: []string{"m.txt", "z.txt", "a.txt"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.order, func(t *testing.T) {
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ResponseOrder: tc.order})
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			var paths []string
+			for i, f := range got.Files {
+				paths = append(paths, f.Path)
+				// Files and object versions follow the same order.
+				if got.ObjectVersion[i].Id != string(f.Contents) {
+					t.Errorf("ObjectVersion[%d] = %s, want %s to match Files[%d]", i, got.ObjectVersion[i].Id, f.Contents, i)
+				}
+			}
+			if diff := cmp.Diff(tc.want, paths); diff != "" {
+				t.Errorf("handleMountEvent() file order diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventCombineIntoJSON(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			data := []byte("s3cr3t")
+			if strings.Contains(req.Name, "keystore") {
+				data = []byte{0xfe, 0xed, 0xfe, 0xed, 0x00}
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: data},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/password/versions/1", JSONKey: "password"},
+			{ResourceName: "projects/project/secrets/keystore/versions/1", JSONKey: "keystore"},
+			{ResourceName: "projects/project/secrets/other/versions/1", FileName: "other.txt"},
+		},
+		CombineIntoJSON: "combined.json",
+		Permissions:     0640,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := []*v1alpha1.File{
+		{Path: "other.txt", Mode: 0640, Contents: []byte("s3cr3t")},
+		{Path: "combined.json", Mode: 0640, Contents: []byte(`{"keystore":"/u3+7QA=","password":"s3cr3t"}`)},
+	}
+	if diff := cmp.Diff(want, got.Files, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() files diff (-want +got):\n%s", diff)
+	}
+	if len(got.ObjectVersion) != 3 {
+		t.Errorf("handleMountEvent() got %d object versions, want 3", len(got.ObjectVersion))
+	}
+}
+
+func TestHandleMountEventResolveAttempts(t *testing.T) {
+	const alias = "projects/project/secrets/test/versions/latest"
+	const resolved = "projects/project/secrets/test/versions/7"
+
+	var resolveCalls, accessCalls atomic.Int32
+	client := mock(t, &mockSecretServer{
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			if resolveCalls.Add(1) <= 2 {
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+			return &secretmanagerpb.SecretVersion{Name: resolved}, nil
+		},
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			accessCalls.Add(1)
+			if req.Name != resolved {
+				return nil, status.Errorf(codes.Unavailable, "unexpected access of %s", req.Name)
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: alias, FileName: "good1.txt", ResolveAttempts: 3, PayloadAttempts: 1},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	opts := MountOptions{DefaultRetryPolicy: RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond}}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if got.ObjectVersion[0].Id != alias || got.ObjectVersion[0].Version != resolved {
+		t.Errorf("ObjectVersion = %v, want %s resolved to %s", got.ObjectVersion[0], alias, resolved)
+	}
+	if got := resolveCalls.Load(); got != 3 {
+		t.Errorf("GetSecretVersion calls = %d, want 3", got)
+	}
+	if got := accessCalls.Load(); got != 1 {
+		t.Errorf("AccessSecretVersion calls = %d, want 1", got)
+	}
+
+	// Payload retries stay disabled even though the location policy allows
+	// them.
+	resolveCalls.Store(2)
+	accessCalls.Store(0)
+	cfg.Secrets[0].ResourceName = "projects/project/secrets/other/versions/latest"
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	resolveCalls.Store(2)
+	cfg.Secrets[0].ResolveAttempts = 0
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, opts); err == nil || !strings.Contains(err.Error(), "unexpected access") {
+		t.Errorf("handleMountEvent() got err = %v, want the error of the unresolved access", err)
+	}
+	if got := accessCalls.Load(); got != 2 {
+		t.Errorf("AccessSecretVersion calls = %d, want 2 without payload retries", got)
+	}
+}
+
+func TestHandleMountEventVersionDivergence(t *testing.T) {
+	b := captureLogs(t, 0)
+
+	serve := func(version string) func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		return func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    strings.TrimSuffix(req.Name, "latest") + version,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		}
+	}
+	regionalClients := map[string]*secretmanager.Client{
+		"us-central1": mock(t, &mockSecretServer{accessFn: serve("3")}),
+		"us-east1":    mock(t, &mockSecretServer{accessFn: serve("4")}),
+	}
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/locations/us-central1/secrets/test/versions/latest", FileName: "central.txt"},
+			{ResourceName: "projects/project/locations/us-east1/secrets/test/versions/latest", FileName: "east.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	before := metricValue(t, "secret_version_divergence_count", nil)
+
+	if _, err := handleMountEvent(context.Background(), nil, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{DetectVersionDivergence: true}); err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	klog.Flush()
+
+	if !strings.Contains(b.String(), "different versions across locations") || !strings.Contains(b.String(), "projects/project/secrets/test/versions/latest") {
+		t.Errorf("no divergence warning logged:\n%s", b.String())
+	}
+	if got := metricValue(t, "secret_version_divergence_count", nil) - before; got != 1 {
+		t.Errorf("secret_version_divergence_count increased by %v, want 1", got)
+	}
+}
+
+func TestHandleMountEventSharedVersionLookup(t *testing.T) {
+	const key = "projects/project/locations/us-central1/keyRings/ring/cryptoKeys/key"
+
+	var calls atomic.Int32
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("value")},
+			}, nil
+		},
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			calls.Add(1)
+			return &secretmanagerpb.SecretVersion{
+				Name:                      req.Name,
+				Etag:                      "\"1\"",
+				CustomerManagedEncryption: &secretmanagerpb.CustomerManagedEncryptionStatus{KmsKeyVersionName: key + "/cryptoKeyVersions/1"},
+			}, nil
+		},
+	})
+	// The same version is mounted twice and each mount needs the metadata,
+	// the KMS key and the scheduled destruction of the version.
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "a.txt", Metadata: true, RequireKMSKey: key},
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "b.txt", Metadata: true, RequireKMSKey: key},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{DestroyWarningWindow: time.Hour})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if len(got.Files) != 4 {
+		t.Errorf("handleMountEvent() got %d files, want 2 secrets and 2 metadata files", len(got.Files))
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("GetSecretVersion calls = %d, want 1", got)
+	}
+}
+
+// mockSecretServer matches the secremanagerpb.SecretManagerServiceServer
+// interface and allows the AccessSecretVersion, GetSecretVersion and GetSecret
+// implementations to be stubbed with the accessFn, getVersionFn and
+// getSecretFn functions.
+type mockSecretServer struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+	accessFn     func(context.Context, *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error)
+	getVersionFn func(context.Context, *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error)
+	getSecretFn  func(context.Context, *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error)
+	getPolicyFn  func(context.Context, *iampb.GetIamPolicyRequest) (*iampb.Policy, error)
+	listFn       func(context.Context, *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error)
+}
+
+func (s *mockSecretServer) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	if s.accessFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement accessFn")
+	}
+	return s.accessFn(ctx, req)
+}
+
+func (s *mockSecretServer) GetSecretVersion(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	if s.getVersionFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement getVersionFn")
+	}
+	return s.getVersionFn(ctx, req)
+}
+
+func (s *mockSecretServer) GetSecret(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+	if s.getSecretFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement getSecretFn")
+	}
+	return s.getSecretFn(ctx, req)
+}
+
+func (s *mockSecretServer) ListSecretVersions(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	if s.listFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement listFn")
+	}
+	return s.listFn(ctx, req)
+}
+
+func (s *mockSecretServer) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	if s.getPolicyFn == nil {
+		return nil, status.Error(codes.Unimplemented, "mock does not implement getPolicyFn")
+	}
+	return s.getPolicyFn(ctx, req)
+}
+
+// fakeCreds will adhere to the credentials.PerRPCCredentials interface to add
+// empty credentials on a per-rpc basis.
+type fakeCreds struct{}
+
+func NewFakeCreds() fakeCreds {
+	return fakeCreds{}
+}
+
+// GetRequestMetadata gets the request metadata as a map from a TokenSource.
+func (f fakeCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "fake",
+	}, nil
+}
+
+// RequireTransportSecurity indicates whether the credentials requires transport security.
+// Since these are fake credentials for use with mock local server this is set to false.
+func (f fakeCreds) RequireTransportSecurity() bool {
 	return false
 }
+
+func TestHandleMountEventEncodeOnWrite(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret\n")},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/encoded/versions/1", FileName: "encoded.txt", EncodeOnWrite: "base64"},
+			{ResourceName: "projects/project/secrets/plain/versions/1", FileName: "plain.txt"},
+		},
+		Permissions: 0640,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := []*v1alpha1.File{
+		{Path: "encoded.txt", Mode: 0640, Contents: []byte("TXkgU2VjcmV0Cg==")},
+		{Path: "plain.txt", Mode: 0640, Contents: []byte("My Secret\n")},
+	}
+	if diff := cmp.Diff(want, got.GetFiles(), protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() files diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleMountEventAdditionalPaths(t *testing.T) {
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName:    "projects/project/secrets/test/versions/1",
+				FileName:        "good1.txt",
+				SubPath:         "app",
+				AdditionalPaths: []string{"tooling/good1.txt", "backup.txt"},
+			},
+		},
+		Permissions: 0640,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	want := &v1alpha1.MountResponse{
+		Files: []*v1alpha1.File{
+			{Path: "app/good1.txt", Mode: 0640, Contents: []byte("My Secret")},
+			{Path: "tooling/good1.txt", Mode: 0640, Contents: []byte("My Secret")},
+			{Path: "backup.txt", Mode: 0640, Contents: []byte("My Secret")},
+		},
+		ObjectVersion: []*v1alpha1.ObjectVersion{
+			{Id: "projects/project/secrets/test/versions/1", Version: "projects/project/secrets/test/versions/1"},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("handleMountEvent() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleMountEventNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		pretty  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "valid compact", payload: "{\"b\": 2,\n \"a\": 1}\n", want: `{"a":1,"b":2}`},
+		{name: "valid pretty", payload: `{"b":2,"a":1}`, pretty: true, want: "{\n  \"a\": 1,\n  \"b\": 2\n}"},
+		{name: "invalid", payload: `{"a": 1`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte(tc.payload)},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: "projects/project/secrets/config/versions/1", FileName: "config.json", NormalizeJSON: true, PrettyJSON: tc.pretty},
+				},
+				Permissions: 0640,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "projects/project/secrets/config/versions/1") {
+					t.Errorf("handleMountEvent() got err = %v, want an error naming the secret", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if string(got.GetFiles()[0].GetContents()) != tc.want {
+				t.Errorf("handleMountEvent() got contents %q, want %q", got.GetFiles()[0].GetContents(), tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventDependsOn(t *testing.T) {
+	tests := []struct {
+		name      string
+		secrets   []*config.Secret
+		order     string
+		wantPaths []string
+		wantErr   string
+	}{
+		{
+			name: "dependencies first",
+			secrets: []*config.Secret{
+				{ResourceName: "projects/project/secrets/cert/versions/1", FileName: "tls.crt", DependsOn: []string{"ca.crt"}},
+				{ResourceName: "projects/project/secrets/bundle/versions/1", FileName: "bundle.pem", DependsOn: []string{"tls.crt", "ca.crt"}},
+				{ResourceName: "projects/project/secrets/other/versions/1", FileName: "other.txt"},
+				{ResourceName: "projects/project/secrets/ca/versions/1", FileName: "ca.crt"},
+			},
+			wantPaths: []string{"other.txt", "ca.crt", "tls.crt", "bundle.pem"},
+		},
+		{
+			name: "by path with response order",
+			secrets: []*config.Secret{
+				{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt", DependsOn: []string{"certs/z.txt"}},
+				{ResourceName: "projects/project/secrets/z/versions/1", FileName: "z.txt", SubPath: "certs"},
+				{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt"},
+			},
+			order:     OrderPath,
+			wantPaths: []string{"b.txt", "certs/z.txt", "a.txt"},
+		},
+		{
+			name: "cycle",
+			secrets: []*config.Secret{
+				{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt", DependsOn: []string{"b.txt"}},
+				{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt", DependsOn: []string{"a.txt"}},
+				{ResourceName: "projects/project/secrets/c/versions/1", FileName: "c.txt"},
+			},
+			wantErr: "cycle",
+		},
+		{
+			name: "unknown file",
+			secrets: []*config.Secret{
+				{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt", DependsOn: []string{"missing.txt"}},
+			},
+			wantErr: "missing.txt",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets:     tc.secrets,
+				Permissions: 0640,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{ResponseOrder: tc.order})
+			if tc.wantErr != "" {
+				if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("handleMountEvent() got err = %v, want InvalidArgument containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			var paths []string
+			for _, f := range got.GetFiles() {
+				paths = append(paths, f.GetPath())
+			}
+			if diff := cmp.Diff(tc.wantPaths, paths); diff != "" {
+				t.Errorf("handleMountEvent() file order diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleMountEventEmptyMount(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     MountOptions
+		wantCode codes.Code
+	}{
+		{name: "empty allowed"},
+		{name: "empty fails", opts: MountOptions{FailOnEmptyMount: true}, wantCode: codes.InvalidArgument},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{})
+			cfg := &config.MountConfig{
+				Secrets:     []*config.Secret{},
+				Permissions: 0640,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, tc.opts)
+			if status.Code(err) != tc.wantCode {
+				t.Fatalf("handleMountEvent() got err = %v, want code %v", err, tc.wantCode)
+			}
+			if tc.wantCode != codes.OK {
+				return
+			}
+			if diff := cmp.Diff(&v1alpha1.MountResponse{}, got, protocmp.Transform()); diff != "" {
+				t.Errorf("handleMountEvent() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// splitFiles splits contents on delim into files named path.0, path.1 and so
+// on. Empty segments are dropped when skipEmpty is set and every segment ends
+// with delim when trailing is set.
+func splitFiles(path string, contents []byte, delim string, skipEmpty, trailing bool) []transformedFile {
+	var files []transformedFile
+	for _, segment := range bytes.Split(contents, []byte(delim)) {
+		if skipEmpty && len(segment) == 0 {
+			continue
+		}
+		if trailing {
+			segment = append(segment[:len(segment):len(segment)], delim...)
+		}
+		files = append(files, transformedFile{path: fmt.Sprintf("%s.%d", path, len(files)), contents: segment})
+	}
+	return files
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/testing/protocmp"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestHandleMountEventSplitDelimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		skipEmpty bool
+		trailing  bool
+		want      []*v1alpha1.File
+	}{
+		{
+			name:    "multiple segments",
+			payload: "alpha---beta---gamma",
+			want: []*v1alpha1.File{
+				{Path: "keys.0", Mode: 0640, Contents: []byte("alpha")},
+				{Path: "keys.1", Mode: 0640, Contents: []byte("beta")},
+				{Path: "keys.2", Mode: 0640, Contents: []byte("gamma")},
+			},
+		},
+		{
+			name:    "without delimiter",
+			payload: "alpha",
+			want: []*v1alpha1.File{
+				{Path: "keys.0", Mode: 0640, Contents: []byte("alpha")},
+			},
+		},
+		{
+			name:    "empty segments kept",
+			payload: "alpha------beta---",
+			want: []*v1alpha1.File{
+				{Path: "keys.0", Mode: 0640, Contents: []byte("alpha")},
+				{Path: "keys.1", Mode: 0640, Contents: []byte("")},
+				{Path: "keys.2", Mode: 0640, Contents: []byte("beta")},
+				{Path: "keys.3", Mode: 0640, Contents: []byte("")},
+			},
+		},
+		{
+			name:      "empty segments skipped",
+			payload:   "alpha------beta---",
+			skipEmpty: true,
+			want: []*v1alpha1.File{
+				{Path: "keys.0", Mode: 0640, Contents: []byte("alpha")},
+				{Path: "keys.1", Mode: 0640, Contents: []byte("beta")},
+			},
+		},
+		{
+			name:      "trailing separator",
+			payload:   "alpha---beta---",
+			skipEmpty: true,
+			trailing:  true,
+			want: []*v1alpha1.File{
+				{Path: "keys.0", Mode: 0640, Contents: []byte("alpha---")},
+				{Path: "keys.1", Mode: 0640, Contents: []byte("beta---")},
+			},
+		},
+		{
+			name:     "trailing separator without final delimiter",
+			payload:  "alpha---beta",
+			trailing: true,
+			want: []*v1alpha1.File{
+				{Path: "keys.0", Mode: 0640, Contents: []byte("alpha---")},
+				{Path: "keys.1", Mode: 0640, Contents: []byte("beta---")},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte(tc.payload)},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: "projects/project/secrets/keys/versions/1", FileName: "keys", SplitDelimiter: "---", SplitSkipEmpty: tc.skipEmpty, TrailingSeparator: tc.trailing},
+				},
+				Permissions: 0640,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			if diff := cmp.Diff(tc.want, got.GetFiles(), protocmp.Transform()); diff != "" {
+				t.Errorf("handleMountEvent() files diff (-want +got):\n%s", diff)
+			}
+			if len(got.GetObjectVersion()) != 1 {
+				t.Errorf("handleMountEvent() got %d object versions, want 1", len(got.GetObjectVersion()))
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// suppressedLogLevel is the verbosity at which failures of optional secrets
+// with a suppressed code are logged.
+const suppressedLogLevel = 5
+
+// ParseLogSuppressCodes parses a comma separated list of gRPC code names, e.g.
+// "NotFound,PermissionDenied".
+func ParseLogSuppressCodes(s string) (map[codes.Code]bool, error) {
+	out := make(map[codes.Code]bool)
+	if s == "" {
+		return out, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		code, ok := codeByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown gRPC code %q", name)
+		}
+		out[code] = true
+	}
+	return out, nil
+}
+
+// codeByName returns the gRPC code with the given name.
+func codeByName(name string) (codes.Code, bool) {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// createTemp creates the probe file of checkTargetWritable.
+var createTemp = os.CreateTemp
+
+// checkTargetWritable fails with FailedPrecondition when no file can be
+// created in the mount target. The driver writes the secret files after the
+// provider returns, where a read-only target surfaces as an opaque write
+// error, so the check runs before any secret is fetched and names the likely
+// cause.
+func checkTargetWritable(target string) error {
+	f, err := createTemp(target, ".gcp-provider-write-check-*")
+	if err == nil {
+		name := f.Name()
+		f.Close()
+		os.Remove(name)
+		return nil
+	}
+	switch {
+	case errors.Is(err, syscall.EROFS):
+		return status.Errorf(codes.FailedPrecondition, "mount target %s is on a read-only file system, check that the kubelet directory is mounted read-write into the driver and provider pods: %v", target, err)
+	case errors.Is(err, fs.ErrPermission):
+		return status.Errorf(codes.FailedPrecondition, "mount target %s is not writable, check the ownership and permissions of the directory and the securityContext of the driver and provider pods: %v", target, err)
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Errorf(codes.FailedPrecondition, "mount target %s does not exist, check that the kubelet directory is mounted into the provider pod at the same path as in the driver: %v", target, err)
+	}
+	return status.Errorf(codes.FailedPrecondition, "mount target %s is not writable: %v", target, err)
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckTargetWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkTargetWritable(dir); err != nil {
+		t.Fatalf("checkTargetWritable(%s) got err = %v, want nil", dir, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("checkTargetWritable(%s) left %d files behind", dir, len(entries))
+	}
+
+	missing := filepath.Join(dir, "missing")
+	if err := checkTargetWritable(missing); status.Code(err) != codes.FailedPrecondition || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("checkTargetWritable(%s) got err = %v, want a missing target error", missing, err)
+	}
+}
+
+func TestHandleMountEventReadOnlyTarget(t *testing.T) {
+	dir := t.TempDir()
+	// Root may write to any directory, so the read-only file system is
+	// simulated.
+	createTemp = func(dir, pattern string) (*os.File, error) {
+		return nil, &fs.PathError{Op: "open", Path: filepath.Join(dir, pattern), Err: syscall.EROFS}
+	}
+	t.Cleanup(func() { createTemp = os.CreateTemp })
+
+	calls := make(map[string]int)
+	var mu sync.Mutex
+	client := mock(t, &mockSecretServer{accessFn: countingAccess(calls, &mu)})
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/test/versions/1", FileName: "good1.txt"},
+		},
+		TargetPath:  dir,
+		Permissions: 0640,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{CheckTargetWritable: true})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("handleMountEvent() got err = %v, want FailedPrecondition", err)
+	}
+	for _, want := range []string{dir, "read-only file system", "mounted read-write"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("handleMountEvent() got err = %v, want it to mention %q", err, want)
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("handleMountEvent() accessed %v, want no secret fetched", calls)
+	}
+
+	// Without the check the mount proceeds, the driver does the writing.
+	if _, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{}); err != nil {
+		t.Errorf("handleMountEvent() got err = %v, want nil without the check", err)
+	}
+}
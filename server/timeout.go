@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseLocationTimeouts parses per-location fetch timeouts in the form
+// "us-central1=10s,global=5s".
+func ParseLocationTimeouts(s string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	if s == "" {
+		return out, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		loc, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || loc == "" {
+			return nil, fmt.Errorf("invalid timeout %q: expected location=duration", entry)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q: duration must be positive", entry)
+		}
+		out[loc] = d
+	}
+	return out, nil
+}
+
+// timeout returns the fetch timeout for the location of a secret, 0 when
+// fetches are only bounded by the client library per call timeout. An empty
+// location refers to the global endpoint.
+func (o MountOptions) timeout(loc string) time.Duration {
+	if loc == "" {
+		loc = globalLocation
+	}
+	if d, ok := o.Timeouts[loc]; ok {
+		return d
+	}
+	return o.DefaultTimeout
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+)
+
+func TestParseLocationTimeouts(t *testing.T) {
+	got, err := ParseLocationTimeouts("us-central1=10s, global=500ms")
+	if err != nil {
+		t.Fatalf("ParseLocationTimeouts() got err = %v, want nil", err)
+	}
+	want := map[string]time.Duration{
+		"us-central1": 10 * time.Second,
+		"global":      500 * time.Millisecond,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseLocationTimeouts() returned diff (-want +got):\n%s", diff)
+	}
+
+	for _, in := range []string{"us-central1", "=1s", "us-central1=soon", "us-central1=0s", "us-central1=-1s"} {
+		if _, err := ParseLocationTimeouts(in); err == nil {
+			t.Errorf("ParseLocationTimeouts(%q) got err = nil, want error", in)
+		}
+	}
+}
+
+func TestHandleMountEventLocationTimeouts(t *testing.T) {
+	const globalSecret = "projects/project/secrets/test/versions/1"
+	const regionalSecret = "projects/project/locations/australia-southeast1/secrets/test/versions/1"
+
+	slow := func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &secretmanagerpb.AccessSecretVersionResponse{
+			Name:    req.Name,
+			Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+		}, nil
+	}
+	client := mock(t, &mockSecretServer{accessFn: slow})
+	regionalClients := map[string]*secretmanager.Client{
+		"australia-southeast1": mock(t, &mockSecretServer{accessFn: slow}),
+	}
+	mount := func(resource string) error {
+		cfg := &config.MountConfig{
+			Secrets: []*config.Secret{
+				{ResourceName: resource, FileName: "good1.txt"},
+			},
+			Permissions: 777,
+			PodInfo: &config.PodInfo{
+				Namespace: "default",
+				Name:      "test-pod",
+			},
+		}
+		opts := MountOptions{
+			DefaultTimeout: 50 * time.Millisecond,
+			Timeouts:       map[string]time.Duration{"australia-southeast1": 5 * time.Second},
+		}
+		_, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, opts)
+		return err
+	}
+
+	if err := mount(regionalSecret); err != nil {
+		t.Errorf("handleMountEvent(%s) got err = %v, want the longer regional timeout to succeed", regionalSecret, err)
+	}
+	if err := mount(globalSecret); err == nil || !strings.Contains(err.Error(), "DeadlineExceeded") && !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("handleMountEvent(%s) got err = %v, want the default timeout to expire", globalSecret, err)
+	}
+}
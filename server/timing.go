@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+)
+
+// timingManifestPath is the file the timing manifest is written to.
+const timingManifestPath = ".gcp-provider-timings.json"
+
+// secretTiming is collected while fetching a single secret.
+type secretTiming struct {
+	latency  time.Duration
+	location string
+	cached   bool
+	retries  int
+	// countsRetries is false when the client library defaults apply, in
+	// which case retries are not observable.
+	countsRetries bool
+}
+
+// timingEntry is the manifest entry of a single file.
+type timingEntry struct {
+	Path          string  `json:"path"`
+	ResourceName  string  `json:"resourceName"`
+	LatencyMillis float64 `json:"latencyMs"`
+	Location      string  `json:"location"`
+	Cached        bool    `json:"cached"`
+	// Retries is omitted when they could not be counted.
+	Retries *int `json:"retries,omitempty"`
+}
+
+// timingManifest encodes the timings of the secrets included in the mount.
+func timingManifest(secrets []*config.Secret, results []*secretmanagerpb.AccessSecretVersionResponse, timings []secretTiming) ([]byte, error) {
+	entries := make([]timingEntry, 0, len(secrets))
+	for i, secret := range secrets {
+		if results[i] == nil {
+			continue
+		}
+		t := timings[i]
+		loc := t.location
+		if loc == "" {
+			loc = globalLocation
+		}
+		e := timingEntry{
+			Path:          secret.PathString(),
+			ResourceName:  secret.ResourceName,
+			LatencyMillis: float64(t.latency.Microseconds()) / 1000,
+			Location:      loc,
+			Cached:        t.cached,
+		}
+		if t.countsRetries {
+			e.Retries = &t.retries
+		}
+		entries = append(entries, e)
+	}
+	return json.Marshal(map[string][]timingEntry{"files": entries})
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHandleMountEventTimingManifest(t *testing.T) {
+	const global = "projects/project/secrets/test/versions/1"
+	const regional = "projects/project/locations/us-central1/secrets/test/versions/1"
+
+	var mu sync.Mutex
+	failed := false
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !failed {
+				failed = true
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+	regionalClient := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("My Secret")},
+			}, nil
+		},
+	})
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: global, FileName: "global.txt"},
+			{ResourceName: regional, FileName: "regional.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	opts := MountOptions{
+		TimingManifest: true,
+		RetryPolicies: map[string]RetryPolicy{
+			globalLocation: {MaxAttempts: 3, Backoff: time.Millisecond},
+		},
+	}
+	regionalClients := map[string]*secretmanager.Client{"us-central1": regionalClient}
+
+	got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, opts)
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if len(got.Files) != 3 || len(got.ObjectVersion) != 2 {
+		t.Fatalf("handleMountEvent() got %d files and %d object versions, want 3 and 2", len(got.Files), len(got.ObjectVersion))
+	}
+	manifest := got.Files[2]
+	if manifest.Path != timingManifestPath {
+		t.Fatalf("handleMountEvent() last file = %q, want %q", manifest.Path, timingManifestPath)
+	}
+	if manifest.Mode != int32(cfg.Permissions) {
+		t.Errorf("timing manifest mode = %o, want the mount permissions %o", manifest.Mode, cfg.Permissions)
+	}
+
+	var m struct {
+		Files []struct {
+			Path         string   `json:"path"`
+			ResourceName string   `json:"resourceName"`
+			LatencyMs    *float64 `json:"latencyMs"`
+			Location     string   `json:"location"`
+			Cached       bool     `json:"cached"`
+			Retries      *int     `json:"retries"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(manifest.Contents, &m); err != nil {
+		t.Fatalf("timing manifest %q is not valid JSON: %v", manifest.Contents, err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("timing manifest has %d entries, want 2", len(m.Files))
+	}
+
+	g, r := m.Files[0], m.Files[1]
+	if g.Path != "global.txt" || g.ResourceName != global || g.Location != "global" {
+		t.Errorf("global entry = %+v, want global.txt in global", g)
+	}
+	if g.LatencyMs == nil || *g.LatencyMs < 0 {
+		t.Errorf("global entry latency = %v, want non-negative", g.LatencyMs)
+	}
+	if g.Retries == nil || *g.Retries != 1 {
+		t.Errorf("global entry retries = %v, want 1", g.Retries)
+	}
+	if r.Path != "regional.txt" || r.Location != "us-central1" {
+		t.Errorf("regional entry = %+v, want regional.txt in us-central1", r)
+	}
+	if r.Retries != nil {
+		t.Errorf("regional entry retries = %d, want omitted without a retry policy", *r.Retries)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	// tlsCertPath and tlsKeyPath are the files of a Kubernetes TLS secret.
+	tlsCertPath = "tls.crt"
+	tlsKeyPath  = "tls.key"
+)
+
+// tlsPair returns the tls.crt and tls.key contents for a PEM certificate
+// chain and private key. The chain is ordered leaf first, each certificate
+// followed by its issuer, and the key must belong to the leaf.
+func tlsPair(chain, key []byte) ([]byte, []byte, error) {
+	var certs []*x509.Certificate
+	rest := chain
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, nil, fmt.Errorf("unsupported PEM block %q in certificate chain", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, nil, errors.New("no PEM encoded certificate found")
+	}
+
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, nil, errors.New("no PEM encoded private key found")
+	}
+	priv, err := parsePEMKey(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported key type %T, expected a private key", priv)
+	}
+
+	ordered := orderChain(certs)
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(ordered[0].PublicKey) {
+		return nil, nil, fmt.Errorf("private key does not match the certificate of %q", ordered[0].Subject)
+	}
+
+	var crt bytes.Buffer
+	for _, c := range ordered {
+		if err := pem.Encode(&crt, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return crt.Bytes(), pem.EncodeToMemory(block), nil
+}
+
+// orderChain orders certs leaf first, each certificate followed by its
+// issuer. The leaf is the certificate that issued no other one, certificates
+// outside of its chain are kept at the end in their original order.
+func orderChain(certs []*x509.Certificate) []*x509.Certificate {
+	issued := func(issuer, c *x509.Certificate) bool {
+		return issuer != c && bytes.Equal(c.RawIssuer, issuer.RawSubject) && c.CheckSignatureFrom(issuer) == nil
+	}
+	leaf := 0
+	for i, c := range certs {
+		isIssuer := false
+		for _, other := range certs {
+			if issued(c, other) {
+				isIssuer = true
+				break
+			}
+		}
+		if !isIssuer {
+			leaf = i
+			break
+		}
+	}
+
+	used := make([]bool, len(certs))
+	ordered := []*x509.Certificate{certs[leaf]}
+	used[leaf] = true
+	for cur := certs[leaf]; ; {
+		next := -1
+		for i, c := range certs {
+			if !used[i] && issued(c, cur) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		used[next] = true
+		cur = certs[next]
+		ordered = append(ordered, cur)
+	}
+	for i, c := range certs {
+		if !used[i] {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+)
+
+// testChain returns a PEM encoded CA and leaf certificate and the PEM
+// encoded private key of the leaf.
+func testChain(t *testing.T) (ca, leaf, leafKey []byte) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestHandleMountEventEmitTLSPair(t *testing.T) {
+	const certSecret = "projects/project/secrets/cert/versions/1"
+	const keySecret = "projects/project/secrets/key/versions/1"
+	ca, leaf, leafKey := testChain(t)
+	_, _, otherKey := testChain(t)
+
+	tests := []struct {
+		name    string
+		chain   []byte
+		key     []byte
+		wantErr string
+	}{
+		{name: "matching pair", chain: append(append([]byte{}, leaf...), ca...), key: leafKey},
+		{name: "chain stored CA first", chain: append(append([]byte{}, ca...), leaf...), key: leafKey},
+		{name: "mismatched pair", chain: append(append([]byte{}, leaf...), ca...), key: otherKey, wantErr: `private key does not match the certificate of "CN=example.com"`},
+		{name: "not a certificate", chain: []byte("hunter2"), key: leafKey, wantErr: "no PEM encoded certificate found"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := mock(t, &mockSecretServer{
+				accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+					data := tc.chain
+					if req.Name == keySecret {
+						data = tc.key
+					}
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: data},
+					}, nil
+				},
+			})
+			cfg := &config.MountConfig{
+				Secrets: []*config.Secret{
+					{ResourceName: certSecret, FileName: "cert.pem"},
+					{ResourceName: keySecret, FileName: "key.pem"},
+				},
+				EmitTLSPair: &config.TLSPair{Cert: certSecret, Key: keySecret},
+				Permissions: 0640,
+				PodInfo: &config.PodInfo{
+					Namespace: "default",
+					Name:      "test-pod",
+				},
+			}
+
+			got, err := handleMountEvent(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{}, MountOptions{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("handleMountEvent() got err = %v, want it to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+			}
+			files := make(map[string][]byte)
+			for _, f := range got.GetFiles() {
+				files[f.GetPath()] = f.GetContents()
+			}
+			if len(files) != 2 {
+				t.Errorf("handleMountEvent() got files %v, want tls.crt and tls.key only", len(files))
+			}
+			if want := append(append([]byte{}, leaf...), ca...); !bytes.Equal(files["tls.crt"], want) {
+				t.Errorf("tls.crt = %s, want the leaf followed by the CA", files["tls.crt"])
+			}
+			if !bytes.Equal(files["tls.key"], leafKey) {
+				t.Errorf("tls.key = %s, want %s", files["tls.key"], leafKey)
+			}
+			if len(got.GetObjectVersion()) != 2 {
+				t.Errorf("handleMountEvent() got %d object versions, want 2", len(got.GetObjectVersion()))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+)
+
+// transformInput is the payload of a secret and the parameters of its
+// transform.
+type transformInput struct {
+	// path is where the secret would be written without a transform.
+	path     string
+	contents []byte
+	// password unlocks encrypted payloads, it is nil when not configured.
+	password []byte
+	// format selects the output format of transforms that support several.
+	format string
+}
+
+// transformedFile is a file produced by a transform.
+type transformedFile struct {
+	path     string
+	contents []byte
+}
+
+// transformFunc converts a secret payload into the files written to the
+// mount.
+type transformFunc func(in transformInput) ([]transformedFile, error)
+
+// transforms maps the values of config.Secret.Transform to their
+// implementation.
+var transforms = map[string]transformFunc{
+	"cert-fingerprint-sha256": certFingerprintSHA256,
+	"pem-to-jwk":              singleFile(pemToJWK),
+	"pkcs12-extract":          pkcs12Extract,
+	"service-account-adc":     singleFile(serviceAccountADC),
+}
+
+// singleFile adapts a transform of the payload that keeps the secret's path.
+func singleFile(fn func(contents []byte) ([]byte, error)) transformFunc {
+	return func(in transformInput) ([]transformedFile, error) {
+		out, err := fn(in.contents)
+		if err != nil {
+			return nil, err
+		}
+		return []transformedFile{{path: in.path, contents: out}}, nil
+	}
+}
+
+// transform applies the named transform to in.
+func transform(name string, in transformInput) ([]transformedFile, error) {
+	fn, ok := transforms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transform %q, supported transforms are %v", name, transformNames())
+	}
+	return fn(in)
+}
+
+// transformNames returns the sorted names of the supported transforms.
+func transformNames() []string {
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// SecretReport describes whether a secret of a mount configuration can be
+// mounted. It never includes the secret payload.
+type SecretReport struct {
+	ResourceName string `json:"resourceName"`
+	FileName     string `json:"fileName"`
+	// Accessible is true if the version exists and is enabled.
+	Accessible bool `json:"accessible"`
+	// Version is the resolved version name, e.g. for the "latest" alias.
+	Version string `json:"version,omitempty"`
+	// State is the state of the resolved version.
+	State string `json:"state,omitempty"`
+	// Code and Error hold the failure of the metadata call, if any.
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// CheckMountConfig checks the files of a parsed mount configuration the same
+// way a mount does before any secret is fetched.
+func CheckMountConfig(cfg *config.MountConfig) error {
+	return checkPaths(cfg)
+}
+
+// ValidateMountConfig checks every secret of the mount configuration using
+// the GetSecretVersion metadata call and returns one report per secret in
+// configuration order. No payloads are accessed and nothing is written.
+func ValidateMountConfig(ctx context.Context, client *secretmanager.Client, creds credentials.PerRPCCredentials, cfg *config.MountConfig, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption) []*SecretReport {
+	reports := make([]*SecretReport, len(cfg.Secrets))
+	callAuth := gax.WithGRPCOptions(grpc.PerRPCCredentials(creds))
+
+	wg := sync.WaitGroup{}
+	for i, secret := range cfg.Secrets {
+		report := &SecretReport{
+			ResourceName: secret.ResourceName,
+			FileName:     secret.PathString(),
+		}
+		reports[i] = report
+
+		secretClient, _, err := secretClientFor(ctx, secret.ResourceName, client, regionalClients, smOpts)
+		if err != nil {
+			s := status.Convert(err)
+			report.Code = s.Code().String()
+			report.Error = s.Message()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_get_secret_version_requests")
+			v, err := secretClient.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{Name: report.ResourceName}, callAuth)
+			if err != nil {
+				s, _ := status.FromError(err)
+				smMetricRecorder(csrmetrics.OutboundRPCStatus(s.Code().String()))
+				report.Code = s.Code().String()
+				report.Error = s.Message()
+				return
+			}
+			smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+			report.Version = v.GetName()
+			report.State = v.GetState().String()
+			report.Accessible = v.GetState() == secretmanagerpb.SecretVersion_ENABLED
+		}()
+	}
+	wg.Wait()
+
+	return reports
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateMountConfig(t *testing.T) {
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{
+				ResourceName: "projects/project/secrets/ok/versions/latest",
+				FileName:     "ok.txt",
+			},
+			{
+				ResourceName: "projects/project/secrets/denied/versions/1",
+				FileName:     "denied.txt",
+			},
+			{
+				ResourceName: "projects/project/secrets/disabled/versions/3",
+				FileName:     "disabled.txt",
+			},
+			{
+				ResourceName: "not-a-resource",
+				FileName:     "invalid.txt",
+			},
+		},
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+
+	client := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, _ *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			t.Error("ValidateMountConfig() must not access payloads")
+			return nil, status.Error(codes.Internal, "unexpected")
+		},
+		getVersionFn: func(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+			switch req.Name {
+			case "projects/project/secrets/ok/versions/latest":
+				return &secretmanagerpb.SecretVersion{
+					Name:  "projects/project/secrets/ok/versions/7",
+					State: secretmanagerpb.SecretVersion_ENABLED,
+				}, nil
+			case "projects/project/secrets/disabled/versions/3":
+				return &secretmanagerpb.SecretVersion{
+					Name:  "projects/project/secrets/disabled/versions/3",
+					State: secretmanagerpb.SecretVersion_DISABLED,
+				}, nil
+			default:
+				return nil, status.Error(codes.PermissionDenied, "permission denied")
+			}
+		},
+	})
+
+	got := ValidateMountConfig(context.Background(), client, NewFakeCreds(), cfg, make(map[string]*secretmanager.Client), []option.ClientOption{})
+	want := []*SecretReport{
+		{
+			ResourceName: "projects/project/secrets/ok/versions/latest",
+			FileName:     "ok.txt",
+			Accessible:   true,
+			Version:      "projects/project/secrets/ok/versions/7",
+			State:        "ENABLED",
+		},
+		{
+			ResourceName: "projects/project/secrets/denied/versions/1",
+			FileName:     "denied.txt",
+			Code:         "PermissionDenied",
+			Error:        "permission denied",
+		},
+		{
+			ResourceName: "projects/project/secrets/disabled/versions/3",
+			FileName:     "disabled.txt",
+			Version:      "projects/project/secrets/disabled/versions/3",
+			State:        "DISABLED",
+		},
+		{
+			ResourceName: "not-a-resource",
+			FileName:     "invalid.txt",
+			Code:         "InvalidArgument",
+			Error:        "Invalid secret resource name: not-a-resource",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ValidateMountConfig() returned diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheckMountConfig(t *testing.T) {
+	ok := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt"},
+			{ResourceName: "projects/project/secrets/b/versions/1", FileName: "b.txt", SubPath: "dir"},
+		},
+	}
+	if err := CheckMountConfig(ok); err != nil {
+		t.Errorf("CheckMountConfig() got err = %v, want nil", err)
+	}
+
+	escaping := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: "projects/project/secrets/a/versions/1", FileName: "a.txt", SubPath: "../other"},
+		},
+	}
+	if err := CheckMountConfig(escaping); err == nil {
+		t.Errorf("CheckMountConfig() got err = nil, want an error for a subPath outside the mount")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/csrmetrics"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/status"
+)
+
+// versionFetcher looks up secret version metadata at most once per version
+// within a mount, sharing the result between every check and every secret
+// that needs it. Concurrent lookups of the same version wait for the first.
+type versionFetcher struct {
+	mu       sync.Mutex
+	versions map[string]*versionLookup
+}
+
+// versionLookup is the single lookup of a version.
+type versionLookup struct {
+	done    chan struct{}
+	version *secretmanagerpb.SecretVersion
+	err     error
+}
+
+func newVersionFetcher() *versionFetcher {
+	return &versionFetcher{versions: make(map[string]*versionLookup)}
+}
+
+// get returns the metadata of the named version, calling GetSecretVersion
+// only for the first request of each name.
+func (f *versionFetcher) get(ctx context.Context, client *secretmanager.Client, name string, callOpts []gax.CallOption) (*secretmanagerpb.SecretVersion, error) {
+	f.mu.Lock()
+	l, ok := f.versions[name]
+	if ok {
+		f.mu.Unlock()
+		select {
+		case <-l.done:
+			return l.version, l.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	l = &versionLookup{done: make(chan struct{})}
+	f.versions[name] = l
+	f.mu.Unlock()
+
+	smMetricRecorder := csrmetrics.OutboundRPCStartRecorder("secretmanager_get_secret_version_requests")
+	l.version, l.err = client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{Name: name}, callOpts...)
+	if l.err != nil {
+		if e, ok := status.FromError(l.err); ok {
+			smMetricRecorder(csrmetrics.OutboundRPCStatus(e.Code().String()))
+		}
+	} else {
+		smMetricRecorder(csrmetrics.OutboundRPCStatusOK)
+	}
+	close(l.done)
+	return l.version, l.err
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// warmUpProbeTimeout bounds the connection probe for each region.
+const warmUpProbeTimeout = 10 * time.Second
+
+// newRegionalClient creates the client for a regional Secret Manager endpoint.
+// It is a variable so tests can substitute a fake endpoint.
+var newRegionalClient = func(ctx context.Context, loc string, smOpts []option.ClientOption) (*secretmanager.Client, error) {
+	ep := option.WithEndpoint(fmt.Sprintf("secretmanager.%s.rep.googleapis.com:443", loc))
+	return secretmanager.NewClient(ctx, append(smOpts, ep)...)
+}
+
+// WarmUpRegions creates the clients for the given regions ahead of the first
+// mount and stores them in regionalClients where handleMountEvent picks them
+// up. If probe is set a GetSecretVersion call is issued in the background to
+// resolve the endpoint and establish the connection.
+//
+// Failures are logged and never returned so that warm-up cannot block
+// startup. It must be called before the server starts serving since
+// regionalClients is not safe for concurrent writes.
+func WarmUpRegions(ctx context.Context, regions []string, regionalClients map[string]*secretmanager.Client, smOpts []option.ClientOption, probe bool) {
+	for _, loc := range regions {
+		if loc == "" || loc == globalLocation {
+			continue
+		}
+		if len(loc) > locationLengthLimit {
+			klog.InfoS("skipping warm-up of invalid region", "location", loc)
+			continue
+		}
+		client, ok := regionalClients[loc]
+		if !ok {
+			var err error
+			client, err = newRegionalClient(ctx, loc, smOpts)
+			if err != nil {
+				klog.ErrorS(err, "failed to warm up regional client", "location", loc)
+				continue
+			}
+			regionalClients[loc] = client
+		}
+		if probe {
+			go probeRegion(ctx, client, loc)
+		}
+	}
+}
+
+// probeRegion issues a cheap RPC to open the connection to a regional
+// endpoint. The call is unauthenticated and names no real secret so any
+// response from the server, including Unauthenticated or NotFound, means the
+// connection was established.
+func probeRegion(ctx context.Context, client *secretmanager.Client, loc string) {
+	ctx, cancel := context.WithTimeout(ctx, warmUpProbeTimeout)
+	defer cancel()
+
+	name := fmt.Sprintf("projects/-/locations/%s/secrets/-/versions/-", loc)
+	_, err := client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{Name: name})
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		klog.ErrorS(err, "failed to connect to regional endpoint during warm-up", "location", loc)
+	default:
+		klog.V(3).InfoS("warmed up regional endpoint", "location", loc)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/secrets-store-csi-driver-provider-gcp/config"
+	"google.golang.org/api/option"
+)
+
+func TestWarmUpRegionsReusedByMount(t *testing.T) {
+	const resource = "projects/project/locations/us-central1/secrets/test/versions/1"
+
+	warmed := mock(t, &mockSecretServer{
+		accessFn: func(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    req.Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: []byte("warm")},
+			}, nil
+		},
+	})
+
+	created := make(map[string]int)
+	orig := newRegionalClient
+	newRegionalClient = func(ctx context.Context, loc string, smOpts []option.ClientOption) (*secretmanager.Client, error) {
+		created[loc]++
+		return warmed, nil
+	}
+	t.Cleanup(func() { newRegionalClient = orig })
+
+	regionalClients := make(map[string]*secretmanager.Client)
+	WarmUpRegions(context.Background(), []string{"us-central1", "global", ""}, regionalClients, []option.ClientOption{}, false)
+
+	if got := len(regionalClients); got != 1 {
+		t.Fatalf("WarmUpRegions() created %d clients, want 1", got)
+	}
+
+	cfg := &config.MountConfig{
+		Secrets: []*config.Secret{
+			{ResourceName: resource, FileName: "good1.txt"},
+		},
+		Permissions: 777,
+		PodInfo: &config.PodInfo{
+			Namespace: "default",
+			Name:      "test-pod",
+		},
+	}
+	got, err := handleMountEvent(context.Background(), nil, NewFakeCreds(), cfg, regionalClients, []option.ClientOption{}, MountOptions{})
+	if err != nil {
+		t.Fatalf("handleMountEvent() got err = %v, want nil", err)
+	}
+	if string(got.Files[0].Contents) != "warm" {
+		t.Errorf("handleMountEvent() contents = %q, want %q", got.Files[0].Contents, "warm")
+	}
+	if created["us-central1"] != 1 {
+		t.Errorf("regional client created %d times, want 1", created["us-central1"])
+	}
+}
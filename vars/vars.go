@@ -93,3 +93,11 @@ var AllowNodepublishSeretRef = EnvVar{
 	defaultValue: "false",
 	isRequired:   false,
 }
+
+// SecretListDir is the directory on the node that "@<file>" references in the
+// secrets parameter are resolved against. References are rejected when unset.
+var SecretListDir = EnvVar{
+	envVarName:   "SECRET_LIST_DIR",
+	defaultValue: "",
+	isRequired:   false,
+}